@@ -4,26 +4,79 @@ Package api is a Golang API service
 package api
 
 import (
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 )
 
 /*
 Api holds the controllers for each route and the http Handler, if any
 */
 type Api struct {
-	Controllers map[string]*Controller
-	Handler     http.Handler
+	Controllers     map[string]*Controller
+	Handler         http.Handler
+	HealthChecks    []*Check
+	Middleware      []Middleware
+	ReadinessChecks []*Check
+	Static          []*Static
+
+	/*
+		Server wide request size and read time limits
+	*/
+	Limits *Limits
+
+	/*
+		Optional, serve mock responses instead of calling the handlers
+	*/
+	Mock *Mock
+
+	/*
+		Optional, serve HTTPS using this configuration
+	*/
+	TLS *TLSConfig
+
+	/*
+		Serve HTTP/2 without TLS (h2c), for internal traffic
+	*/
+	H2C bool
+
+	/*
+		Only serve HTTP/1.1
+	*/
+	DisableHTTP2 bool
+
+	/*
+		The configuration applied with ApplyConfig or Reload
+	*/
+	config    *Config
+	reloadMux sync.Mutex
+
+	/*
+		The handler serving requests, replaced on Reload
+	*/
+	active atomic.Pointer[http.Handler]
+
+	/*
+		Rate limiter state by route, "" for the server wide limit, kept
+		across reloads
+	*/
+	rateLimiters map[string]*rateLimiter
 }
 
+/*
+Middleware wraps an http.Handler with additional behavior
+*/
+type Middleware func(http.Handler) http.Handler
+
 /*
 NewServer returns a new Api instance
 */
 func NewServer() *Api {
 	api := new(Api)
 	api.Controllers = make(map[string]*Controller)
+	api.Limits = DefaultLimits()
 	return api
 }
 
@@ -40,6 +93,15 @@ func (api *Api) AddHandler(endpoint string, handler func(*http.Request, *Respons
 	return api
 }
 
+/*
+Use adds middleware to the stack. Middleware is applied in the order it is
+added, the first middleware added is the outermost
+*/
+func (api *Api) Use(middleware ...Middleware) *Api {
+	api.Middleware = append(api.Middleware, middleware...)
+	return api
+}
+
 /*
 GetController retrieves a controller from the stack
 */
@@ -48,22 +110,143 @@ func (api *Api) GetController(endpoint string) (*Controller, error) {
 	if ok {
 		return controller, nil
 	}
-	return nil, errors.New("Controller not found")
+	return nil, ErrControllerNotFound
 }
 
 /*
 ListenAndServe serves all the stuff
 */
 func (api *Api) ListenAndServe(port string) {
-	mux := http.NewServeMux()
-
 	fmt.Printf("generating handlers... ")
-	for _, controller := range api.Controllers {
-		mux.HandleFunc(controller.Endpoint, controller.HandlerFunc())
+	server, err := api.NewHTTPServer(port)
+	if nil != err {
+		log.Fatal(err)
 	}
 	fmt.Println("done.")
 
 	fmt.Printf("starting server on port %s\n", port)
-	server := http.Server{Addr: port, Handler: mux}
+	if nil != server.TLSConfig {
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	}
 	log.Fatal(server.ListenAndServe())
 }
+
+/*
+NewHTTPServer returns an *http.Server for the Api configured with the TLS and
+HTTP/2 options
+*/
+func (api *Api) NewHTTPServer(port string) (*http.Server, error) {
+	api.BuildHandler()
+	server := &http.Server{Addr: port, Handler: api}
+	api.Limits.applyServer(server)
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	if nil != api.TLS {
+		config, err := api.TLS.Build()
+		if nil != err {
+			return nil, err
+		}
+		if api.DisableHTTP2 {
+			config.NextProtos = []string{"http/1.1"}
+		}
+		server.TLSConfig = config
+		protocols.SetHTTP2(!api.DisableHTTP2)
+	}
+	protocols.SetUnencryptedHTTP2(api.H2C && !api.DisableHTTP2)
+	server.Protocols = protocols
+
+	return server, nil
+}
+
+/*
+BuildHandler generates the routes for all controllers, wraps them in the
+middleware stack and stores the result in api.Handler
+*/
+func (api *Api) BuildHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	// Static files take precedence over a controller on the same prefix.
+	// Each handler gets its own chain so a reload doesn't change the
+	// handler still serving requests
+	statics := make(map[string]*staticRoute)
+	for _, static := range api.Static {
+		statics[static.Prefix] = &staticRoute{static: static}
+	}
+	routeLimits := make(map[string]Limits)
+	limiters := make(map[string]*rateLimiter)
+	for _, controller := range api.Controllers {
+		limits := api.Limits
+		if route := api.routeConfig(controller.Endpoint); nil != route {
+			if route.Disabled {
+				continue
+			}
+			merged := (&Limits{
+				MaxBodyBytes:    route.MaxBodyBytes,
+				BodyReadTimeout: route.BodyReadTimeout.Duration(),
+			}).merge(api.Limits)
+			limits = &merged
+		}
+		routeLimits[controller.Endpoint] = controller.Limits.merge(limits)
+		handler := controller.handlerFunc(limits)
+		if nil != api.Mock {
+			handler = api.Mock.handlerFunc(controller, limits)
+		}
+		if static, ok := statics[controller.Endpoint]; ok {
+			static.next = http.HandlerFunc(handler)
+			continue
+		}
+		mux.HandleFunc(controller.Endpoint, handler)
+	}
+	api.handleStatusEndpoints(mux)
+	for prefix, static := range statics {
+		mux.Handle(prefix, static)
+	}
+
+	var handler http.Handler = mux
+	for a := len(api.Middleware) - 1; a >= 0; a-- {
+		handler = api.Middleware[a](handler)
+	}
+
+	// Configured middleware is outermost so preflight and rate limited
+	// requests are answered first
+	if nil != api.config && nil != api.config.RateLimit {
+		handler = api.rateLimiter("", api.config.RateLimit, limiters).middleware(handler)
+	}
+	api.rateLimiters = limiters
+	if nil != api.config && nil != api.config.CORS {
+		handler = api.config.CORS.Middleware()(handler)
+	}
+	handler = withRouteLimits(mux, routeLimits, (&Limits{}).merge(api.Limits), handler)
+
+	api.Handler = handler
+	api.active.Store(&handler)
+	return handler
+}
+
+/*
+ServeHTTP implements http.Handler, serving requests with the handler from the
+last call to BuildHandler or Reload
+*/
+func (api *Api) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	handler := api.active.Load()
+	if nil == handler {
+		api.reloadMux.Lock()
+		if handler = api.active.Load(); nil == handler {
+			built := api.BuildHandler()
+			handler = &built
+		}
+		api.reloadMux.Unlock()
+	}
+	(*handler).ServeHTTP(writer, request)
+}
+
+/*
+routeConfig returns the configured settings for an endpoint, if any
+*/
+func (api *Api) routeConfig(endpoint string) *RouteConfig {
+	if nil == api.config {
+		return nil
+	}
+	return api.config.Routes[endpoint]
+}
@@ -0,0 +1,109 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+)
+
+/*
+DefaultBodyMemoryBytes is the largest body buffered in memory if
+Limits.BodyMemoryBytes is not set, larger bodies are buffered to a temporary
+file
+*/
+const DefaultBodyMemoryBytes = 1 << 20
+
+/*
+sharedBody is a buffered request body that can be read independently by any
+number of handlers
+*/
+type sharedBody struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+/*
+bufferBody reads a request body into memory, spilling to a temporary file once
+it grows larger than memLimit
+*/
+func bufferBody(body io.Reader, memLimit int64) (*sharedBody, error) {
+	if memLimit <= 0 {
+		memLimit = DefaultBodyMemoryBytes
+	}
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(body, memLimit+1))
+	if nil != err {
+		return nil, err
+	}
+	if n <= memLimit {
+		return &sharedBody{data: buf.Bytes(), size: n}, nil
+	}
+
+	file, err := os.CreateTemp("", "body-*")
+	if nil != err {
+		return nil, err
+	}
+	shared := &sharedBody{file: file}
+	shared.size, err = io.Copy(file, io.MultiReader(&buf, body))
+	if nil != err {
+		shared.cleanup()
+		return nil, err
+	}
+	return shared, nil
+}
+
+/*
+reader returns a new reader positioned at the start of the body
+*/
+func (body *sharedBody) reader() io.ReadCloser {
+	if nil != body.file {
+		return io.NopCloser(io.NewSectionReader(body.file, 0, body.size))
+	}
+	return io.NopCloser(bytes.NewReader(body.data))
+}
+
+/*
+cleanup removes the temporary file, if any
+*/
+func (body *sharedBody) cleanup() {
+	if nil != body.file {
+		body.file.Close()
+		os.Remove(body.file.Name())
+	}
+}
+
+/*
+shareRequest buffers the request body and parses any url encoded form once.
+The returned function creates a copy of the request for each handler with its
+own body reader and form values
+*/
+func shareRequest(request *http.Request, memLimit int64) (func() *http.Request, func(), error) {
+	body, err := bufferBody(request.Body, memLimit)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	base := request.Clone(request.Context())
+	base.Body = body.reader()
+	base.GetBody = func() (io.ReadCloser, error) {
+		return body.reader(), nil
+	}
+	if !isMultipart(base) && nil != base.ParseForm() {
+		// Leave the error for the handlers to find when they parse the form
+		base.Form = nil
+		base.PostForm = nil
+	}
+
+	next := func() *http.Request {
+		clone := base.Clone(base.Context())
+		clone.Body = body.reader()
+		return clone
+	}
+	return next, body.cleanup, nil
+}
@@ -0,0 +1,88 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodySharedWithHandlers(t *testing.T) {
+	handler := func(request *http.Request, response *Response) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&body); nil != err {
+			response.Channel <- err.Error()
+		} else {
+			response.Channel <- body.Name
+		}
+		response.Channel <- response.Done()
+	}
+	ctrl := NewController("/").AddHandler(handler).AddHandler(handler).AddHandler(handler)
+
+	recorder := httptest.NewRecorder()
+	ctrl.HandlerFunc()(recorder, httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"a"}`)))
+	if expect := `["a","a","a"]`; expect != recorder.Body.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+}
+
+func TestBodyFormSharedWithHandlers(t *testing.T) {
+	handler := func(request *http.Request, response *Response) {
+		response.Channel <- request.FormValue("name") + request.FormValue("q")
+		response.Channel <- response.Done()
+	}
+	ctrl := NewController("/").AddHandler(handler).AddHandler(handler)
+
+	request := httptest.NewRequest("POST", "/?q=b", strings.NewReader("name=a"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	ctrl.HandlerFunc()(recorder, request)
+	if expect := `["ab","ab"]`; expect != recorder.Body.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+}
+
+func TestBodySpillsToFile(t *testing.T) {
+	content := strings.Repeat("a", 100)
+	request := httptest.NewRequest("POST", "/", strings.NewReader(content))
+	next, cleanup, err := shareRequest(request, 10)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	for a := 0; a < 2; a++ {
+		data, err := io.ReadAll(next().Body)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if content != string(data) {
+			t.Errorf("expected %d bytes, %d found", len(content), len(data))
+		}
+	}
+	body, _ := next().GetBody()
+	if data, _ := io.ReadAll(body); content != string(data) {
+		t.Errorf("expected GetBody to return the full body, %d bytes found", len(data))
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	ctrl := NewController("/")
+	ctrl.Limits = &Limits{MaxBodyBytes: 4}
+	ctrl.AddHandler(func(request *http.Request, response *Response) {
+		response.Channel <- response.Done()
+	})
+
+	recorder := httptest.NewRecorder()
+	ctrl.HandlerFunc()(recorder, httptest.NewRequest("POST", "/", strings.NewReader("hello")))
+	if http.StatusRequestEntityTooLarge != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+}
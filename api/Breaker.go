@@ -0,0 +1,181 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+BreakerState is the state of a CircuitBreaker
+*/
+type BreakerState int
+
+const (
+	/*
+		BreakerClosed allows all requests
+	*/
+	BreakerClosed BreakerState = iota
+
+	/*
+		BreakerOpen rejects all requests until the open timeout expires
+	*/
+	BreakerOpen
+
+	/*
+		BreakerHalfOpen allows a single probe request at a time
+	*/
+	BreakerHalfOpen
+)
+
+/*
+String implements stringer
+*/
+func (state BreakerState) String() string {
+	switch state {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+/*
+BreakerMetrics is a snapshot of a CircuitBreaker's state and counters
+*/
+type BreakerMetrics struct {
+	State     string `json:"state"`
+	Successes int64  `json:"successes"`
+	Failures  int64  `json:"failures"`
+	Rejected  int64  `json:"rejected"`
+	Opened    int64  `json:"opened"`
+}
+
+/*
+CircuitBreaker stops calls to a failing upstream. After FailureThreshold
+consecutive failures the breaker opens and rejects calls for OpenTimeout, then
+allows probe calls through. SuccessThreshold consecutive successful probes
+close the breaker again, a failed probe re-opens it.
+*/
+type CircuitBreaker struct {
+	FailureThreshold int
+	SuccessThreshold int
+	OpenTimeout      time.Duration
+
+	mux       sync.Mutex
+	state     BreakerState
+	failures  int
+	successes int
+	probing   bool
+	openedAt  time.Time
+	metrics   BreakerMetrics
+}
+
+/*
+NewCircuitBreaker returns a pointer to a new CircuitBreaker
+*/
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		SuccessThreshold: 1,
+		OpenTimeout:      openTimeout,
+	}
+}
+
+/*
+Allow returns ErrCircuitOpen if a call should not be made. Every allowed call
+must be followed by a call to Success or Failure
+*/
+func (cb *CircuitBreaker) Allow() error {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+
+	if BreakerOpen == cb.state && time.Since(cb.openedAt) >= cb.OpenTimeout {
+		cb.state = BreakerHalfOpen
+		cb.successes = 0
+	}
+
+	switch cb.state {
+	case BreakerOpen:
+		cb.metrics.Rejected++
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if cb.probing {
+			cb.metrics.Rejected++
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+	}
+	return nil
+}
+
+/*
+Success records a successful call
+*/
+func (cb *CircuitBreaker) Success() {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.metrics.Successes++
+	cb.failures = 0
+	if BreakerHalfOpen == cb.state {
+		cb.probing = false
+		cb.successes++
+		if cb.successes >= cb.SuccessThreshold {
+			cb.state = BreakerClosed
+		}
+	}
+}
+
+/*
+Failure records a failed call
+*/
+func (cb *CircuitBreaker) Failure() {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.metrics.Failures++
+	cb.failures++
+	if BreakerHalfOpen == cb.state || (BreakerClosed == cb.state && cb.failures >= cb.FailureThreshold) {
+		cb.state = BreakerOpen
+		cb.probing = false
+		cb.openedAt = time.Now()
+		cb.metrics.Opened++
+	}
+}
+
+/*
+release ends an allowed call without recording a result
+*/
+func (cb *CircuitBreaker) release() {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.probing = false
+}
+
+/*
+State returns the current breaker state
+*/
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	if BreakerOpen == cb.state && time.Since(cb.openedAt) >= cb.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return cb.state
+}
+
+/*
+Metrics returns a snapshot of the breaker counters
+*/
+func (cb *CircuitBreaker) Metrics() BreakerMetrics {
+	state := cb.State()
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	metrics := cb.metrics
+	metrics.State = state.String()
+	return metrics
+}
@@ -0,0 +1,158 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/*
+CORSConfig configures cross-origin resource sharing
+*/
+type CORSConfig struct {
+	/*
+		Origins allowed to make requests, e.g. "https://example.com". "*"
+		allows any origin and "https://*.example.com" allows any subdomain
+	*/
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	/*
+		Methods allowed in preflight requests, defaults to GET, HEAD and POST
+	*/
+	AllowedMethods []string `json:"allowed_methods"`
+
+	/*
+		Request headers allowed in preflight requests
+	*/
+	AllowedHeaders []string `json:"allowed_headers"`
+
+	/*
+		Response headers exposed to the client
+	*/
+	ExposedHeaders []string `json:"exposed_headers"`
+
+	/*
+		Allow cookies and credentials, can't be combined with the "*" origin
+	*/
+	AllowCredentials bool `json:"allow_credentials"`
+
+	/*
+		How long preflight results may be cached
+	*/
+	MaxAge Duration `json:"max_age"`
+}
+
+/*
+Validate checks the configuration for errors
+*/
+func (cfg *CORSConfig) Validate() []string {
+	errs := make([]string, 0)
+	for _, origin := range cfg.AllowedOrigins {
+		if "*" == origin {
+			if cfg.AllowCredentials {
+				errs = append(errs, "cors.allowed_origins: '*' can't be used with allow_credentials")
+			}
+			continue
+		}
+		parsed, err := url.Parse(strings.Replace(origin, "*.", "", 1))
+		if nil != err || "" == parsed.Scheme || "" == parsed.Host || ("" != parsed.Path && "/" != parsed.Path) {
+			errs = append(errs, fmt.Sprintf("cors.allowed_origins: invalid origin '%s'", origin))
+		}
+	}
+	if cfg.MaxAge < 0 {
+		errs = append(errs, "cors.max_age: must not be negative")
+	}
+	return errs
+}
+
+/*
+allowsOrigin reports whether an Origin header value is allowed
+*/
+func (cfg *CORSConfig) allowsOrigin(origin string) bool {
+	origin = strings.TrimSuffix(origin, "/")
+	for _, allowed := range cfg.AllowedOrigins {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if "*" == allowed || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if k := strings.Index(allowed, "*."); k >= 0 {
+			prefix, suffix := allowed[:k], allowed[k+1:]
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Middleware returns middleware that adds CORS headers and answers preflight
+requests
+*/
+func (cfg *CORSConfig) Middleware() Middleware {
+	methods := cfg.AllowedMethods
+	if 0 == len(methods) {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	wildcard := false
+	for _, origin := range cfg.AllowedOrigins {
+		wildcard = wildcard || "*" == origin
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			origin := request.Header.Get("Origin")
+			if "" == origin {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			header := writer.Header()
+			header.Add("Vary", "Origin")
+			preflight := http.MethodOptions == request.Method && "" != request.Header.Get("Access-Control-Request-Method")
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if !cfg.allowsOrigin(origin) {
+				if preflight {
+					writeError(writer, http.StatusForbidden, fmt.Errorf("origin '%s' not allowed", origin))
+					return
+				}
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			if wildcard && !cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if 0 != len(cfg.ExposedHeaders) {
+					header.Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if 0 != len(cfg.AllowedHeaders) {
+				header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+			}
+			if cfg.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Duration().Seconds())))
+			}
+			writer.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := &CORSConfig{
+		AllowedOrigins:   []string{"https://example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           Duration(time.Minute),
+	}
+	handler := cfg.Middleware()(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+
+	request := httptest.NewRequest("OPTIONS", "/", nil)
+	request.Header.Set("Origin", "https://api.example.org")
+	request.Header.Set("Access-Control-Request-Method", "PUT")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if http.StatusNoContent != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusNoContent, recorder.Code)
+	}
+	expect := map[string]string{
+		"Access-Control-Allow-Origin":      "https://api.example.org",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, PUT",
+		"Access-Control-Allow-Headers":     "Content-Type",
+		"Access-Control-Max-Age":           "60",
+	}
+	for header, value := range expect {
+		if found := recorder.Header().Get(header); value != found {
+			t.Errorf("expected %s '%s', '%s' found", header, value, found)
+		}
+	}
+
+	request = httptest.NewRequest("OPTIONS", "/", nil)
+	request.Header.Set("Origin", "https://example.net")
+	request.Header.Set("Access-Control-Request-Method", "PUT")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if http.StatusForbidden != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusForbidden, recorder.Code)
+	}
+
+	request = httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Origin", "https://example.net")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if http.StatusOK != recorder.Code || "" != recorder.Header().Get("Access-Control-Allow-Origin") {
+		t.Errorf("expected a disallowed origin to be served without CORS headers")
+	}
+}
+
+func TestCORSValidate(t *testing.T) {
+	cfg := &CORSConfig{AllowedOrigins: []string{"*", "example.com"}, AllowCredentials: true}
+	errs := cfg.Validate()
+	if 2 != len(errs) {
+		t.Errorf("expected 2 errors, %v found", errs)
+	}
+}
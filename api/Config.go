@@ -0,0 +1,643 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mkenney/go/cli"
+)
+
+/*
+Duration is a time.Duration that is configured as a string such as "30s" or
+"1m30s". Plain numbers are read as seconds
+*/
+type Duration time.Duration
+
+/*
+Duration returns the value as a time.Duration
+*/
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+/*
+String implements fmt.Stringer
+*/
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+/*
+Set parses a duration string
+*/
+func (d *Duration) Set(value string) error {
+	if seconds, err := strconv.ParseFloat(value, 64); nil == err {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if nil != err {
+		return fmt.Errorf("invalid duration '%s'", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+/*
+MarshalJSON implements json.Marshaler
+*/
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+/*
+UnmarshalJSON implements json.Unmarshaler
+*/
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); nil != err {
+		value = string(data)
+	}
+	return d.Set(value)
+}
+
+/*
+LimitsConfig is the configuration form of Limits
+*/
+type LimitsConfig struct {
+	MaxBodyBytes      int64    `json:"max_body_bytes"`
+	MaxHeaderBytes    int      `json:"max_header_bytes"`
+	BodyMemoryBytes   int64    `json:"body_memory_bytes"`
+	BodyReadTimeout   Duration `json:"body_read_timeout"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout"`
+	WriteTimeout      Duration `json:"write_timeout"`
+}
+
+/*
+limits converts the configuration to Limits
+*/
+func (cfg LimitsConfig) limits() *Limits {
+	return &Limits{
+		MaxBodyBytes:      cfg.MaxBodyBytes,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		BodyMemoryBytes:   cfg.BodyMemoryBytes,
+		BodyReadTimeout:   cfg.BodyReadTimeout.Duration(),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.Duration(),
+		IdleTimeout:       cfg.IdleTimeout.Duration(),
+		WriteTimeout:      cfg.WriteTimeout.Duration(),
+	}
+}
+
+/*
+serverOnly returns the settings that are applied to the http.Server and can't
+be reloaded
+*/
+func (cfg LimitsConfig) serverOnly() LimitsConfig {
+	return LimitsConfig{
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+	}
+}
+
+/*
+RouteConfig overrides settings for a controller endpoint. Limits set on the
+Controller in code take precedence
+*/
+type RouteConfig struct {
+	/*
+		Remove the route, requests return 404
+	*/
+	Disabled bool `json:"disabled"`
+
+	MaxBodyBytes    int64    `json:"max_body_bytes"`
+	BodyReadTimeout Duration `json:"body_read_timeout"`
+}
+
+/*
+StaticConfig serves a directory, see Static
+*/
+type StaticConfig struct {
+	Prefix       string `json:"prefix"`
+	Dir          string `json:"dir"`
+	CacheControl string `json:"cache_control"`
+	Index        string `json:"index"`
+	AllowListing bool   `json:"allow_listing"`
+	SPAFallback  bool   `json:"spa_fallback"`
+}
+
+/*
+Config holds the server settings that can be loaded from a file, the
+environment or command line flags instead of being set in code. Limits, CORS,
+RateLimit and Routes can be reloaded while the server is running, changes to
+Port, Static and the server wide limits require a restart
+*/
+type Config struct {
+	/*
+		The address to listen on, e.g. ":8080"
+	*/
+	Port string `json:"port"`
+
+	Limits LimitsConfig `json:"limits"`
+
+	/*
+		Optional, enables CORS headers
+	*/
+	CORS *CORSConfig `json:"cors"`
+
+	/*
+		Optional, enables per client rate limiting
+	*/
+	RateLimit *RateLimitConfig `json:"rate_limit"`
+
+	/*
+		Settings for individual controllers, keyed by endpoint
+	*/
+	Routes map[string]*RouteConfig `json:"routes"`
+
+	/*
+		Directories to serve
+	*/
+	Static []*StaticConfig `json:"static"`
+}
+
+/*
+ConfigError lists every problem found when validating a Config
+*/
+type ConfigError struct {
+	Errors []string
+}
+
+/*
+Error implements error
+*/
+func (err *ConfigError) Error() string {
+	return "invalid configuration: " + strings.Join(err.Errors, "; ")
+}
+
+/*
+DefaultConfig returns a Config with the NewServer defaults
+*/
+func DefaultConfig() *Config {
+	limits := DefaultLimits()
+	return &Config{
+		Port: ":8080",
+		Limits: LimitsConfig{
+			MaxBodyBytes:      limits.MaxBodyBytes,
+			MaxHeaderBytes:    limits.MaxHeaderBytes,
+			BodyMemoryBytes:   limits.BodyMemoryBytes,
+			BodyReadTimeout:   Duration(limits.BodyReadTimeout),
+			ReadHeaderTimeout: Duration(limits.ReadHeaderTimeout),
+			IdleTimeout:       Duration(limits.IdleTimeout),
+			WriteTimeout:      Duration(limits.WriteTimeout),
+		},
+	}
+}
+
+/*
+LoadFile reads a JSON or YAML file over the current values. Unknown settings
+are an error
+*/
+func (cfg *Config) LoadFile(file string) error {
+	data, err := os.ReadFile(file)
+	if nil != err {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+	case ".yaml", ".yml":
+		value, err := cli.ParseYAML(data)
+		if nil != err {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if nil == value {
+			return nil
+		}
+		if data, err = json.Marshal(value); nil != err {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported configuration format", file)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); nil != err {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return nil
+}
+
+/*
+ApplyEnv reads settings from environment variables named after the setting
+with a prefix, e.g. API_PORT or API_CORS_ALLOWED_ORIGINS. Lists are comma
+separated
+*/
+func (cfg *Config) ApplyEnv(prefix string) error {
+	errs := make([]string, 0)
+	cfg.eachSetting(func(name string, typ reflect.Type, field func() reflect.Value) {
+		env := strings.ToUpper(strings.ReplaceAll(name, ".", "_"))
+		if "" != prefix {
+			env = strings.ToUpper(prefix) + "_" + env
+		}
+		if value, ok := os.LookupEnv(env); ok {
+			if err := setConfigValue(field(), value); nil != err {
+				errs = append(errs, fmt.Sprintf("%s: %v", env, err))
+			}
+		}
+	})
+	if 0 != len(errs) {
+		return &ConfigError{Errors: errs}
+	}
+	return nil
+}
+
+/*
+Flags returns a cli flag for every setting, named after the setting, e.g.
+--port or --cors-allowed-origins
+*/
+func (cfg *Config) Flags() []*cli.Flag {
+	flags := make([]*cli.Flag, 0)
+	cfg.eachSetting(func(name string, typ reflect.Type, field func() reflect.Value) {
+		flag := &cli.Flag{Name: configFlagName(name), Default: ""}
+		if reflect.Bool == typ.Kind() {
+			flag.Default = false
+		}
+		flags = append(flags, flag)
+	})
+	return flags
+}
+
+/*
+ApplyFlags reads settings from the flags that were passed to a command, see
+Flags
+*/
+func (cfg *Config) ApplyFlags(cmd *cli.Cmd) error {
+	errs := make([]string, 0)
+	cfg.eachSetting(func(name string, typ reflect.Type, field func() reflect.Value) {
+		flag, ok := cmd.Flags[configFlagName(name)]
+		if !ok || !flag.Called || nil == flag.Value {
+			return
+		}
+		if err := setConfigValue(field(), fmt.Sprint(flag.Value)); nil != err {
+			errs = append(errs, fmt.Sprintf("--%s: %v", flag.Name, err))
+		}
+	})
+	if 0 != len(errs) {
+		return &ConfigError{Errors: errs}
+	}
+	return nil
+}
+
+func configFlagName(name string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(name)
+}
+
+/*
+eachSetting calls fn with the dotted name and type of every scalar and list
+setting. field returns the setting, allocating any optional section it belongs to
+*/
+func (cfg *Config) eachSetting(fn func(name string, typ reflect.Type, field func() reflect.Value)) {
+	var walk func(prefix string, parent func() reflect.Value, typ reflect.Type)
+	walk = func(prefix string, parent func() reflect.Value, typ reflect.Type) {
+		for a := 0; a < typ.NumField(); a++ {
+			field := typ.Field(a)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if "" == name || "-" == name {
+				continue
+			}
+			if "" != prefix {
+				name = prefix + "." + name
+			}
+			index := a
+			get := func() reflect.Value {
+				value := parent()
+				if reflect.Ptr == value.Kind() {
+					if value.IsNil() {
+						value.Set(reflect.New(value.Type().Elem()))
+					}
+					value = value.Elem()
+				}
+				return value.Field(index)
+			}
+
+			fieldType := field.Type
+			if reflect.Ptr == fieldType.Kind() {
+				fieldType = fieldType.Elem()
+			}
+			switch {
+			case reflect.TypeOf(Duration(0)) == fieldType:
+				fn(name, fieldType, get)
+			case reflect.Struct == fieldType.Kind():
+				walk(name, get, fieldType)
+			case reflect.Slice == fieldType.Kind() && reflect.String == fieldType.Elem().Kind():
+				fn(name, fieldType, get)
+			case reflect.Map != fieldType.Kind() && reflect.Slice != fieldType.Kind():
+				fn(name, fieldType, get)
+			}
+		}
+	}
+	walk("", func() reflect.Value { return reflect.ValueOf(cfg).Elem() }, reflect.TypeOf(*cfg))
+}
+
+/*
+setConfigValue parses a string into a setting
+*/
+func setConfigValue(field reflect.Value, value string) error {
+	if duration, ok := field.Addr().Interface().(*Duration); ok {
+		return duration.Set(value)
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if nil != err {
+			return fmt.Errorf("invalid boolean '%s'", value)
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if nil != err {
+			return fmt.Errorf("invalid integer '%s'", value)
+		}
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if nil != err {
+			return fmt.Errorf("invalid number '%s'", value)
+		}
+		field.SetFloat(parsed)
+	case reflect.Slice:
+		items := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); "" != item {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+/*
+Validate checks the configuration and returns a *ConfigError listing every
+problem found
+*/
+func (cfg *Config) Validate() error {
+	errs := make([]string, 0)
+
+	if _, port, err := net.SplitHostPort(cfg.Port); nil != err {
+		errs = append(errs, fmt.Sprintf("port: invalid address '%s'", cfg.Port))
+	} else if number, err := strconv.Atoi(port); nil != err || number < 0 || number > 65535 {
+		errs = append(errs, fmt.Sprintf("port: invalid port '%s'", port))
+	}
+
+	limits := reflect.ValueOf(cfg.Limits)
+	for a := 0; a < limits.NumField(); a++ {
+		if limits.Field(a).Int() < 0 {
+			errs = append(errs, fmt.Sprintf("limits.%s: must not be negative", strings.Split(limits.Type().Field(a).Tag.Get("json"), ",")[0]))
+		}
+	}
+
+	if nil != cfg.CORS {
+		errs = append(errs, cfg.CORS.Validate()...)
+	}
+	if nil != cfg.RateLimit {
+		errs = append(errs, cfg.RateLimit.Validate()...)
+	}
+
+	for endpoint, route := range cfg.Routes {
+		if !strings.HasPrefix(endpoint, "/") {
+			errs = append(errs, fmt.Sprintf("routes.%s: endpoints must start with '/'", endpoint))
+		}
+		if nil != route && (route.MaxBodyBytes < 0 || route.BodyReadTimeout < 0) {
+			errs = append(errs, fmt.Sprintf("routes.%s: limits must not be negative", endpoint))
+		}
+	}
+
+	for k, static := range cfg.Static {
+		if !strings.HasPrefix(static.Prefix, "/") {
+			errs = append(errs, fmt.Sprintf("static[%d].prefix: must start with '/'", k))
+		}
+		if info, err := os.Stat(static.Dir); nil != err || !info.IsDir() {
+			errs = append(errs, fmt.Sprintf("static[%d].dir: '%s' is not a directory", k, static.Dir))
+		}
+	}
+
+	if 0 != len(errs) {
+		return &ConfigError{Errors: errs}
+	}
+	return nil
+}
+
+/*
+ConfigLoader builds a Config from its sources. Later sources take precedence:
+defaults, then the file, then the environment, then command line flags
+*/
+type ConfigLoader struct {
+	/*
+		Optional, a .json, .yaml or .yml file
+	*/
+	File string
+
+	/*
+		Optional, the environment variable prefix, e.g. "API"
+	*/
+	EnvPrefix string
+
+	/*
+		Optional, a parsed command with the flags returned by Config.Flags
+	*/
+	Cmd *cli.Cmd
+
+	/*
+		The modification time of the file when it was last loaded
+	*/
+	modified time.Time
+}
+
+/*
+Load reads and validates the configuration
+*/
+func (loader *ConfigLoader) Load() (*Config, error) {
+	cfg := DefaultConfig()
+	if "" != loader.File {
+		loader.modified = configModTime(loader.File)
+		if err := cfg.LoadFile(loader.File); nil != err {
+			return nil, err
+		}
+	}
+	if "" != loader.EnvPrefix {
+		if err := cfg.ApplyEnv(loader.EnvPrefix); nil != err {
+			return nil, err
+		}
+	}
+	if nil != loader.Cmd {
+		if err := cfg.ApplyFlags(loader.Cmd); nil != err {
+			return nil, err
+		}
+	}
+	if err := cfg.Validate(); nil != err {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+/*
+ApplyConfig configures the Api. It is called once before the server starts,
+use Reload to change the configuration of a running server
+*/
+func (api *Api) ApplyConfig(cfg *Config) error {
+	if err := api.checkConfig(cfg); nil != err {
+		return err
+	}
+	api.reloadMux.Lock()
+	defer api.reloadMux.Unlock()
+
+	for _, static := range cfg.Static {
+		handler := NewStaticDir(static.Prefix, static.Dir)
+		if "" != static.CacheControl {
+			handler.CacheControl = static.CacheControl
+		}
+		if "" != static.Index {
+			handler.Index = static.Index
+		}
+		handler.AllowListing = static.AllowListing
+		handler.SPAFallback = static.SPAFallback
+		api.AddStatic(handler)
+	}
+	api.Limits = cfg.Limits.limits()
+	api.config = cfg
+	return nil
+}
+
+/*
+Reload applies the reloadable settings of a new configuration to a running
+server and swaps in a new handler. Requests in progress complete with the
+previous settings and no connections are dropped. Settings that require a
+restart are logged and ignored
+*/
+func (api *Api) Reload(cfg *Config) error {
+	if err := api.checkConfig(cfg); nil != err {
+		return err
+	}
+	api.reloadMux.Lock()
+	defer api.reloadMux.Unlock()
+
+	reloaded := *cfg
+	if previous := api.config; nil != previous {
+		if previous.Port != cfg.Port {
+			log.Printf("config: port change from %s to %s requires a restart", previous.Port, cfg.Port)
+			reloaded.Port = previous.Port
+		}
+		if !reflect.DeepEqual(previous.Static, cfg.Static) {
+			log.Printf("config: static changes require a restart")
+			reloaded.Static = previous.Static
+		}
+		if previous.Limits.serverOnly() != cfg.Limits.serverOnly() {
+			log.Printf("config: server wide limit changes require a restart")
+			reloaded.Limits.MaxHeaderBytes = previous.Limits.MaxHeaderBytes
+			reloaded.Limits.ReadHeaderTimeout = previous.Limits.ReadHeaderTimeout
+			reloaded.Limits.IdleTimeout = previous.Limits.IdleTimeout
+			reloaded.Limits.WriteTimeout = previous.Limits.WriteTimeout
+		}
+	}
+	api.Limits = reloaded.Limits.limits()
+	api.config = &reloaded
+	api.BuildHandler()
+	log.Printf("config: reloaded")
+	return nil
+}
+
+/*
+checkConfig validates a configuration against the Api
+*/
+func (api *Api) checkConfig(cfg *Config) error {
+	err := cfg.Validate()
+	errs := make([]string, 0)
+	if nil != err {
+		errs = append(errs, err.(*ConfigError).Errors...)
+	}
+	for endpoint := range cfg.Routes {
+		if _, ok := api.Controllers[endpoint]; !ok && strings.HasPrefix(endpoint, "/") {
+			errs = append(errs, fmt.Sprintf("routes.%s: no controller for endpoint", endpoint))
+		}
+	}
+	if 0 != len(errs) {
+		return &ConfigError{Errors: errs}
+	}
+	return nil
+}
+
+/*
+WatchConfig reloads the configuration when the process receives SIGHUP or,
+if interval is set, when the configuration file changes. Invalid
+configurations are logged and the current configuration is kept. It blocks
+until ctx is done
+*/
+func (api *Api) WatchConfig(ctx context.Context, loader *ConfigLoader, interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	var tick <-chan time.Time
+	if interval > 0 && "" != loader.File {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	reload := func() {
+		cfg, err := loader.Load()
+		if nil == err {
+			err = api.Reload(cfg)
+		}
+		if nil != err {
+			log.Printf("config: reload failed: %v", err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			reload()
+		case <-tick:
+			if !configModTime(loader.File).Equal(loader.modified) {
+				reload()
+			}
+		}
+	}
+}
+
+func configModTime(file string) time.Time {
+	if "" == file {
+		return time.Time{}
+	}
+	info, err := os.Stat(file)
+	if nil != err {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,208 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mkenney/go/cli"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0600); nil != err {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestConfigSources(t *testing.T) {
+	file := writeConfig(t, "api.yaml", `
+port: ":9000"
+limits:
+  max_body_bytes: 1024
+  body_read_timeout: 5s
+rate_limit:
+  requests_per_second: 10
+`)
+	t.Setenv("TEST_PORT", ":9100")
+	t.Setenv("TEST_CORS_ALLOWED_ORIGINS", "https://a.example, https://b.example")
+	cmd := &cli.Cmd{Flags: map[string]*cli.Flag{
+		"limits-max-body-bytes": {Name: "limits-max-body-bytes", Called: true, Value: "2048"},
+		"port":                  {Name: "port"},
+	}}
+
+	cfg, err := (&ConfigLoader{File: file, EnvPrefix: "TEST", Cmd: cmd}).Load()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if ":9100" != cfg.Port {
+		t.Errorf("expected the environment to override the file, %s found", cfg.Port)
+	}
+	if 2048 != cfg.Limits.MaxBodyBytes {
+		t.Errorf("expected flags to override the file, %d found", cfg.Limits.MaxBodyBytes)
+	}
+	if 5*time.Second != cfg.Limits.BodyReadTimeout.Duration() {
+		t.Errorf("expected 5s, %v found", cfg.Limits.BodyReadTimeout)
+	}
+	if 10*time.Second != cfg.Limits.ReadHeaderTimeout.Duration() {
+		t.Errorf("expected defaults to be kept, %v found", cfg.Limits.ReadHeaderTimeout)
+	}
+	if expect := []string{"https://a.example", "https://b.example"}; nil == cfg.CORS || !reflect.DeepEqual(expect, cfg.CORS.AllowedOrigins) {
+		t.Errorf("expected %v, %v found", expect, cfg.CORS)
+	}
+	if nil == cfg.RateLimit || 10 != cfg.RateLimit.RequestsPerSecond {
+		t.Errorf("expected a rate limit of 10, %v found", cfg.RateLimit)
+	}
+}
+
+func TestConfigFlags(t *testing.T) {
+	names := make(map[string]interface{})
+	for _, flag := range DefaultConfig().Flags() {
+		names[flag.Name] = flag.Default
+	}
+	if _, ok := names["cors-allowed-origins"]; !ok {
+		t.Errorf("expected a --cors-allowed-origins flag")
+	}
+	if false != names["cors-allow-credentials"] {
+		t.Errorf("expected --cors-allow-credentials to be a bool flag")
+	}
+	if _, ok := names["routes"]; ok {
+		t.Errorf("expected no flag for routes")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	file := writeConfig(t, "api.json", `{
+		"port": "9000",
+		"limits": {"max_body_bytes": -1},
+		"rate_limit": {"requests_per_second": 0},
+		"static": [{"prefix": "assets/", "dir": "/does/not/exist"}]
+	}`)
+	_, err := (&ConfigLoader{File: file}).Load()
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("expected a ConfigError, %v found", err)
+	}
+	expect := []string{
+		"port: invalid address '9000'",
+		"limits.max_body_bytes: must not be negative",
+		"rate_limit.requests_per_second: must be greater than 0",
+		"static[0].prefix: must start with '/'",
+		"static[0].dir: '/does/not/exist' is not a directory",
+	}
+	if !reflect.DeepEqual(expect, cfgErr.Errors) {
+		t.Errorf("expected %v, %v found", expect, cfgErr.Errors)
+	}
+
+	file = writeConfig(t, "api.json", `{"prot": ":9000"}`)
+	if _, err := (&ConfigLoader{File: file}).Load(); nil == err {
+		t.Errorf("expected unknown settings to be rejected")
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	api := NewServer()
+	for _, endpoint := range []string{"/a", "/b"} {
+		api.AddHandler(endpoint, func(request *http.Request, response *Response) {
+			response.Channel <- "ok"
+			response.Channel <- response.Done()
+		})
+	}
+	if err := api.ApplyConfig(DefaultConfig()); nil != err {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var reused []bool
+	get := func(path string) *http.Response {
+		request, _ := http.NewRequest("GET", server.URL+path, nil)
+		request.Header.Set("Origin", "https://example.com")
+		request = request.WithContext(httptrace.WithClientTrace(request.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { reused = append(reused, info.Reused) },
+		}))
+		response, err := server.Client().Do(request)
+		if nil != err {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		return response
+	}
+
+	if response := get("/b"); http.StatusOK != response.StatusCode || "" != response.Header.Get("Access-Control-Allow-Origin") {
+		t.Fatalf("expected 200 without CORS headers, %d found", response.StatusCode)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Port = ":9999"
+	cfg.CORS = &CORSConfig{AllowedOrigins: []string{"*"}}
+	cfg.Routes = map[string]*RouteConfig{"/b": {Disabled: true}}
+	if err := api.Reload(cfg); nil != err {
+		t.Fatal(err)
+	}
+
+	if response := get("/a"); "*" != response.Header.Get("Access-Control-Allow-Origin") {
+		t.Errorf("expected CORS headers after reload")
+	}
+	if response := get("/b"); http.StatusNotFound != response.StatusCode {
+		t.Errorf("expected a disabled route to return 404, %d found", response.StatusCode)
+	}
+	if expect := []bool{false, true, true}; !reflect.DeepEqual(expect, reused) {
+		t.Errorf("expected the connection to be reused, %v found", reused)
+	}
+	if ":8080" != api.config.Port {
+		t.Errorf("expected the port change to be ignored, %s found", api.config.Port)
+	}
+
+	cfg.Routes = map[string]*RouteConfig{"/c": {}}
+	if err := api.Reload(cfg); nil == err {
+		t.Errorf("expected a route without a controller to be rejected")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	file := writeConfig(t, "api.json", `{}`)
+	api := NewServer()
+	api.AddHandler("/a", func(request *http.Request, response *Response) {
+		response.Channel <- response.Done()
+	})
+	loader := &ConfigLoader{File: file}
+	cfg, err := loader.Load()
+	if nil != err {
+		t.Fatal(err)
+	}
+	api.ApplyConfig(cfg)
+	api.BuildHandler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go api.WatchConfig(ctx, loader, 10*time.Millisecond)
+
+	os.WriteFile(file, []byte(`{"routes": {"/a": {"disabled": true}}}`), 0600)
+	modified := time.Now().Add(time.Second)
+	os.Chtimes(file, modified, modified)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest("GET", "/a", nil))
+		if http.StatusNotFound == recorder.Code {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expected the configuration to be reloaded")
+}
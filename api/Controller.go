@@ -4,10 +4,12 @@ Package api provides a simple rest HTTP server
 package api
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+
+	model "github.com/mkenney/go/model.old"
 )
 
 /*
@@ -16,6 +18,26 @@ Controller stores handlers for each endpoint
 type Controller struct {
 	Endpoint string
 	Handlers []func(*http.Request, *Response)
+
+	/*
+		Optional, overrides the Api request size and read time limits
+	*/
+	Limits *Limits
+
+	/*
+		Optional, metadata for each method keyed by method name
+	*/
+	Operations map[string]*Operation
+
+	/*
+		Optional, parse multipart/form-data request bodies
+	*/
+	Uploads *UploadConfig
+
+	/*
+		Named handlers with dependencies, see AddDependentHandler
+	*/
+	nodes []*handlerNode
 }
 
 /*
@@ -45,24 +67,74 @@ HandlerFunc returns a wrapper function that will execute all handlers in the
 stack concurrently and write the results to the http response
 */
 func (ctrl *Controller) HandlerFunc() func(http.ResponseWriter, *http.Request) {
+	return ctrl.handlerFunc(nil)
+}
+
+/*
+handlerFunc returns the HandlerFunc wrapper, enforcing the controller limits
+with any unset values taken from the server defaults
+*/
+func (ctrl *Controller) handlerFunc(defaults *Limits) func(http.ResponseWriter, *http.Request) {
+	limits := ctrl.Limits.merge(defaults)
 	return func(writer http.ResponseWriter, request *http.Request) {
 		log.Print(fmt.Sprintf("Processing request %s:%s\n", request.Method, request.RequestURI))
 
+		body, ok := limitRequest(writer, request, limits)
+		if !ok {
+			return
+		}
+
+		// Parse uploads once so every handler can read them
+		if nil != ctrl.Uploads && isMultipart(request) {
+			var upload *Upload
+			var err error
+			request, upload, err = ctrl.Uploads.withUpload(request)
+			if nil != err {
+				status, _ := body.status()
+				var statusErr *StatusError
+				if 0 == status && errors.As(err, &statusErr) {
+					status = statusErr.Status
+				}
+				writer.Header().Set("Connection", "close")
+				writeError(writer, status, err)
+				return
+			}
+			defer upload.cleanup()
+		}
+
+		// Buffer the body so every handler can read it independently
+		nextRequest, cleanup, err := shareRequest(request, limits.BodyMemoryBytes)
+		if nil != err {
+			status, _ := body.status()
+			if 0 == status {
+				status = http.StatusBadRequest
+			}
+			writer.Header().Set("Connection", "close")
+			writeError(writer, status, err)
+			return
+		}
+		defer cleanup()
+
 		// Fan-out all the routines
 		response := NewResponse()
 		for _, handler := range ctrl.Handlers {
-			go handler(request, response)
+			go handler(nextRequest(), response)
 		}
-		log.Print(fmt.Sprintf("Started %v routine(s)\n", len(ctrl.Handlers)))
+		graph := ctrl.runGraph(nextRequest, response)
+		routines := len(ctrl.Handlers) + len(ctrl.nodes)
+		log.Print(fmt.Sprintf("Started %v routine(s)\n", routines))
 
 		// Fan-in all the responses
 		var responses []interface{}
 		var a int
+		if 0 == routines {
+			close(response.Channel)
+		}
 		for resp := range response.Channel {
 			_, ok := resp.(handlerComplete)
 			if ok {
 				a++
-				if a >= len(ctrl.Handlers) {
+				if a >= routines {
 					break
 				}
 			} else {
@@ -70,14 +142,31 @@ func (ctrl *Controller) HandlerFunc() func(http.ResponseWriter, *http.Request) {
 			}
 		}
 		log.Print(fmt.Sprintf("Collected %v response(s)\n", len(responses)))
+		graph.apply(response)
 
-		// Convert responses to JSON and return
+		// A body that was too large or too slow overrides the handler output
+		// and the connection can't be reused, the rest of the body is unread
+		if status, err := body.status(); 0 != status {
+			response.SetStatusCode(status).AddError(err).AddHeader("Connection", "close")
+		} else {
+			body.clearDeadline()
+		}
+
+		// Apply any requested sparse fieldset, an error response is written
+		// as it is
 		response.Body = responses
-		output, err := json.Marshal(response.Body)
+		if response.StatusCode() < http.StatusBadRequest {
+			view, err := model.ParseView(request.URL.Query().Get("fields"), request.URL.Query().Get("exclude"))
+			if nil == err {
+				response.Body, err = view.Apply(response.Body)
+			}
+			if nil != err {
+				response.SetStatusCode(http.StatusBadRequest).AddError(err)
+			}
+		}
 
-		if err == nil {
-			writer.Header().Set("Content-Type", "application/json")
-			writer.Write(output)
+		// Convert responses to JSON and return
+		if err := response.Write(writer); nil == err {
 			log.Print(fmt.Sprintf("Output returned to client\n"))
 		}
 	}
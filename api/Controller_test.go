@@ -0,0 +1,97 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testController() *Controller {
+	ctrl := NewController("/")
+	ctrl.AddHandler(func(request *http.Request, response *Response) {
+		response.Channel <- map[string]interface{}{
+			"a": 1,
+			"b": map[string]interface{}{"c": 2, "d": 3},
+		}
+		response.Channel <- response.Done()
+	})
+	return ctrl
+}
+
+/*
+serve sends a request to handler and returns the response. A Content-Length
+header sets the request's ContentLength, -1 for a body of unknown length
+*/
+func serve(handler http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if "" != body {
+		reader = strings.NewReader(body)
+	}
+	request := httptest.NewRequest(method, target, reader)
+	for key, value := range header {
+		request.Header.Set(key, value)
+	}
+	if length, ok := header["Content-Length"]; ok {
+		request.ContentLength, _ = strconv.ParseInt(length, 10, 64)
+		request.Header.Del("Content-Length")
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestControllerFields(t *testing.T) {
+	recorder := serve(http.HandlerFunc(testController().HandlerFunc()), "GET", "/?fields=b.c", "", nil)
+	if http.StatusOK != recorder.Code {
+		t.Fatalf("expected status %d, %d found", http.StatusOK, recorder.Code)
+	}
+	if expect := `[{"b":{"c":2}}]`; expect != recorder.Body.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+}
+
+func TestControllerExclude(t *testing.T) {
+	recorder := serve(http.HandlerFunc(testController().HandlerFunc()), "GET", "/?exclude=a,b.d", "", nil)
+	if expect := `[{"b":{"c":2}}]`; expect != recorder.Body.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+}
+
+func TestControllerUnknownField(t *testing.T) {
+	recorder := serve(http.HandlerFunc(testController().HandlerFunc()), "GET", "/?fields=a,z", "", nil)
+	if http.StatusBadRequest != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestControllerFieldsEmpty(t *testing.T) {
+	ctrl := NewController("/")
+	ctrl.AddHandler(func(request *http.Request, response *Response) {
+		response.Channel <- response.Done()
+	})
+	expect := serve(http.HandlerFunc(ctrl.HandlerFunc()), "GET", "/", "", nil).Body.String()
+	recorder := serve(http.HandlerFunc(ctrl.HandlerFunc()), "GET", "/?fields=id", "", nil)
+	if http.StatusOK != recorder.Code || expect != recorder.Body.String() {
+		t.Errorf("expected status %d and %s, %d and %s found", http.StatusOK, expect, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestControllerFieldsError(t *testing.T) {
+	ctrl := NewController("/")
+	ctrl.AddHandler(func(request *http.Request, response *Response) {
+		response.SetStatusCode(http.StatusNotFound).AddError(errors.New("no such thing"))
+		response.Channel <- map[string]interface{}{"a": 1}
+		response.Channel <- response.Done()
+	})
+	recorder := serve(http.HandlerFunc(ctrl.HandlerFunc()), "GET", "/?fields=z", "", nil)
+	if http.StatusNotFound != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusNotFound, recorder.Code)
+	}
+}
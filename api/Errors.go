@@ -0,0 +1,70 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import "errors"
+
+/*
+ErrControllerNotFound - used when a controller is not defined for an endpoint
+*/
+var ErrControllerNotFound = errors.New("Controller not found")
+
+/*
+errIdempotencyKeyReused - used when an idempotency key is reused with a
+different request
+*/
+var errIdempotencyKeyReused = errors.New("idempotency key has already been used for a different request")
+
+/*
+ErrInvalidCursor - used when a pagination cursor is malformed or its signature
+does not match
+*/
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+/*
+ErrEmptySecret - used when a Paginator is created without a secret to sign
+cursors with
+*/
+var ErrEmptySecret = errors.New("a secret is required to sign cursors")
+
+/*
+ErrCircuitOpen - used when a circuit breaker rejects a call
+*/
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+/*
+ErrHandlerExists - used when a named handler is added to a controller twice
+*/
+var ErrHandlerExists = errors.New("handler already exists")
+
+/*
+ErrHandlerCycle - used when handler dependencies would form a cycle
+*/
+var ErrHandlerCycle = errors.New("handler dependency cycle")
+
+/*
+ErrSubscriptionNotFound - used when a webhook subscription doesn't exist
+*/
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+/*
+ErrDeliveryNotFound - used when a webhook delivery doesn't exist
+*/
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+/*
+ErrWebhookURLDenied - used when a webhook URL isn't allowed by the URLPolicy
+*/
+var ErrWebhookURLDenied = errors.New("webhook url not allowed")
+
+/*
+ErrUnauthorized - used when a request to a protected endpoint isn't
+authorized
+*/
+var ErrUnauthorized = errors.New("unauthorized")
+
+/*
+ErrInvalidSignature - used when a webhook signature doesn't match the payload
+*/
+var ErrInvalidSignature = errors.New("invalid webhook signature")
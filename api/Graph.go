@@ -0,0 +1,171 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*
+DependentHandler is a named handler that runs once the handlers it depends on
+have completed. results holds the value returned by each dependency, keyed by
+name. A non-nil return value is added to the response body and passed to any
+handlers that depend on this one. If an error is returned, handlers that depend
+on this one are skipped
+*/
+type DependentHandler func(request *http.Request, response *Response, results map[string]interface{}) (interface{}, error)
+
+/*
+handlerNode is a named handler and the names of the handlers it depends on
+*/
+type handlerNode struct {
+	name      string
+	handler   DependentHandler
+	dependsOn []string
+}
+
+/*
+AddDependentHandler adds a named handler that runs after the handlers named in
+dependsOn. Dependencies may be added later, but a dependency that would form a
+cycle is rejected. Named handlers run alongside the handlers added with
+AddHandler, each one starting as soon as all of its dependencies complete
+*/
+func (ctrl *Controller) AddDependentHandler(name string, handler DependentHandler, dependsOn ...string) error {
+	for _, node := range ctrl.nodes {
+		if name == node.name {
+			return fmt.Errorf("%w: '%s'", ErrHandlerExists, name)
+		}
+	}
+	for _, dep := range dependsOn {
+		if path := ctrl.dependencyPath(dep, name, []string{name}); nil != path {
+			return fmt.Errorf("%w: %s", ErrHandlerCycle, strings.Join(path, " -> "))
+		}
+	}
+	ctrl.nodes = append(ctrl.nodes, &handlerNode{
+		name:      name,
+		handler:   handler,
+		dependsOn: dependsOn,
+	})
+	return nil
+}
+
+/*
+dependencyPath returns the chain of dependencies leading from a handler to
+target, or nil if target can't be reached
+*/
+func (ctrl *Controller) dependencyPath(from, target string, path []string) []string {
+	path = append(path, from)
+	if from == target {
+		return path
+	}
+	for _, node := range ctrl.nodes {
+		if from != node.name {
+			continue
+		}
+		for _, dep := range node.dependsOn {
+			if found := ctrl.dependencyPath(dep, target, path); nil != found {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+/*
+graphRun tracks the named handlers executing for a single request
+*/
+type graphRun struct {
+	mux    sync.Mutex
+	errs   []error
+	status int
+}
+
+/*
+fail records a handler error, the first error sets the response status
+*/
+func (run *graphRun) fail(status int, err error) {
+	run.mux.Lock()
+	defer run.mux.Unlock()
+	if 0 == run.status {
+		run.status = status
+	}
+	run.errs = append(run.errs, err)
+}
+
+/*
+apply adds any handler errors to the response
+*/
+func (run *graphRun) apply(response *Response) {
+	if 0 == run.status {
+		return
+	}
+	response.SetStatusCode(run.status)
+	for _, err := range run.errs {
+		response.AddError(err)
+	}
+}
+
+/*
+runGraph starts every named handler. Each handler waits for its dependencies,
+then writes its result to the response channel followed by a completion
+signal, the same as any other handler
+*/
+func (ctrl *Controller) runGraph(nextRequest func() *http.Request, response *Response) *graphRun {
+	run := &graphRun{}
+	type result struct {
+		done  chan struct{}
+		value interface{}
+		ok    bool
+	}
+	results := make(map[string]*result, len(ctrl.nodes))
+	for _, node := range ctrl.nodes {
+		results[node.name] = &result{done: make(chan struct{})}
+	}
+
+	for _, node := range ctrl.nodes {
+		go func(node *handlerNode, request *http.Request) {
+			self := results[node.name]
+			defer func() {
+				close(self.done)
+				response.Channel <- response.Done()
+			}()
+
+			upstream := make(map[string]interface{}, len(node.dependsOn))
+			for _, dep := range node.dependsOn {
+				res, ok := results[dep]
+				if !ok {
+					run.fail(http.StatusInternalServerError, fmt.Errorf("handler '%s' depends on unknown handler '%s'", node.name, dep))
+					return
+				}
+				<-res.done
+				if !res.ok {
+					run.fail(http.StatusFailedDependency, fmt.Errorf("handler '%s' skipped, dependency '%s' failed", node.name, dep))
+					return
+				}
+				upstream[dep] = res.value
+			}
+
+			value, err := node.handler(request, response, upstream)
+			if nil != err {
+				status := http.StatusInternalServerError
+				var statusErr *StatusError
+				if errors.As(err, &statusErr) {
+					status = statusErr.Status
+				}
+				run.fail(status, err)
+				return
+			}
+			self.value = value
+			self.ok = true
+			if nil != value {
+				response.Channel <- value
+			}
+		}(node, nextRequest())
+	}
+	return run
+}
@@ -0,0 +1,120 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGraphPassesResults(t *testing.T) {
+	ctrl := NewController("/")
+	err := ctrl.AddDependentHandler("orders", func(request *http.Request, response *Response, results map[string]interface{}) (interface{}, error) {
+		return fmt.Sprintf("orders for %v", results["user"]), nil
+	}, "user")
+	if nil != err {
+		t.Fatal(err)
+	}
+	err = ctrl.AddDependentHandler("user", func(request *http.Request, response *Response, results map[string]interface{}) (interface{}, error) {
+		return request.URL.Query().Get("id"), nil
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	recorder := serve(http.HandlerFunc(ctrl.HandlerFunc()), "GET", "/?id=7", "", nil)
+	if expect := `["7","orders for 7"]`; expect != recorder.Body.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+}
+
+func TestGraphRunsIndependentHandlersInParallel(t *testing.T) {
+	var running, peak int32
+	slow := func(request *http.Request, response *Response, results map[string]interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil, nil
+	}
+
+	ctrl := NewController("/")
+	ctrl.AddDependentHandler("a", slow)
+	ctrl.AddDependentHandler("b", slow)
+	ctrl.AddDependentHandler("c", slow, "a", "b")
+	ctrl.AddHandler(func(request *http.Request, response *Response) {
+		response.Channel <- "flat"
+		response.Channel <- response.Done()
+	})
+
+	recorder := serve(http.HandlerFunc(ctrl.HandlerFunc()), "GET", "/", "", nil)
+	if expect := `["flat"]`; expect != recorder.Body.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+	if 2 != atomic.LoadInt32(&peak) {
+		t.Errorf("expected 2 handlers to run in parallel, %d found", peak)
+	}
+}
+
+func TestGraphRejectsCycles(t *testing.T) {
+	noop := func(request *http.Request, response *Response, results map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	ctrl := NewController("/")
+	if err := ctrl.AddDependentHandler("a", noop, "b"); nil != err {
+		t.Fatal(err)
+	}
+	if err := ctrl.AddDependentHandler("b", noop, "c"); nil != err {
+		t.Fatal(err)
+	}
+
+	err := ctrl.AddDependentHandler("c", noop, "a")
+	if !errors.Is(err, ErrHandlerCycle) {
+		t.Fatalf("expected a cycle error, %v found", err)
+	}
+	if expect := "handler dependency cycle: c -> a -> b -> c"; expect != err.Error() {
+		t.Errorf("expected '%s', '%s' found", expect, err.Error())
+	}
+	if err := ctrl.AddDependentHandler("d", noop, "d"); !errors.Is(err, ErrHandlerCycle) {
+		t.Errorf("expected a self dependency to be rejected, %v found", err)
+	}
+	if err := ctrl.AddDependentHandler("a", noop); !errors.Is(err, ErrHandlerExists) {
+		t.Errorf("expected a duplicate handler to be rejected, %v found", err)
+	}
+}
+
+func TestGraphSkipsDependentsOnError(t *testing.T) {
+	var called int32
+	ctrl := NewController("/")
+	ctrl.AddDependentHandler("user", func(request *http.Request, response *Response, results map[string]interface{}) (interface{}, error) {
+		return nil, &StatusError{Status: http.StatusNotFound, Err: errors.New("user not found")}
+	})
+	ctrl.AddDependentHandler("orders", func(request *http.Request, response *Response, results map[string]interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		return nil, nil
+	}, "user")
+
+	recorder := httptest.NewRecorder()
+	ctrl.HandlerFunc()(recorder, httptest.NewRequest("GET", "/", nil))
+	if http.StatusNotFound != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusNotFound, recorder.Code)
+	}
+	if 0 != atomic.LoadInt32(&called) {
+		t.Errorf("expected the dependent handler to be skipped")
+	}
+	expect := `{"errors":["user not found","handler 'orders' skipped, dependency 'user' failed"],"status":"Not Found"}`
+	if expect != recorder.Body.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+/*
+HealthEndpoint is the route for liveness checks
+*/
+const HealthEndpoint = "/healthz"
+
+/*
+ReadyEndpoint is the route for readiness checks
+*/
+const ReadyEndpoint = "/readyz"
+
+/*
+VersionEndpoint is the route for build information
+*/
+const VersionEndpoint = "/version"
+
+/*
+DefaultCheckTimeout is used for checks registered without a timeout
+*/
+const DefaultCheckTimeout = 5 * time.Second
+
+/*
+CheckFunc reports the state of a dependency, returning nil if it is healthy.
+The context is cancelled when the check times out
+*/
+type CheckFunc func(ctx context.Context) error
+
+/*
+Check is a named health or readiness check
+*/
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Check   CheckFunc
+}
+
+/*
+CheckResult is the outcome of a single check
+*/
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+/*
+CheckReport is the aggregated outcome of a set of checks
+*/
+type CheckReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+/*
+BuildInfo describes the running binary
+*/
+type BuildInfo struct {
+	Path      string            `json:"path"`
+	Version   string            `json:"version"`
+	GoVersion string            `json:"go_version"`
+	VCS       map[string]string `json:"vcs,omitempty"`
+}
+
+/*
+AddHealthCheck registers a liveness check, reported by /healthz and /readyz
+*/
+func (api *Api) AddHealthCheck(name string, timeout time.Duration, check CheckFunc) *Api {
+	api.HealthChecks = append(api.HealthChecks, &Check{Name: name, Timeout: timeout, Check: check})
+	return api
+}
+
+/*
+AddReadinessCheck registers a readiness check, reported by /readyz
+*/
+func (api *Api) AddReadinessCheck(name string, timeout time.Duration, check CheckFunc) *Api {
+	api.ReadinessChecks = append(api.ReadinessChecks, &Check{Name: name, Timeout: timeout, Check: check})
+	return api
+}
+
+/*
+RunChecks executes all checks concurrently, each bounded by its timeout, and
+returns the aggregated report
+*/
+func RunChecks(ctx context.Context, checks []*Check) CheckReport {
+	type result struct {
+		name   string
+		result CheckResult
+	}
+
+	// Fan-out all the checks
+	results := make(chan result)
+	for _, check := range checks {
+		go func(check *Check) {
+			timeout := check.Timeout
+			if timeout <= 0 {
+				timeout = DefaultCheckTimeout
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			errs := make(chan error, 1)
+			go func() {
+				errs <- check.Check(checkCtx)
+			}()
+
+			var err error
+			select {
+			case err = <-errs:
+			case <-checkCtx.Done():
+				err = checkCtx.Err()
+			}
+
+			res := CheckResult{Status: "ok", Duration: time.Since(start).String()}
+			if nil != err {
+				res.Status = "fail"
+				res.Error = err.Error()
+			}
+			results <- result{name: check.Name, result: res}
+		}(check)
+	}
+
+	// Fan-in all the results
+	report := CheckReport{Status: "ok", Checks: make(map[string]CheckResult)}
+	for range checks {
+		res := <-results
+		report.Checks[res.name] = res.result
+		if "ok" != res.result.Status {
+			report.Status = "fail"
+		}
+	}
+	return report
+}
+
+/*
+ReadBuildInfo returns the module version and VCS information embedded in the
+running binary
+*/
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{Version: "unknown"}
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Path = buildInfo.Main.Path
+	if "" != buildInfo.Main.Version {
+		info.Version = buildInfo.Main.Version
+	}
+	info.GoVersion = buildInfo.GoVersion
+	info.VCS = make(map[string]string)
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs", "vcs.revision", "vcs.time", "vcs.modified":
+			info.VCS[setting.Key] = setting.Value
+		}
+	}
+	return info
+}
+
+func checksHandlerFunc(checks func() []*Check) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		report := RunChecks(request.Context(), checks())
+		response := NewResponse()
+		response.Body = report
+		if "ok" != report.Status {
+			response.SetStatusCode(http.StatusServiceUnavailable)
+		}
+		response.Write(writer)
+	}
+}
+
+func versionHandlerFunc(writer http.ResponseWriter, request *http.Request) {
+	response := NewResponse()
+	response.Body = ReadBuildInfo()
+	response.Write(writer)
+}
+
+/*
+handleStatusEndpoints adds the health, readiness and version routes to a mux,
+unless a controller has already claimed the endpoint
+*/
+func (api *Api) handleStatusEndpoints(mux *http.ServeMux) {
+	routes := map[string]func(http.ResponseWriter, *http.Request){
+		HealthEndpoint: checksHandlerFunc(func() []*Check {
+			return api.HealthChecks
+		}),
+		ReadyEndpoint: checksHandlerFunc(func() []*Check {
+			return append(append([]*Check{}, api.HealthChecks...), api.ReadinessChecks...)
+		}),
+		VersionEndpoint: versionHandlerFunc,
+	}
+
+	for endpoint, route := range routes {
+		if _, ok := api.Controllers[endpoint]; !ok {
+			mux.HandleFunc(endpoint, route)
+		}
+	}
+}
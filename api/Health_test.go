@@ -0,0 +1,77 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func checkReport(t *testing.T, handler http.Handler, endpoint string) (int, CheckReport) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", endpoint, nil))
+	var report CheckReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); nil != err {
+		t.Fatalf("%s: %s", err, recorder.Body.String())
+	}
+	return recorder.Code, report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	server := NewServer()
+	server.AddHealthCheck("db", time.Second, func(ctx context.Context) error {
+		return nil
+	})
+	server.AddReadinessCheck("cache", time.Second, func(ctx context.Context) error {
+		return errors.New("cache unavailable")
+	})
+	handler := server.BuildHandler()
+
+	code, report := checkReport(t, handler, HealthEndpoint)
+	if http.StatusOK != code || "ok" != report.Status || 1 != len(report.Checks) {
+		t.Errorf("expected healthy report, %d %v found", code, report)
+	}
+
+	code, report = checkReport(t, handler, ReadyEndpoint)
+	if http.StatusServiceUnavailable != code || "fail" != report.Status {
+		t.Errorf("expected failed report, %d %v found", code, report)
+	}
+	if "cache unavailable" != report.Checks["cache"].Error {
+		t.Errorf("expected cache error, %v found", report.Checks["cache"])
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	checks := []*Check{{
+		Name:    "slow",
+		Timeout: 10 * time.Millisecond,
+		Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Second)
+			return nil
+		},
+	}}
+	start := time.Now()
+	report := RunChecks(context.Background(), checks)
+	if "fail" != report.Status || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected timed out check, %v found", report)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	NewServer().BuildHandler().ServeHTTP(recorder, httptest.NewRequest("GET", VersionEndpoint, nil))
+	var info BuildInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); nil != err {
+		t.Fatalf("%s", err)
+	}
+	if "" == info.GoVersion {
+		t.Errorf("expected a go version, %v found", info)
+	}
+}
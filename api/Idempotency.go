@@ -0,0 +1,271 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+IdempotencyHeader is the request header used to identify retried requests
+*/
+const IdempotencyHeader = "Idempotency-Key"
+
+/*
+IdempotencyReplayedHeader is set on responses that were replayed from the
+store
+*/
+const IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+/*
+IdempotencyScope returns the client or principal a request was made by.
+Idempotency keys are only shared between requests in the same scope, so one
+client can't replay another client's response
+*/
+type IdempotencyScope func(request *http.Request) string
+
+/*
+ClientScope scopes idempotency keys to the request credentials, the
+Authorization header, or to the client address if there are none
+*/
+func ClientScope(request *http.Request) string {
+	if auth := request.Header.Get("Authorization"); "" != auth {
+		return "auth " + auth
+	}
+	client, _, err := net.SplitHostPort(request.RemoteAddr)
+	if nil != err {
+		client = request.RemoteAddr
+	}
+	return "addr " + client
+}
+
+/*
+IdempotentResponse is a stored response for an idempotency key
+*/
+type IdempotentResponse struct {
+	/*
+		Hash of the request method, path and body used to detect conflicting
+		requests reusing a key
+	*/
+	Fingerprint string
+
+	/*
+		The response status code
+	*/
+	StatusCode int
+
+	/*
+		The response headers
+	*/
+	Headers http.Header
+
+	/*
+		The response body
+	*/
+	Body []byte
+}
+
+/*
+IdempotencyStore stores responses by idempotency key. Implementations must be
+safe for concurrent use
+*/
+type IdempotencyStore interface {
+	Get(key string) (*IdempotentResponse, bool)
+	Set(key string, response *IdempotentResponse, ttl time.Duration)
+}
+
+/*
+MemoryIdempotencyStore is an in-memory IdempotencyStore
+*/
+type MemoryIdempotencyStore struct {
+	mux     sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+}
+
+type memoryIdempotencyEntry struct {
+	response *IdempotentResponse
+	expires  time.Time
+}
+
+/*
+NewMemoryIdempotencyStore returns a pointer to a new MemoryIdempotencyStore
+*/
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	store := new(MemoryIdempotencyStore)
+	store.entries = make(map[string]memoryIdempotencyEntry)
+	return store
+}
+
+/*
+Get returns the unexpired response stored for a key
+*/
+func (store *MemoryIdempotencyStore) Get(key string) (*IdempotentResponse, bool) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	entry, ok := store.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(store.entries, key)
+		return nil, false
+	}
+	return entry.response, true
+}
+
+/*
+Set stores a response for a key until the ttl expires
+*/
+func (store *MemoryIdempotencyStore) Set(key string, response *IdempotentResponse, ttl time.Duration) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	now := time.Now()
+	for k, entry := range store.entries {
+		if now.After(entry.expires) {
+			delete(store.entries, k)
+		}
+	}
+	store.entries[key] = memoryIdempotencyEntry{response: response, expires: now.Add(ttl)}
+}
+
+/*
+keyLocks serializes concurrent requests sharing an idempotency key
+*/
+type keyLocks struct {
+	mux   sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+func (kl *keyLocks) lock(key string) {
+	kl.mux.Lock()
+	lock, ok := kl.locks[key]
+	if !ok {
+		lock = new(keyLock)
+		kl.locks[key] = lock
+	}
+	lock.refs++
+	kl.mux.Unlock()
+	lock.Lock()
+}
+
+func (kl *keyLocks) unlock(key string) {
+	kl.mux.Lock()
+	lock := kl.locks[key]
+	lock.refs--
+	if 0 == lock.refs {
+		delete(kl.locks, key)
+	}
+	kl.mux.Unlock()
+	lock.Unlock()
+}
+
+/*
+Idempotency returns middleware that honors the Idempotency-Key header on
+unsafe methods. The first complete response for a key is stored and replayed
+for any repeated request, server errors aren't stored so the request can be
+retried. Reusing a key with a different request returns 422 Unprocessable
+Entity and concurrent duplicates wait for the first to finish. Keys are scoped
+with ClientScope and the request body is read within the route's MaxBodyBytes
+and BodyReadTimeout limits.
+*/
+func Idempotency(store IdempotencyStore, ttl time.Duration) Middleware {
+	return ScopedIdempotency(store, ttl, ClientScope)
+}
+
+/*
+ScopedIdempotency returns Idempotency middleware that scopes keys to the
+principal returned by scope
+*/
+func ScopedIdempotency(store IdempotencyStore, ttl time.Duration, scope IdempotencyScope) Middleware {
+	locks := &keyLocks{locks: make(map[string]*keyLock)}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			key := request.Header.Get(IdempotencyHeader)
+			if "" == key || !isUnsafeMethod(request.Method) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			body, err := readBody(writer, request)
+			if nil != err {
+				writer.Header().Set("Connection", "close")
+				writeError(writer, bodyErrorStatus(err), err)
+				return
+			}
+			fingerprint := requestFingerprint(request, body)
+			key = scopedKey(scope(request), key)
+
+			locks.lock(key)
+			defer locks.unlock(key)
+
+			if stored, ok := store.Get(key); ok {
+				if stored.Fingerprint != fingerprint {
+					writeError(writer, http.StatusUnprocessableEntity, errIdempotencyKeyReused)
+					return
+				}
+				replayResponse(writer, stored)
+				return
+			}
+
+			recorder := newResponseRecorder(writer)
+			next.ServeHTTP(recorder, request)
+
+			// Server errors may be temporary, the key is left free so the
+			// client can retry
+			if recorder.statusCode >= http.StatusInternalServerError {
+				return
+			}
+			store.Set(key, &IdempotentResponse{
+				Fingerprint: fingerprint,
+				StatusCode:  recorder.statusCode,
+				Headers:     recorder.Header().Clone(),
+				Body:        recorder.body.Bytes(),
+			}, ttl)
+		})
+	}
+}
+
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+/*
+scopedKey prefixes a key with a hash of its scope, credentials aren't kept in
+the store
+*/
+func scopedKey(scope, key string) string {
+	hash := sha256.Sum256([]byte(scope))
+	return hex.EncodeToString(hash[:]) + ":" + key
+}
+
+func requestFingerprint(request *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, request.Method+"\n"+request.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replayResponse(writer http.ResponseWriter, stored *IdempotentResponse) {
+	for header, values := range stored.Headers {
+		writer.Header()[header] = append([]string(nil), values...)
+	}
+	writer.Header().Set(IdempotencyReplayedHeader, "true")
+	writer.WriteHeader(stored.StatusCode)
+	writer.Write(stored.Body)
+}
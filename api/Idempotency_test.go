@@ -0,0 +1,145 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func idempotentServer(calls *int32) http.Handler {
+	server := NewServer()
+	server.Use(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		atomic.AddInt32(calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		response.Channel <- "created"
+		response.Channel <- response.Done()
+	})
+	return server.BuildHandler()
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	var calls int32
+	handler := idempotentServer(&calls)
+
+	first := serve(handler, "POST", "/", `{"a":1}`, map[string]string{IdempotencyHeader: "key-1"})
+	second := serve(handler, "POST", "/", `{"a":1}`, map[string]string{IdempotencyHeader: "key-1"})
+	if 1 != calls {
+		t.Errorf("expected 1 handler call, %d found", calls)
+	}
+	if first.Body.String() != second.Body.String() || first.Code != second.Code {
+		t.Errorf("expected replayed response %q, %q found", first.Body.String(), second.Body.String())
+	}
+	if "true" != second.Header().Get(IdempotencyReplayedHeader) {
+		t.Errorf("expected %s header on replayed response", IdempotencyReplayedHeader)
+	}
+}
+
+func TestIdempotencyConflict(t *testing.T) {
+	var calls int32
+	handler := idempotentServer(&calls)
+
+	serve(handler, "POST", "/", `{"a":1}`, map[string]string{IdempotencyHeader: "key-1"})
+	recorder := serve(handler, "POST", "/", `{"a":2}`, map[string]string{IdempotencyHeader: "key-1"})
+	if http.StatusUnprocessableEntity != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusUnprocessableEntity, recorder.Code)
+	}
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	var calls int32
+	handler := idempotentServer(&calls)
+
+	var wg sync.WaitGroup
+	for a := 0; a < 5; a++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(handler, "POST", "/", `{"a":1}`, map[string]string{IdempotencyHeader: "key-1"})
+		}()
+	}
+	wg.Wait()
+	if 1 != calls {
+		t.Errorf("expected 1 handler call, %d found", calls)
+	}
+}
+
+func TestIdempotencySafeMethod(t *testing.T) {
+	var calls int32
+	handler := idempotentServer(&calls)
+
+	for a := 0; a < 2; a++ {
+		serve(handler, "GET", "/", "", map[string]string{IdempotencyHeader: "key-1"})
+	}
+	if 2 != calls {
+		t.Errorf("expected 2 handler calls, %d found", calls)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	var calls int32
+	handler := idempotentServer(&calls)
+
+	for _, auth := range []string{"Bearer a", "Bearer b", "Bearer a"} {
+		serve(handler, "POST", "/", `{"a":1}`, map[string]string{IdempotencyHeader: "key-1", "Authorization": auth})
+	}
+	if 2 != calls {
+		t.Errorf("expected 2 handler calls, %d found", calls)
+	}
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	var calls int32
+	server := NewServer()
+	server.Limits.MaxBodyBytes = 8
+	server.Use(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		atomic.AddInt32(&calls, 1)
+		response.Channel <- response.Done()
+	})
+
+	recorder := serve(server.BuildHandler(), "POST", "/", "123456789", map[string]string{IdempotencyHeader: "key-1", "Content-Length": "-1"})
+	if http.StatusRequestEntityTooLarge != recorder.Code || 0 != calls {
+		t.Errorf("expected status %d without a handler call, %d and %d calls found", http.StatusRequestEntityTooLarge, recorder.Code, calls)
+	}
+}
+
+func TestIdempotencySlowBody(t *testing.T) {
+	server := NewServer()
+	server.Limits.BodyReadTimeout = 50 * time.Millisecond
+	server.Use(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		response.Channel <- response.Done()
+	})
+
+	response := slowRequest(t, server, "POST / HTTP/1.1\r\nHost: localhost\r\nIdempotency-Key: key-1\r\nContent-Length: 8\r\n\r\n12")
+	if http.StatusRequestTimeout != response.StatusCode {
+		t.Errorf("expected status %d, %d found", http.StatusRequestTimeout, response.StatusCode)
+	}
+}
+
+func TestIdempotencyServerError(t *testing.T) {
+	var calls int32
+	server := NewServer()
+	server.Use(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		if 1 == atomic.AddInt32(&calls, 1) {
+			response.SetStatusCode(http.StatusServiceUnavailable)
+		}
+		response.Channel <- response.Done()
+	})
+	handler := server.BuildHandler()
+
+	if recorder := serve(handler, "POST", "/", `{}`, map[string]string{IdempotencyHeader: "key-1"}); http.StatusServiceUnavailable != recorder.Code {
+		t.Fatalf("expected status %d, %d found", http.StatusServiceUnavailable, recorder.Code)
+	}
+	recorder := serve(handler, "POST", "/", `{}`, map[string]string{IdempotencyHeader: "key-1"})
+	if http.StatusOK != recorder.Code || 2 != calls || "" != recorder.Header().Get(IdempotencyReplayedHeader) {
+		t.Errorf("expected the request to be retried, %d with %d calls found", recorder.Code, calls)
+	}
+}
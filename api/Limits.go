@@ -0,0 +1,297 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+Limits caps request sizes and read times. Set Api.Limits for server wide
+limits and Controller.Limits to override the size and body read limits for a
+route
+*/
+type Limits struct {
+	/*
+		The largest request body accepted, larger bodies return 413
+	*/
+	MaxBodyBytes int64
+
+	/*
+		The largest total size of the request line and headers, larger
+		requests return 431
+	*/
+	MaxHeaderBytes int
+
+	/*
+		How long a client has to send the request body, slower clients
+		return 408
+	*/
+	BodyReadTimeout time.Duration
+
+	/*
+		The largest request body buffered in memory for the handlers, larger
+		bodies are buffered to a temporary file
+	*/
+	BodyMemoryBytes int64
+
+	/*
+		Server wide only, how long a client has to send the request headers.
+		This protects against slowloris style clients
+	*/
+	ReadHeaderTimeout time.Duration
+
+	/*
+		Server wide only, how long to wait for the next request on a
+		keep-alive connection
+	*/
+	IdleTimeout time.Duration
+
+	/*
+		Server wide only, how long a handler has to write the response
+	*/
+	WriteTimeout time.Duration
+}
+
+/*
+DefaultLimits returns the limits used by NewServer
+*/
+func DefaultLimits() *Limits {
+	return &Limits{
+		MaxBodyBytes:      10 << 20,
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+		BodyReadTimeout:   30 * time.Second,
+		BodyMemoryBytes:   DefaultBodyMemoryBytes,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+}
+
+/*
+merge returns the route limits, falling back to the server defaults for any
+value that isn't set
+*/
+func (limits *Limits) merge(defaults *Limits) Limits {
+	var merged Limits
+	if nil != defaults {
+		merged = *defaults
+	}
+	if nil == limits {
+		return merged
+	}
+	if 0 != limits.MaxBodyBytes {
+		merged.MaxBodyBytes = limits.MaxBodyBytes
+	}
+	if 0 != limits.MaxHeaderBytes {
+		merged.MaxHeaderBytes = limits.MaxHeaderBytes
+	}
+	if 0 != limits.BodyReadTimeout {
+		merged.BodyReadTimeout = limits.BodyReadTimeout
+	}
+	if 0 != limits.BodyMemoryBytes {
+		merged.BodyMemoryBytes = limits.BodyMemoryBytes
+	}
+	return merged
+}
+
+/*
+applyServer sets the server wide limits on an http.Server
+*/
+func (limits *Limits) applyServer(server *http.Server) {
+	if nil == limits {
+		return
+	}
+	server.MaxHeaderBytes = limits.MaxHeaderBytes
+	server.ReadHeaderTimeout = limits.ReadHeaderTimeout
+	server.IdleTimeout = limits.IdleTimeout
+	server.WriteTimeout = limits.WriteTimeout
+}
+
+/*
+limitedBody wraps a request body, recording the first read error so the
+controller can report it after all handlers have run
+*/
+type limitedBody struct {
+	io.ReadCloser
+	mux      sync.Mutex
+	err      error
+	deadline *http.ResponseController
+}
+
+/*
+Read implements io.Reader
+*/
+func (body *limitedBody) Read(data []byte) (int, error) {
+	n, err := body.ReadCloser.Read(data)
+	if io.EOF == err {
+		body.clearDeadline()
+	} else if nil != err {
+		body.mux.Lock()
+		if nil == body.err {
+			body.err = err
+		}
+		body.mux.Unlock()
+	}
+	return n, err
+}
+
+/*
+clearDeadline removes the body read deadline. It must not outlive the body,
+the server watches the connection for a client disconnect once the body has
+been read and a timeout there would cancel the request context
+*/
+func (body *limitedBody) clearDeadline() {
+	body.mux.Lock()
+	defer body.mux.Unlock()
+	if nil != body.deadline {
+		body.deadline.SetReadDeadline(time.Time{})
+		body.deadline = nil
+	}
+}
+
+/*
+status returns the status code for a body read error, or 0 if the body was
+read successfully
+*/
+func (body *limitedBody) status() (int, error) {
+	body.mux.Lock()
+	defer body.mux.Unlock()
+	var maxBytesErr *http.MaxBytesError
+	var netErr net.Error
+	switch {
+	case nil == body.err:
+		return 0, nil
+	case errors.As(body.err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, body.err
+	case errors.Is(body.err, os.ErrDeadlineExceeded), errors.As(body.err, &netErr) && netErr.Timeout():
+		return http.StatusRequestTimeout, body.err
+	}
+	return http.StatusBadRequest, body.err
+}
+
+/*
+headerSize approximates the size of the request line and headers as sent
+*/
+func headerSize(request *http.Request) int {
+	size := len(request.Method) + len(request.RequestURI) + len(request.Proto) + 4
+	for key, values := range request.Header {
+		for _, value := range values {
+			size += len(key) + len(value) + 4
+		}
+	}
+	return size
+}
+
+/*
+limitRequest enforces the header and body limits on a request. It returns the
+wrapped body, or false if a response has already been written
+*/
+func limitRequest(writer http.ResponseWriter, request *http.Request, limits Limits) (*limitedBody, bool) {
+	if limits.MaxHeaderBytes > 0 && headerSize(request) > limits.MaxHeaderBytes {
+		writeError(writer, http.StatusRequestHeaderFieldsTooLarge, fmt.Errorf("request headers exceed %d bytes", limits.MaxHeaderBytes))
+		return nil, false
+	}
+
+	if nil == request.Body {
+		request.Body = http.NoBody
+	}
+	if limits.MaxBodyBytes > 0 {
+		if request.ContentLength > limits.MaxBodyBytes {
+			writeError(writer, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", limits.MaxBodyBytes))
+			return nil, false
+		}
+		request.Body = http.MaxBytesReader(writer, request.Body, limits.MaxBodyBytes)
+	}
+
+	body := &limitedBody{ReadCloser: request.Body}
+	request.Body = body
+
+	// Requests without a body are already complete
+	if limits.BodyReadTimeout > 0 && 0 != request.ContentLength {
+		controller := http.NewResponseController(writer)
+		// Not all writers support deadlines, e.g. httptest.ResponseRecorder
+		if nil == controller.SetReadDeadline(time.Now().Add(limits.BodyReadTimeout)) {
+			body.deadline = controller
+		}
+	}
+	return body, true
+}
+
+type limitsKey struct{}
+
+/*
+withRouteLimits stores the limits of the route each request is for in the
+request context, so middleware that runs before the controller can enforce
+them
+*/
+func withRouteLimits(mux *http.ServeMux, routes map[string]Limits, defaults Limits, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		limits := defaults
+		if _, pattern := mux.Handler(request); "" != pattern {
+			if route, ok := routes[pattern]; ok {
+				limits = route
+			}
+		}
+		next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), limitsKey{}, limits)))
+	})
+}
+
+/*
+requestLimits returns the limits for the route a request is for. Requests
+that weren't routed by an Api use DefaultLimits
+*/
+func requestLimits(request *http.Request) Limits {
+	if limits, ok := request.Context().Value(limitsKey{}).(Limits); ok {
+		return limits
+	}
+	return *DefaultLimits()
+}
+
+/*
+readBody reads a request body in middleware, capped at the route's
+MaxBodyBytes and BodyReadTimeout. The body is replaced so the handlers can read it again
+*/
+func readBody(writer http.ResponseWriter, request *http.Request) ([]byte, error) {
+	limits := requestLimits(request)
+	reader := request.Body
+	if nil == reader {
+		reader = http.NoBody
+	}
+	if limits.MaxBodyBytes > 0 {
+		reader = http.MaxBytesReader(writer, reader, limits.MaxBodyBytes)
+	}
+	if limits.BodyReadTimeout > 0 && 0 != request.ContentLength {
+		controller := http.NewResponseController(writer)
+		if nil == controller.SetReadDeadline(time.Now().Add(limits.BodyReadTimeout)) {
+			defer controller.SetReadDeadline(time.Time{})
+		}
+	}
+	body, err := io.ReadAll(reader)
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+/*
+bodyErrorStatus returns the status code for an error reading a request body
+*/
+func bodyErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusRequestTimeout
+	}
+	return http.StatusBadRequest
+}
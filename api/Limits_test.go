@@ -0,0 +1,100 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func limitedServer(routeLimits *Limits) *Api {
+	server := NewServer()
+	server.Limits.MaxBodyBytes = 8
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		data, _ := io.ReadAll(request.Body)
+		response.Channel <- len(data)
+		response.Channel <- response.Done()
+	})
+	server.Controllers["/"].Limits = routeLimits
+	return server
+}
+
+func TestLimitsBody(t *testing.T) {
+	handler := limitedServer(nil).BuildHandler()
+
+	if recorder := serve(handler, "POST", "/", "12345678", nil); http.StatusOK != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusOK, recorder.Code)
+	}
+	if recorder := serve(handler, "POST", "/", "123456789", nil); http.StatusRequestEntityTooLarge != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+
+	// Unknown length bodies are enforced while streaming
+	recorder := serve(handler, "POST", "/", "123456789", map[string]string{"Content-Length": "-1"})
+	if http.StatusRequestEntityTooLarge != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), "Request Entity Too Large") {
+		t.Errorf("expected status message in %q", recorder.Body.String())
+	}
+}
+
+func TestLimitsRoute(t *testing.T) {
+	handler := limitedServer(&Limits{MaxBodyBytes: 16}).BuildHandler()
+	if recorder := serve(handler, "POST", "/", "123456789", map[string]string{"Content-Length": "-1"}); http.StatusOK != recorder.Code {
+		t.Errorf("expected route limit to override, status %d found", recorder.Code)
+	}
+}
+
+func TestLimitsHeaders(t *testing.T) {
+	handler := limitedServer(&Limits{MaxHeaderBytes: 64}).BuildHandler()
+	recorder := serve(handler, "GET", "/", "", map[string]string{"X-Large": strings.Repeat("a", 100)})
+	if http.StatusRequestHeaderFieldsTooLarge != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusRequestHeaderFieldsTooLarge, recorder.Code)
+	}
+}
+
+/*
+slowRequest sends a request whose body is never completed to api, returning
+the response
+*/
+func slowRequest(t *testing.T, api *Api, request string) *http.Response {
+	server, _ := api.NewHTTPServer("")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	io.WriteString(conn, request)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestLimitsSlowBody(t *testing.T) {
+	api := limitedServer(&Limits{BodyReadTimeout: 50 * time.Millisecond})
+	if server, _ := api.NewHTTPServer(""); 10*time.Second != server.ReadHeaderTimeout {
+		t.Errorf("expected default header timeout, %s found", server.ReadHeaderTimeout)
+	}
+	response := slowRequest(t, api, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 8\r\n\r\n12")
+	if http.StatusRequestTimeout != response.StatusCode {
+		t.Errorf("expected status %d, %d found", http.StatusRequestTimeout, response.StatusCode)
+	}
+}
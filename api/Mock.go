@@ -0,0 +1,293 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Mock replaces the handlers of every controller with canned responses, taken
+from recorded fixtures or the examples attached to each route. Set Api.Mock to
+serve an Api in mock mode
+*/
+type Mock struct {
+	/*
+		Recorded exchanges, matched by method and URL, then method and path
+	*/
+	Fixtures []*Exchange
+
+	/*
+		Delay added to every response, plus a random amount up to
+		LatencyJitter
+	*/
+	Latency       time.Duration
+	LatencyJitter time.Duration
+
+	/*
+		The fraction of requests, between 0 and 1, that fail with
+		ErrorStatus, 500 if it isn't set
+	*/
+	ErrorRate   float64
+	ErrorStatus int
+
+	/*
+		Validate request bodies against the route's RequestSchema
+	*/
+	Validate bool
+
+	mux  sync.Mutex
+	rand *rand.Rand
+}
+
+/*
+NewMock returns a pointer to a new Mock
+*/
+func NewMock() *Mock {
+	return &Mock{
+		ErrorStatus: http.StatusInternalServerError,
+		Validate:    true,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+/*
+LoadFixtures reads recorded exchanges from a file written by a
+TrafficRecorder
+*/
+func (mock *Mock) LoadFixtures(file string) error {
+	handle, err := os.Open(file)
+	if nil != err {
+		return err
+	}
+	defer handle.Close()
+	exchanges, err := ReadExchanges(handle)
+	if nil != err {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	mock.Fixtures = append(mock.Fixtures, exchanges...)
+	return nil
+}
+
+/*
+Seed makes latency jitter and error injection repeatable
+*/
+func (mock *Mock) Seed(seed int64) *Mock {
+	mock.mux.Lock()
+	defer mock.mux.Unlock()
+	mock.rand = rand.New(rand.NewSource(seed))
+	return mock
+}
+
+func (mock *Mock) float64() float64 {
+	mock.mux.Lock()
+	defer mock.mux.Unlock()
+	if nil == mock.rand {
+		mock.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return mock.rand.Float64()
+}
+
+/*
+handlerFunc returns a handler that serves mock responses for a controller,
+enforcing the same limits as the controller
+*/
+func (mock *Mock) handlerFunc(ctrl *Controller, defaults *Limits) func(http.ResponseWriter, *http.Request) {
+	limits := ctrl.Limits.merge(defaults)
+	return func(writer http.ResponseWriter, request *http.Request) {
+		operation := ctrl.Operations[request.Method]
+		if _, ok := limitRequest(writer, request, limits); !ok {
+			return
+		}
+
+		if mock.Validate && nil != operation && nil != operation.RequestSchema {
+			var body interface{}
+			if err := json.NewDecoder(request.Body).Decode(&body); nil != err {
+				writeError(writer, bodyErrorStatus(err), fmt.Errorf("invalid JSON body: %v", err))
+				return
+			}
+			if errs := operation.RequestSchema.Validate(body); 0 != len(errs) {
+				response := NewResponse().SetStatusCode(http.StatusUnprocessableEntity)
+				for _, err := range errs {
+					response.AddError(fmt.Errorf("%s", err))
+				}
+				response.Write(writer)
+				return
+			}
+		}
+
+		if latency := mock.Latency + time.Duration(mock.float64()*float64(mock.LatencyJitter)); latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-request.Context().Done():
+				return
+			}
+		}
+
+		if mock.ErrorRate > 0 && mock.float64() < mock.ErrorRate {
+			status := mock.ErrorStatus
+			if 0 == status {
+				status = http.StatusInternalServerError
+			}
+			writeError(writer, status, fmt.Errorf("injected error"))
+			return
+		}
+
+		if fixture := mock.fixture(request); nil != fixture {
+			body, _ := fixture.Response.bodyBytes()
+			for name, values := range fixture.Response.Header {
+				if "Content-Length" != name {
+					writer.Header()[name] = values
+				}
+			}
+			status := fixture.Response.Status
+			if 0 == status {
+				status = http.StatusOK
+			}
+			writer.WriteHeader(status)
+			writer.Write(body)
+			return
+		}
+
+		if nil != operation && 0 != len(operation.Examples) {
+			example := operation.Examples[0]
+			for name, values := range example.Header {
+				writer.Header()[name] = values
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			status := example.Status
+			if 0 == status {
+				status = http.StatusOK
+			}
+			writer.WriteHeader(status)
+			writer.Write(example.Body)
+			return
+		}
+
+		writeError(writer, http.StatusNotImplemented, fmt.Errorf("no mock response for %s %s", request.Method, request.URL.Path))
+	}
+}
+
+/*
+fixture returns the recorded exchange matching the method and URL, or the
+method and path
+*/
+func (mock *Mock) fixture(request *http.Request) *Exchange {
+	var partial *Exchange
+	for _, exchange := range mock.Fixtures {
+		if exchange.Request.Method != request.Method {
+			continue
+		}
+		if exchange.Request.URL == request.URL.RequestURI() {
+			return exchange
+		}
+		if nil == partial && strings.SplitN(exchange.Request.URL, "?", 2)[0] == request.URL.Path {
+			partial = exchange
+		}
+	}
+	return partial
+}
+
+/*
+openAPIMediaType is a request or response body in an OpenAPI document
+*/
+type openAPIMediaType struct {
+	Schema   *Schema         `json:"schema"`
+	Example  json.RawMessage `json:"example"`
+	Examples map[string]struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"examples"`
+}
+
+type openAPIOperation struct {
+	Summary     string `json:"summary"`
+	RequestBody *struct {
+		Content map[string]openAPIMediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]openAPIMediaType `json:"content"`
+	} `json:"responses"`
+}
+
+/*
+AddOpenAPI reads a JSON encoded OpenAPI 3 document and describes a controller
+for every path, creating controllers that don't exist yet. Request schemas and
+the JSON examples of each response are attached to the controllers, success
+responses first
+*/
+func (api *Api) AddOpenAPI(reader io.Reader) error {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(reader).Decode(&doc); nil != err {
+		return fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+
+	for endpoint, item := range doc.Paths {
+		for method, raw := range item {
+			method = strings.ToUpper(method)
+			switch method {
+			case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions:
+			default:
+				// path level parameters, servers, etc.
+				continue
+			}
+
+			var op openAPIOperation
+			if err := json.Unmarshal(raw, &op); nil != err {
+				return fmt.Errorf("invalid OpenAPI operation %s %s: %v", method, endpoint, err)
+			}
+
+			operation := &Operation{Summary: op.Summary}
+			if nil != op.RequestBody {
+				if media, ok := op.RequestBody.Content["application/json"]; ok {
+					operation.RequestSchema = media.Schema
+				}
+			}
+			for code, response := range op.Responses {
+				status, err := strconv.Atoi(code)
+				if nil != err {
+					// "default" and range responses don't have a status
+					continue
+				}
+				media, ok := response.Content["application/json"]
+				if !ok {
+					continue
+				}
+				if 0 != len(media.Example) {
+					operation.Examples = append(operation.Examples, &Example{Status: status, Body: media.Example})
+				}
+				names := make([]string, 0, len(media.Examples))
+				for name := range media.Examples {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					operation.Examples = append(operation.Examples, &Example{Status: status, Body: media.Examples[name].Value})
+				}
+			}
+			sort.SliceStable(operation.Examples, func(a, b int) bool {
+				return operation.Examples[a].Status < operation.Examples[b].Status
+			})
+
+			ctrl, ok := api.Controllers[endpoint]
+			if !ok {
+				ctrl = NewController(endpoint)
+				api.Controllers[endpoint] = ctrl
+			}
+			ctrl.Describe(method, operation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+//go:debug httpmuxgo121=0
+
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mockOpenAPI = `{
+	"openapi": "3.0.0",
+	"paths": {
+		"/users/{id}": {
+			"parameters": [],
+			"get": {
+				"responses": {
+					"404": {"content": {"application/json": {"example": {"error": "not found"}}}},
+					"200": {"content": {"application/json": {"example": {"id": 1, "name": "Ann"}}}}
+				}
+			}
+		},
+		"/users": {
+			"post": {
+				"requestBody": {"content": {"application/json": {"schema": {
+					"type": "object",
+					"required": ["name"],
+					"properties": {
+						"name": {"type": "string", "minLength": 1},
+						"age": {"type": "integer", "minimum": 0}
+					}
+				}}}},
+				"responses": {
+					"201": {"content": {"application/json": {"examples": {"created": {"value": {"id": 2}}}}}}
+				}
+			}
+		}
+	}
+}`
+
+func mockServer(t *testing.T, mock *Mock) http.Handler {
+	server := NewServer()
+	if err := server.AddOpenAPI(strings.NewReader(mockOpenAPI)); nil != err {
+		t.Fatal(err)
+	}
+	server.Mock = mock
+	return server.BuildHandler()
+}
+
+func TestMockExamples(t *testing.T) {
+	handler := mockServer(t, NewMock())
+
+	recorder := serve(handler, "GET", "/users/7", "", nil)
+	if http.StatusOK != recorder.Code || `{"id": 1, "name": "Ann"}` != recorder.Body.String() {
+		t.Errorf("expected success example, %d %s found", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(handler, "POST", "/users", `{"name": "Bob", "age": 3}`, nil)
+	if http.StatusCreated != recorder.Code || `{"id": 2}` != recorder.Body.String() {
+		t.Errorf("expected created example, %d %s found", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := serve(handler, "DELETE", "/users", "", nil); http.StatusNotImplemented != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusNotImplemented, recorder.Code)
+	}
+}
+
+func TestMockValidation(t *testing.T) {
+	recorder := serve(mockServer(t, NewMock()), "POST", "/users", `{"age": 1.5}`, nil)
+	if http.StatusUnprocessableEntity != recorder.Code {
+		t.Fatalf("expected status %d, %d found", http.StatusUnprocessableEntity, recorder.Code)
+	}
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	expect := "body.name: is required\nbody.age: expected integer, number found"
+	if expect != strings.Join(body.Errors, "\n") {
+		t.Errorf("unexpected errors %q", body.Errors)
+	}
+}
+
+func TestMockInjection(t *testing.T) {
+	mock := NewMock().Seed(1)
+	mock.ErrorRate = 1
+	mock.Latency = 20 * time.Millisecond
+	start := time.Now()
+	recorder := serve(mockServer(t, mock), "GET", "/users/1", "", nil)
+	if http.StatusInternalServerError != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusInternalServerError, recorder.Code)
+	}
+	if time.Since(start) < mock.Latency {
+		t.Errorf("expected latency of at least %s", mock.Latency)
+	}
+}
+
+func TestMockInjectionDefaultStatus(t *testing.T) {
+	server := NewServer()
+	if err := server.AddOpenAPI(strings.NewReader(mockOpenAPI)); nil != err {
+		t.Fatal(err)
+	}
+	server.Mock = &Mock{ErrorRate: 1}
+	recorder := serve(server, "GET", "/users/1", "", nil)
+	if http.StatusInternalServerError != recorder.Code {
+		t.Errorf("expected status %d without an ErrorStatus, %d found", http.StatusInternalServerError, recorder.Code)
+	}
+}
+
+func TestMockFixtures(t *testing.T) {
+	var buf bytes.Buffer
+	recorder := NewTrafficRecorder(&buf)
+	serve(recorder.Middleware()(replayServer(1)), "GET", "/?a=1", "", nil)
+	file := filepath.Join(t.TempDir(), "fixtures.jsonl")
+	os.WriteFile(file, buf.Bytes(), 0600)
+
+	mock := NewMock()
+	if err := mock.LoadFixtures(file); nil != err {
+		t.Fatal(err)
+	}
+	server := NewServer()
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		t.Errorf("expected mock mode not to call handlers")
+		response.Channel <- response.Done()
+	})
+	server.Mock = mock
+
+	response := serve(server.BuildHandler(), "GET", "/?a=2", "", nil)
+	if !strings.Contains(response.Body.String(), `"version":1`) {
+		t.Errorf("expected recorded response, %s found", response.Body.String())
+	}
+}
+
+func TestMockFixtureDefaults(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fixtures.jsonl")
+	os.WriteFile(file, []byte(`{"request": {"method": "POST", "url": "/"}, "response": {"header": {}, "body": "ok"}}`+"\n"), 0600)
+	mock := NewMock()
+	if err := mock.LoadFixtures(file); nil != err {
+		t.Fatal(err)
+	}
+	server := NewServer()
+	server.Limits.MaxBodyBytes = 8
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		response.Channel <- response.Done()
+	})
+	server.Mock = mock
+	handler := server.BuildHandler()
+
+	if response := serve(handler, "POST", "/", "", nil); http.StatusOK != response.Code || "ok" != response.Body.String() {
+		t.Errorf("expected status %d for a fixture without a status, %d found", http.StatusOK, response.Code)
+	}
+	if response := serve(handler, "POST", "/", "123456789", nil); http.StatusRequestEntityTooLarge != response.Code {
+		t.Errorf("expected status %d, %d found", http.StatusRequestEntityTooLarge, response.Code)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	model "github.com/mkenney/go/model.old"
+)
+
+/*
+Paginator parses paging parameters and generates signed cursors and links
+*/
+type Paginator struct {
+	/*
+		Key used to sign cursors so clients can't forge them
+	*/
+	Secret []byte
+
+	/*
+		The page size used when no limit is requested
+	*/
+	DefaultLimit int
+
+	/*
+		The largest page size a client may request
+	*/
+	MaxLimit int
+}
+
+/*
+Page is the requested window into a list
+*/
+type Page struct {
+	Limit  int
+	Offset int
+	Total  int
+}
+
+/*
+PageMeta is the pagination block added to the response envelope
+*/
+type PageMeta struct {
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Total  int    `json:"total"`
+	Next   string `json:"next,omitempty"`
+	Prev   string `json:"prev,omitempty"`
+}
+
+type cursor struct {
+	Offset int `json:"o"`
+	Limit  int `json:"l"`
+}
+
+/*
+NewPaginator returns a pointer to a new Paginator using secret to sign
+cursors. An empty secret returns ErrEmptySecret, anyone could forge cursors
+signed with it
+*/
+func NewPaginator(secret []byte) (*Paginator, error) {
+	if 0 == len(secret) {
+		return nil, ErrEmptySecret
+	}
+	return &Paginator{
+		Secret:       secret,
+		DefaultLimit: 20,
+		MaxLimit:     100,
+	}, nil
+}
+
+/*
+Parse reads the limit, offset and cursor query parameters. A cursor takes
+precedence over an offset
+*/
+func (p *Paginator) Parse(request *http.Request) (*Page, error) {
+	query := request.URL.Query()
+	page := &Page{Limit: p.DefaultLimit}
+
+	if value := query.Get("limit"); "" != value {
+		limit, err := strconv.Atoi(value)
+		if nil != err || limit < 1 {
+			return nil, fmt.Errorf("invalid limit '%s'", value)
+		}
+		page.Limit = limit
+	}
+	if value := query.Get("offset"); "" != value {
+		offset, err := strconv.Atoi(value)
+		if nil != err || offset < 0 {
+			return nil, fmt.Errorf("invalid offset '%s'", value)
+		}
+		page.Offset = offset
+	}
+	if value := query.Get("cursor"); "" != value {
+		offset, limit, err := p.DecodeCursor(value)
+		if nil != err {
+			return nil, err
+		}
+		page.Offset = offset
+		if "" == query.Get("limit") {
+			page.Limit = limit
+		}
+	}
+
+	if p.MaxLimit > 0 && page.Limit > p.MaxLimit {
+		page.Limit = p.MaxLimit
+	}
+	// a Paginator without a DefaultLimit still returns pages
+	if page.Limit < 1 {
+		page.Limit = 1
+	}
+	return page, nil
+}
+
+/*
+EncodeCursor returns an opaque, signed cursor for a page
+*/
+func (p *Paginator) EncodeCursor(offset, limit int) string {
+	payload, _ := json.Marshal(cursor{Offset: offset, Limit: limit})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(p.sign(encoded))
+}
+
+/*
+DecodeCursor verifies and decodes a cursor. Cursors are never accepted by a
+Paginator without a Secret
+*/
+func (p *Paginator) DecodeCursor(value string) (offset, limit int, err error) {
+	if 0 == len(p.Secret) {
+		return 0, 0, ErrEmptySecret
+	}
+	parts := strings.Split(value, ".")
+	if 2 != len(parts) {
+		return 0, 0, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if nil != err || !hmac.Equal(signature, p.sign(parts[0])) {
+		return 0, 0, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if nil != err {
+		return 0, 0, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(payload, &c); nil != err || c.Offset < 0 || c.Limit < 1 {
+		return 0, 0, ErrInvalidCursor
+	}
+	return c.Offset, c.Limit, nil
+}
+
+func (p *Paginator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, p.Secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+/*
+SliceCollection returns the models in the page and records the collection
+size
+*/
+func (page *Page) SliceCollection(collection *model.Collection) []*model.Model {
+	page.Total = collection.Len()
+	return collection.Slice(page.Offset, page.Limit)
+}
+
+/*
+Write adds RFC 8288 Link headers and a pagination metadata block to the
+response. page.Total must be set, next and last links are only written for a
+page with a limit
+*/
+func (p *Paginator) Write(request *http.Request, response *Response, page *Page) {
+	meta := PageMeta{Limit: page.Limit, Offset: page.Offset, Total: page.Total}
+
+	links := []string{p.link(request, 0, page.Limit, "first")}
+	if page.Offset > 0 {
+		prev := page.Offset - page.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		meta.Prev = p.EncodeCursor(prev, page.Limit)
+		links = append(links, p.link(request, prev, page.Limit, "prev"))
+	}
+	if page.Limit > 0 && page.Offset+page.Limit < page.Total {
+		meta.Next = p.EncodeCursor(page.Offset+page.Limit, page.Limit)
+		links = append(links, p.link(request, page.Offset+page.Limit, page.Limit, "next"))
+	}
+	if page.Limit > 0 && page.Total > 0 {
+		links = append(links, p.link(request, ((page.Total-1)/page.Limit)*page.Limit, page.Limit, "last"))
+	}
+
+	response.AddHeader("Link", strings.Join(links, ", "))
+	response.SetMeta("pagination", meta)
+}
+
+func (p *Paginator) link(request *http.Request, offset, limit int, rel string) string {
+	query := request.URL.Query()
+	query.Del("offset")
+	query.Del("limit")
+	query.Set("cursor", p.EncodeCursor(offset, limit))
+	return fmt.Sprintf(`<%s?%s>; rel="%s"`, request.URL.Path, query.Encode(), rel)
+}
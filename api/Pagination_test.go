@@ -0,0 +1,127 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	model "github.com/mkenney/go/model.old"
+)
+
+func paginatedServer(paginator *Paginator) http.HandlerFunc {
+	collection := model.NewCollection()
+	for a := 0; a < 5; a++ {
+		m := model.NewModel()
+		m.Set("id", a)
+		collection.Push(m)
+	}
+
+	ctrl := NewController("/items")
+	ctrl.AddHandler(func(request *http.Request, response *Response) {
+		defer func() { response.Channel <- response.Done() }()
+		page, err := paginator.Parse(request)
+		if nil != err {
+			response.SetStatusCode(http.StatusBadRequest).AddError(err)
+			return
+		}
+		for _, m := range page.SliceCollection(collection) {
+			id, _ := m.Get("id")
+			response.Channel <- id
+		}
+		paginator.Write(request, response, page)
+	})
+	return ctrl.HandlerFunc()
+}
+
+type pageBody struct {
+	Data []int `json:"data"`
+	Meta struct {
+		Pagination PageMeta `json:"pagination"`
+	} `json:"meta"`
+}
+
+func getPage(t *testing.T, handler http.HandlerFunc, target string) (*httptest.ResponseRecorder, pageBody) {
+	recorder := serve(handler, "GET", target, "", nil)
+	var body pageBody
+	if http.StatusOK == recorder.Code {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); nil != err {
+			t.Fatalf("%s: %s", err, recorder.Body.String())
+		}
+	}
+	return recorder, body
+}
+
+func TestPaginationCursor(t *testing.T) {
+	paginator, _ := NewPaginator([]byte("secret"))
+	handler := paginatedServer(paginator)
+
+	_, body := getPage(t, handler, "/items?limit=2")
+	if fmt.Sprint(body.Data) != "[0 1]" || 5 != body.Meta.Pagination.Total {
+		t.Fatalf("expected first page, %v found", body)
+	}
+
+	recorder, body := getPage(t, handler, "/items?cursor="+url.QueryEscape(body.Meta.Pagination.Next))
+	if fmt.Sprint(body.Data) != "[2 3]" {
+		t.Errorf("expected second page, %v found", body)
+	}
+
+	link := recorder.Header().Get("Link")
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		if !regexp.MustCompile(`<[^>]+>; rel="` + rel + `"`).MatchString(link) {
+			t.Errorf("expected %s link in %q", rel, link)
+		}
+	}
+}
+
+func TestPaginationOffset(t *testing.T) {
+	paginator, _ := NewPaginator([]byte("secret"))
+	handler := paginatedServer(paginator)
+	_, body := getPage(t, handler, "/items?limit=2&offset=4")
+	if fmt.Sprint(body.Data) != "[4]" || "" != body.Meta.Pagination.Next {
+		t.Errorf("expected last page, %v found", body)
+	}
+
+	// a Paginator without a DefaultLimit returns one item per page
+	_, body = getPage(t, paginatedServer(&Paginator{Secret: []byte("secret")}), "/items")
+	if fmt.Sprint(body.Data) != "[0]" || 1 != body.Meta.Pagination.Limit {
+		t.Errorf("expected a page of one, %v found", body)
+	}
+
+	response := NewResponse()
+	paginator.Write(httptest.NewRequest("GET", "/items", nil), response, &Page{Total: 5})
+	if link := fmt.Sprint(response.Headers["Link"]); regexp.MustCompile(`rel="(next|last)"`).MatchString(link) {
+		t.Errorf("expected no next or last link without a limit, %q found", link)
+	}
+}
+
+func TestPaginationInvalid(t *testing.T) {
+	paginator, _ := NewPaginator([]byte("secret"))
+	forged := (&Paginator{Secret: []byte("forged")}).EncodeCursor(2, 2)
+	handler := paginatedServer(paginator)
+
+	for _, target := range []string{"/items?limit=0", "/items?offset=-1", "/items?cursor=" + forged} {
+		if recorder, _ := getPage(t, handler, target); http.StatusBadRequest != recorder.Code {
+			t.Errorf("%s: expected status %d, %d found", target, http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
+
+func TestPaginationEmptySecret(t *testing.T) {
+	for _, secret := range [][]byte{nil, {}} {
+		if _, err := NewPaginator(secret); ErrEmptySecret != err {
+			t.Errorf("%q: expected ErrEmptySecret, %v found", secret, err)
+		}
+	}
+
+	forged := (&Paginator{}).EncodeCursor(2, 2)
+	if _, _, err := (&Paginator{}).DecodeCursor(forged); ErrEmptySecret != err {
+		t.Errorf("expected cursors to be rejected without a secret, %v found", err)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+RateLimitConfig limits the request rate of each client, identified by remote
+IP address
+*/
+type RateLimitConfig struct {
+	/*
+		The sustained number of requests allowed per second
+	*/
+	RequestsPerSecond float64 `json:"requests_per_second"`
+
+	/*
+		The number of requests allowed in a burst, defaults to
+		RequestsPerSecond rounded up
+	*/
+	Burst int `json:"burst"`
+}
+
+/*
+Validate checks the configuration for errors
+*/
+func (cfg *RateLimitConfig) Validate() []string {
+	errs := make([]string, 0)
+	if cfg.RequestsPerSecond <= 0 {
+		errs = append(errs, "rate_limit.requests_per_second: must be greater than 0")
+	}
+	if cfg.Burst < 0 {
+		errs = append(errs, "rate_limit.burst: must not be negative")
+	}
+	return errs
+}
+
+/*
+tokenBucket tracks the requests available to a single client
+*/
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+/*
+rateLimiter is a token bucket per client
+*/
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	mux     sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+	now     func() time.Time
+}
+
+func newRateLimiter(cfg *RateLimitConfig) *rateLimiter {
+	limiter := &rateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+	limiter.configure(cfg)
+	return limiter
+}
+
+/*
+configure changes the rate and burst, keeping the tokens each client has left
+*/
+func (limiter *rateLimiter) configure(cfg *RateLimitConfig) {
+	burst := float64(cfg.Burst)
+	if 0 == burst {
+		burst = math.Ceil(cfg.RequestsPerSecond)
+	}
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+	limiter.rate = cfg.RequestsPerSecond
+	limiter.burst = burst
+}
+
+/*
+allow takes a token for a client, or returns how long until one is available
+*/
+func (limiter *rateLimiter) allow(client string) (bool, time.Duration) {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+	now := limiter.now()
+
+	// Drop clients whose buckets have refilled
+	full := time.Duration(limiter.burst / limiter.rate * float64(time.Second))
+	if now.Sub(limiter.pruned) > full && now.Sub(limiter.pruned) > time.Minute {
+		for key, bucket := range limiter.buckets {
+			if now.Sub(bucket.last) > full {
+				delete(limiter.buckets, key)
+			}
+		}
+		limiter.pruned = now
+	}
+
+	bucket, ok := limiter.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: limiter.burst, last: now}
+		limiter.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(limiter.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limiter.rate)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / limiter.rate * float64(time.Second))
+}
+
+/*
+Middleware returns middleware that rejects clients exceeding the rate limit
+with 429 Too Many Requests
+*/
+func (cfg *RateLimitConfig) Middleware() Middleware {
+	return newRateLimiter(cfg).middleware
+}
+
+/*
+middleware rejects clients exceeding the rate limit
+*/
+func (limiter *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		client, _, err := net.SplitHostPort(request.RemoteAddr)
+		if nil != err {
+			client = request.RemoteAddr
+		}
+		if ok, wait := limiter.allow(client); !ok {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(writer, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded"))
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+/*
+rateLimiter returns the limiter for a route, "" for the server wide limit,
+reusing the limiter from the previous handler so clients keep their remaining
+requests when the configuration is reloaded
+*/
+func (api *Api) rateLimiter(route string, cfg *RateLimitConfig, limiters map[string]*rateLimiter) *rateLimiter {
+	limiter, ok := api.rateLimiters[route]
+	if ok {
+		limiter.configure(cfg)
+	} else {
+		limiter = newRateLimiter(cfg)
+	}
+	limiters[route] = limiter
+	return limiter
+}
@@ -0,0 +1,82 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(&RateLimitConfig{RequestsPerSecond: 2, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	for a := 0; a < 2; a++ {
+		if ok, _ := limiter.allow("a"); !ok {
+			t.Fatalf("expected request %d to be allowed", a)
+		}
+	}
+	ok, wait := limiter.allow("a")
+	if ok || 500*time.Millisecond != wait {
+		t.Errorf("expected to wait 500ms, %v %v found", ok, wait)
+	}
+	if ok, _ := limiter.allow("b"); !ok {
+		t.Errorf("expected other clients to be allowed")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := limiter.allow("a"); !ok {
+		t.Errorf("expected a token to be available after 500ms")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := (&RateLimitConfig{RequestsPerSecond: 0.5}).Middleware()(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 0)
+	for a := 0; a < 2; a++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		codes = append(codes, recorder.Code)
+		if http.StatusTooManyRequests == recorder.Code && "2" != recorder.Header().Get("Retry-After") {
+			t.Errorf("expected Retry-After 2, '%s' found", recorder.Header().Get("Retry-After"))
+		}
+	}
+	if http.StatusOK != codes[0] || http.StatusTooManyRequests != codes[1] {
+		t.Errorf("expected [200 429], %v found", codes)
+	}
+}
+
+func TestRateLimitReload(t *testing.T) {
+	api := NewServer()
+	api.AddHandler("/a", func(request *http.Request, response *Response) {
+		response.Channel <- response.Done()
+	})
+	cfg := DefaultConfig()
+	cfg.RateLimit = &RateLimitConfig{RequestsPerSecond: 0.001}
+	if err := api.ApplyConfig(cfg); nil != err {
+		t.Fatal(err)
+	}
+	api.BuildHandler()
+
+	get := func() int {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest("GET", "/a", nil))
+		return recorder.Code
+	}
+	if code := get(); http.StatusOK != code {
+		t.Fatalf("expected 200, %d found", code)
+	}
+	if err := api.Reload(cfg); nil != err {
+		t.Fatal(err)
+	}
+	if code := get(); http.StatusTooManyRequests != code {
+		t.Errorf("expected the rate limit to be kept across a reload, %d found", code)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"net/http"
+)
+
+/*
+responseRecorder is an http.ResponseWriter that passes everything through to
+the wrapped writer while keeping a copy of the status code and body
+*/
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	body        bytes.Buffer
+	wroteHeader bool
+
+	/*
+		If set, only this much of the body is kept
+	*/
+	limit     int64
+	truncated bool
+}
+
+func newResponseRecorder(writer http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: writer, statusCode: http.StatusOK}
+}
+
+/*
+WriteHeader implements http.ResponseWriter
+*/
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.statusCode = statusCode
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+/*
+Write implements http.ResponseWriter
+*/
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	kept := data
+	if rec.limit > 0 && int64(rec.body.Len()+len(data)) > rec.limit {
+		kept = data[:rec.limit-int64(rec.body.Len())]
+		rec.truncated = true
+	}
+	rec.body.Write(kept)
+	return rec.ResponseWriter.Write(data)
+}
+
+/*
+Flush implements http.Flusher if the wrapped writer supports it
+*/
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+/*
+Unwrap returns the wrapped writer for use with http.ResponseController
+*/
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
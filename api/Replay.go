@@ -0,0 +1,546 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+RedactedValue replaces the value of redacted headers
+*/
+const RedactedValue = "REDACTED"
+
+/*
+DefaultRedactedHeaders are redacted by a new TrafficRecorder
+*/
+var DefaultRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie"}
+
+/*
+DefaultIgnoredHeaders are not compared when replaying traffic
+*/
+var DefaultIgnoredHeaders = []string{"Content-Length", "Date", IdempotencyReplayedHeader}
+
+/*
+DefaultRecordedBodyBytes is the largest body recorded by a TrafficRecorder
+without a MaxBodyBytes
+*/
+const DefaultRecordedBodyBytes = 1 << 20
+
+/*
+RecordedMessage is a recorded request or response. Bodies that aren't valid
+UTF-8 are stored base64 encoded, bodies longer than the recorder's
+MaxBodyBytes are truncated
+*/
+type RecordedMessage struct {
+	Method       string              `json:"method,omitempty"`
+	URL          string              `json:"url,omitempty"`
+	Status       int                 `json:"status,omitempty"`
+	Header       map[string][]string `json:"header"`
+	Body         string              `json:"body"`
+	BodyEncoding string              `json:"body_encoding,omitempty"`
+	Truncated    bool                `json:"truncated,omitempty"`
+}
+
+/*
+Exchange is a recorded request and response pair
+*/
+type Exchange struct {
+	Request  RecordedMessage `json:"request"`
+	Response RecordedMessage `json:"response"`
+}
+
+/*
+TrafficRecorder writes the traffic handled by an Api to a stream, one JSON
+encoded Exchange per line
+*/
+type TrafficRecorder struct {
+	/*
+		Headers whose values are replaced with RedactedValue
+	*/
+	Redact []string
+
+	/*
+		The largest request or response body recorded, longer bodies are
+		truncated. Only this much of a request body is buffered, the rest is
+		streamed to the handlers
+	*/
+	MaxBodyBytes int64
+
+	mux    sync.Mutex
+	writer io.Writer
+}
+
+/*
+NewTrafficRecorder returns a pointer to a new TrafficRecorder writing to writer
+*/
+func NewTrafficRecorder(writer io.Writer) *TrafficRecorder {
+	return &TrafficRecorder{
+		Redact:       append([]string{}, DefaultRedactedHeaders...),
+		MaxBodyBytes: DefaultRecordedBodyBytes,
+		writer:       writer,
+	}
+}
+
+/*
+Middleware returns middleware that records every request and response
+*/
+func (tr *TrafficRecorder) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			limit := tr.MaxBodyBytes
+			if limit <= 0 {
+				limit = DefaultRecordedBodyBytes
+			}
+			body, truncated, err := peekBody(writer, request, limit)
+			if nil != err {
+				writer.Header().Set("Connection", "close")
+				writeError(writer, bodyErrorStatus(err), err)
+				return
+			}
+
+			recorder := newResponseRecorder(writer)
+			recorder.limit = limit
+			next.ServeHTTP(recorder, request)
+
+			exchange := &Exchange{
+				Request:  tr.message(request.Header, body),
+				Response: tr.message(recorder.Header(), recorder.body.Bytes()),
+			}
+			exchange.Request.Truncated = truncated
+			exchange.Response.Truncated = recorder.truncated
+			exchange.Request.Method = request.Method
+			exchange.Request.URL = request.URL.RequestURI()
+			exchange.Response.Status = recorder.statusCode
+			if err := tr.write(exchange); nil != err {
+				log.Printf("unable to record exchange: %v", err)
+			}
+		})
+	}
+}
+
+/*
+peekBody reads up to limit bytes of a request body within the route's
+BodyReadTimeout, reporting whether there was more. The body is replaced so the
+handlers still read all of it
+*/
+func peekBody(writer http.ResponseWriter, request *http.Request, limit int64) ([]byte, bool, error) {
+	if nil == request.Body {
+		return nil, false, nil
+	}
+	if timeout := requestLimits(request).BodyReadTimeout; timeout > 0 && 0 != request.ContentLength {
+		controller := http.NewResponseController(writer)
+		if nil == controller.SetReadDeadline(time.Now().Add(timeout)) {
+			defer controller.SetReadDeadline(time.Time{})
+		}
+	}
+	original := request.Body
+	body, err := io.ReadAll(io.LimitReader(original, limit+1))
+	if nil != err {
+		return nil, false, err
+	}
+	request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), original), original}
+	if int64(len(body)) > limit {
+		return body[:limit], true, nil
+	}
+	return body, false, nil
+}
+
+func (tr *TrafficRecorder) message(header http.Header, body []byte) RecordedMessage {
+	message := RecordedMessage{Header: header.Clone()}
+	if nil == message.Header {
+		message.Header = make(map[string][]string)
+	}
+	for _, name := range tr.Redact {
+		name = http.CanonicalHeaderKey(name)
+		if values, ok := message.Header[name]; ok {
+			message.Header[name] = make([]string, len(values))
+			for k := range values {
+				message.Header[name][k] = RedactedValue
+			}
+		}
+	}
+	if utf8.Valid(body) {
+		message.Body = string(body)
+	} else {
+		message.Body = base64.StdEncoding.EncodeToString(body)
+		message.BodyEncoding = "base64"
+	}
+	return message
+}
+
+func (tr *TrafficRecorder) write(exchange *Exchange) error {
+	line, err := json.Marshal(exchange)
+	if nil != err {
+		return err
+	}
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+	_, err = tr.writer.Write(append(line, '\n'))
+	return err
+}
+
+/*
+ReadExchanges reads recorded exchanges from a stream written by a
+TrafficRecorder
+*/
+func ReadExchanges(reader io.Reader) ([]*Exchange, error) {
+	exchanges := make([]*Exchange, 0)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if 0 == len(bytes.TrimSpace(scanner.Bytes())) {
+			continue
+		}
+		exchange := new(Exchange)
+		if err := json.Unmarshal(scanner.Bytes(), exchange); nil != err {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, scanner.Err()
+}
+
+/*
+bodyBytes returns the decoded message body
+*/
+func (message RecordedMessage) bodyBytes() ([]byte, error) {
+	if "base64" == message.BodyEncoding {
+		return base64.StdEncoding.DecodeString(message.Body)
+	}
+	return []byte(message.Body), nil
+}
+
+/*
+ReplayResult is the outcome of replaying a single exchange
+*/
+type ReplayResult struct {
+	Method      string   `json:"method"`
+	URL         string   `json:"url"`
+	Differences []string `json:"differences,omitempty"`
+}
+
+/*
+ReplayReport is the outcome of replaying recorded traffic
+*/
+type ReplayReport struct {
+	Total   int             `json:"total"`
+	Passed  int             `json:"passed"`
+	Failed  int             `json:"failed"`
+	Results []*ReplayResult `json:"results"`
+}
+
+/*
+String implements stringer, listing the differences for every failed exchange
+*/
+func (report *ReplayReport) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d exchanges, %d passed, %d failed\n", report.Total, report.Passed, report.Failed)
+	for _, result := range report.Results {
+		if 0 == len(result.Differences) {
+			continue
+		}
+		fmt.Fprintf(&buf, "\n%s %s\n", result.Method, result.URL)
+		for _, diff := range result.Differences {
+			fmt.Fprintf(&buf, "  %s\n", diff)
+		}
+	}
+	return buf.String()
+}
+
+/*
+Replayer sends recorded requests to a handler and compares the responses
+*/
+type Replayer struct {
+	/*
+		Headers that aren't compared, redacted headers are never compared
+	*/
+	IgnoreHeaders []string
+
+	/*
+		Sends a request and returns the response
+	*/
+	Do func(*http.Request) (*http.Response, error)
+}
+
+/*
+NewReplayer returns a pointer to a new Replayer that serves requests with
+handler, e.g. the result of Api.BuildHandler
+*/
+func NewReplayer(handler http.Handler) *Replayer {
+	return &Replayer{
+		IgnoreHeaders: append([]string{}, DefaultIgnoredHeaders...),
+		Do: func(request *http.Request) (*http.Response, error) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			return recorder.Result(), nil
+		},
+	}
+}
+
+/*
+NewURLReplayer returns a pointer to a new Replayer that sends requests to a
+running server
+*/
+func NewURLReplayer(baseURL string, client *http.Client) *Replayer {
+	if nil == client {
+		client = http.DefaultClient
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &Replayer{
+		IgnoreHeaders: append([]string{}, DefaultIgnoredHeaders...),
+		Do: func(request *http.Request) (*http.Response, error) {
+			outbound, err := http.NewRequest(request.Method, baseURL+request.URL.RequestURI(), request.Body)
+			if nil != err {
+				return nil, err
+			}
+			outbound.Header = request.Header
+			return client.Do(outbound)
+		},
+	}
+}
+
+/*
+Replay sends every recorded request and compares the status, headers and body
+of the response with the recorded response
+*/
+func (rp *Replayer) Replay(exchanges []*Exchange) *ReplayReport {
+	report := &ReplayReport{Results: make([]*ReplayResult, 0, len(exchanges))}
+	for _, exchange := range exchanges {
+		result := &ReplayResult{Method: exchange.Request.Method, URL: exchange.Request.URL}
+		result.Differences = rp.replay(exchange)
+		report.Results = append(report.Results, result)
+		report.Total++
+		if 0 == len(result.Differences) {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	return report
+}
+
+func (rp *Replayer) replay(exchange *Exchange) []string {
+	if exchange.Request.Truncated {
+		return []string{"request body was truncated when it was recorded"}
+	}
+	body, err := exchange.Request.bodyBytes()
+	if nil != err {
+		return []string{fmt.Sprintf("invalid recorded request body: %v", err)}
+	}
+	request := httptest.NewRequest(exchange.Request.Method, exchange.Request.URL, bytes.NewReader(body))
+	for name, values := range exchange.Request.Header {
+		for _, value := range values {
+			if RedactedValue != value {
+				request.Header.Add(name, value)
+			}
+		}
+	}
+
+	response, err := rp.Do(request)
+	if nil != err {
+		return []string{fmt.Sprintf("request failed: %v", err)}
+	}
+	defer response.Body.Close()
+	actualBody, err := io.ReadAll(response.Body)
+	if nil != err {
+		return []string{fmt.Sprintf("unable to read response: %v", err)}
+	}
+
+	diffs := make([]string, 0)
+	if exchange.Response.Status != response.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("status: expected %d, %d found", exchange.Response.Status, response.StatusCode))
+	}
+	diffs = append(diffs, rp.diffHeaders(exchange.Response.Header, response.Header)...)
+
+	expectBody, err := exchange.Response.bodyBytes()
+	if nil != err {
+		return append(diffs, fmt.Sprintf("invalid recorded response body: %v", err))
+	}
+	// Only the recorded part of a truncated body can be compared
+	if exchange.Response.Truncated {
+		if !bytes.HasPrefix(actualBody, expectBody) {
+			diffs = append(diffs, fmt.Sprintf("body: expected to start with the %d recorded bytes", len(expectBody)))
+		}
+		return diffs
+	}
+	return append(diffs, diffBodies(expectBody, actualBody)...)
+}
+
+func (rp *Replayer) diffHeaders(expect, actual http.Header) []string {
+	ignored := make(map[string]bool)
+	for _, name := range rp.IgnoreHeaders {
+		ignored[http.CanonicalHeaderKey(name)] = true
+	}
+
+	names := make(map[string]bool)
+	for name := range expect {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	for name := range actual {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	diffs := make([]string, 0)
+	for _, name := range sorted {
+		expectValues := http.Header(expect).Values(name)
+		if ignored[name] || (len(expectValues) > 0 && RedactedValue == expectValues[0]) {
+			continue
+		}
+		if actualValues := actual.Values(name); !reflect.DeepEqual(expectValues, actualValues) {
+			diffs = append(diffs, fmt.Sprintf("header %s: expected %q, %q found", name, expectValues, actualValues))
+		}
+	}
+	return diffs
+}
+
+/*
+diffBodies compares JSON bodies structurally, ignoring the order of the
+elements of a top level array, and other bodies byte for byte
+*/
+func diffBodies(expect, actual []byte) []string {
+	var expectJSON, actualJSON interface{}
+	if nil != json.Unmarshal(expect, &expectJSON) || nil != json.Unmarshal(actual, &actualJSON) {
+		if !bytes.Equal(expect, actual) {
+			return []string{fmt.Sprintf("body: expected %q, %q found", expect, actual)}
+		}
+		return nil
+	}
+	// The top level array holds the handler responses, in the order the
+	// handlers finished
+	expectArray, expectOK := expectJSON.([]interface{})
+	actualArray, actualOK := actualJSON.([]interface{})
+	if expectOK && actualOK {
+		return diffJSONArrays("body", expectArray, actualArray)
+	}
+	return diffJSON("body", expectJSON, actualJSON)
+}
+
+func diffJSON(path string, expect, actual interface{}) []string {
+	switch expectTyped := expect.(type) {
+	case map[string]interface{}:
+		actualTyped, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool)
+		for key := range expectTyped {
+			keys[key] = true
+		}
+		for key := range actualTyped {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		diffs := make([]string, 0)
+		for _, key := range sorted {
+			expectValue, inExpect := expectTyped[key]
+			actualValue, inActual := actualTyped[key]
+			switch {
+			case !inActual:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing, expected %s", path, key, canonicalJSON(expectValue)))
+			case !inExpect:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: unexpected %s", path, key, canonicalJSON(actualValue)))
+			default:
+				diffs = append(diffs, diffJSON(path+"."+key, expectValue, actualValue)...)
+			}
+		}
+		return diffs
+
+	case []interface{}:
+		actualTyped, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		diffs := make([]string, 0)
+		for k := 0; k < len(expectTyped) || k < len(actualTyped); k++ {
+			switch {
+			case k >= len(actualTyped):
+				diffs = append(diffs, fmt.Sprintf("%s[%d]: missing, expected %s", path, k, canonicalJSON(expectTyped[k])))
+			case k >= len(expectTyped):
+				diffs = append(diffs, fmt.Sprintf("%s[%d]: unexpected %s", path, k, canonicalJSON(actualTyped[k])))
+			default:
+				diffs = append(diffs, diffJSON(fmt.Sprintf("%s[%d]", path, k), expectTyped[k], actualTyped[k])...)
+			}
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(expect, actual) {
+		return []string{fmt.Sprintf("%s: expected %s, %s found", path, canonicalJSON(expect), canonicalJSON(actual))}
+	}
+	return nil
+}
+
+/*
+diffJSONArrays compares the handler responses as a multiset, the fan-in order
+of handler responses is not deterministic
+*/
+func diffJSONArrays(path string, expect, actual []interface{}) []string {
+	remaining := make(map[string]int)
+	for _, value := range actual {
+		remaining[canonicalJSON(value)]++
+	}
+
+	missing := make([]string, 0)
+	for _, value := range expect {
+		key := canonicalJSON(value)
+		if remaining[key] > 0 {
+			remaining[key]--
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	unexpected := make([]string, 0)
+	for _, value := range actual {
+		key := canonicalJSON(value)
+		if remaining[key] > 0 {
+			remaining[key]--
+			unexpected = append(unexpected, key)
+		}
+	}
+
+	diffs := make([]string, 0)
+	for _, value := range missing {
+		diffs = append(diffs, fmt.Sprintf("%s[]: missing element %s", path, value))
+	}
+	for _, value := range unexpected {
+		diffs = append(diffs, fmt.Sprintf("%s[]: unexpected element %s", path, value))
+	}
+	return diffs
+}
+
+/*
+canonicalJSON encodes a decoded JSON value, map keys are sorted by the encoder
+*/
+func canonicalJSON(value interface{}) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,131 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func replayServer(version int) http.Handler {
+	server := NewServer()
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		response.Channel <- map[string]interface{}{"handler": 1, "version": version}
+		response.Channel <- response.Done()
+	})
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		response.Channel <- map[string]interface{}{"handler": 2}
+		response.Channel <- response.Done()
+	})
+	return server.BuildHandler()
+}
+
+func recordTraffic(t *testing.T) []*Exchange {
+	var buf bytes.Buffer
+	recorder := NewTrafficRecorder(&buf)
+	handler := recorder.Middleware()(replayServer(1))
+
+	for a := 0; a < 3; a++ {
+		serve(handler, "POST", "/?a=1", `{"b":2}`, map[string]string{"Authorization": "Bearer secret"})
+	}
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("expected Authorization header to be redacted, %s found", buf.String())
+	}
+	exchanges, err := ReadExchanges(&buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(exchanges) || `{"b":2}` != exchanges[0].Request.Body || 200 != exchanges[0].Response.Status {
+		t.Fatalf("unexpected recording %+v", exchanges)
+	}
+	return exchanges
+}
+
+func TestReplayPasses(t *testing.T) {
+	report := NewReplayer(replayServer(1)).Replay(recordTraffic(t))
+	if 3 != report.Passed {
+		t.Errorf("expected all exchanges to pass, %s found", report)
+	}
+}
+
+func TestReplayDiff(t *testing.T) {
+	report := NewReplayer(replayServer(2)).Replay(recordTraffic(t))
+	if 3 != report.Failed {
+		t.Fatalf("expected all exchanges to fail, %s found", report)
+	}
+	expect := []string{
+		`body[]: missing element {"handler":1,"version":1}`,
+		`body[]: unexpected element {"handler":1,"version":2}`,
+	}
+	if strings.Join(expect, "\n") != strings.Join(report.Results[0].Differences, "\n") {
+		t.Errorf("unexpected differences %q", report.Results[0].Differences)
+	}
+}
+
+func TestReplayJSONDiff(t *testing.T) {
+	diffs := diffBodies([]byte(`{"a":[1,2,{"b":3}],"c":"d"}`), []byte(`{"a":[1,2,{"b":4},5],"c":"e","f":1}`))
+	expect := []string{`body.a[2].b: expected 3, 4 found`, `body.a[3]: unexpected 5`, `body.c: expected "d", "e" found`, `body.f: unexpected 1`}
+	if strings.Join(expect, "\n") != strings.Join(diffs, "\n") {
+		t.Errorf("unexpected differences %q", diffs)
+	}
+
+	// only the handler responses may be in any order
+	if diffs := diffBodies([]byte(`[{"a":[1,2]},{"b":1}]`), []byte(`[{"b":1},{"a":[1,2]}]`)); 0 != len(diffs) {
+		t.Errorf("expected handler responses in any order to match, %q found", diffs)
+	}
+	diffs = diffBodies([]byte(`{"items":[1,2]}`), []byte(`{"items":[2,1]}`))
+	expect = []string{`body.items[0]: expected 1, 2 found`, `body.items[1]: expected 2, 1 found`}
+	if strings.Join(expect, "\n") != strings.Join(diffs, "\n") {
+		t.Errorf("expected nested arrays to be compared in order, %q found", diffs)
+	}
+}
+
+func TestRecordTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	recorder := NewTrafficRecorder(&buf)
+	recorder.MaxBodyBytes = 4
+	var received string
+	handler := recorder.Middleware()(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		data, _ := io.ReadAll(request.Body)
+		received = string(data)
+		writer.Write([]byte("response"))
+	}))
+	serve(handler, "POST", "/", "request", nil)
+
+	exchanges, err := ReadExchanges(&buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "request" != received {
+		t.Errorf("expected the handler to read the whole body, %q found", received)
+	}
+	if recorded := exchanges[0]; "requ" != recorded.Request.Body || !recorded.Request.Truncated ||
+		"resp" != recorded.Response.Body || !recorded.Response.Truncated {
+		t.Errorf("expected truncated bodies, %+v found", recorded)
+	}
+
+	report := NewReplayer(handler).Replay(exchanges)
+	if expect := "request body was truncated when it was recorded"; 1 != report.Failed || expect != report.Results[0].Differences[0] {
+		t.Errorf("expected %q, %s found", expect, report)
+	}
+}
+
+func TestRecordSlowBody(t *testing.T) {
+	server := NewServer()
+	server.Limits.BodyReadTimeout = 50 * time.Millisecond
+	server.Use(NewTrafficRecorder(io.Discard).Middleware())
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		response.Channel <- response.Done()
+	})
+
+	response := slowRequest(t, server, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 8\r\n\r\n12")
+	if http.StatusRequestTimeout != response.StatusCode {
+		t.Errorf("expected status %d, %d found", http.StatusRequestTimeout, response.StatusCode)
+	}
+}
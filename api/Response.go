@@ -3,6 +3,12 @@ Package api is a Golang API service
 */
 package api
 
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
 /*
 Response stores handlers for each endpoint
 */
@@ -27,6 +33,17 @@ type Response struct {
 	*/
 	Headers map[string][]string
 
+	/*
+		Optional metadata, if set the body is wrapped in a
+		{"data": ..., "meta": ...} envelope
+	*/
+	Meta map[string]interface{}
+
+	/*
+		Guards values shared between concurrent handlers
+	*/
+	mux sync.Mutex
+
 	/*
 		The request status code
 	*/
@@ -67,14 +84,92 @@ func NewResponse() *Response {
 AddHeader stores a header key/value pair for output with the request
 */
 func (r *Response) AddHeader(header, value string) *Response {
+	r.mux.Lock()
+	defer r.mux.Unlock()
 	if _, ok := r.Headers[header]; !ok {
-		r.Headers[header] = make([]string, 25)
+		r.Headers[header] = make([]string, 0)
 	}
 	r.Headers[header] = append(r.Headers[header], value)
 
 	return r
 }
 
+/*
+AddError stores an error message for output with the request
+*/
+func (r *Response) AddError(err error) *Response {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.Errors = append(r.Errors, err)
+	return r
+}
+
+/*
+SetMeta stores a metadata value for output in the response envelope
+*/
+func (r *Response) SetMeta(key string, value interface{}) *Response {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if nil == r.Meta {
+		r.Meta = make(map[string]interface{})
+	}
+	r.Meta[key] = value
+	return r
+}
+
+/*
+Write sends the stored headers, status code and JSON encoded body to the
+client. If any errors have been stored and the status code is not a success
+code, the body is replaced with a list of the error messages. If any metadata
+has been stored the body is wrapped in an envelope with it.
+*/
+func (r *Response) Write(writer http.ResponseWriter) error {
+	body := r.Body
+	if len(r.Errors) > 0 && r.statusCode >= 400 {
+		messages := make([]string, 0, len(r.Errors))
+		for _, err := range r.Errors {
+			messages = append(messages, err.Error())
+		}
+		body = map[string]interface{}{
+			"status": r.statusMessage,
+			"errors": messages,
+		}
+	} else if len(r.Meta) > 0 {
+		body = map[string]interface{}{
+			"data": body,
+			"meta": r.Meta,
+		}
+	}
+
+	for header, values := range r.Headers {
+		for _, value := range values {
+			writer.Header().Add(header, value)
+		}
+	}
+
+	// These responses can't have a body
+	if http.StatusNoContent == r.statusCode || http.StatusNotModified == r.statusCode {
+		writer.WriteHeader(r.statusCode)
+		return nil
+	}
+
+	output, err := json.Marshal(body)
+	if nil != err {
+		return err
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(r.statusCode)
+	_, err = writer.Write(output)
+	return err
+}
+
+/*
+writeError sends a JSON error response with the given status code
+*/
+func writeError(writer http.ResponseWriter, code int, err error) {
+	NewResponse().SetStatusCode(code).AddError(err).Write(writer)
+}
+
 /*
 StatusCode returns the current request status code
 */
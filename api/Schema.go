@@ -0,0 +1,185 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+/*
+Schema is the subset of JSON Schema used to describe request bodies
+*/
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Enum       []interface{}      `json:"enum,omitempty"`
+	Minimum    *float64           `json:"minimum,omitempty"`
+	Maximum    *float64           `json:"maximum,omitempty"`
+	MinLength  *int               `json:"minLength,omitempty"`
+	MaxLength  *int               `json:"maxLength,omitempty"`
+	MinItems   *int               `json:"minItems,omitempty"`
+	MaxItems   *int               `json:"maxItems,omitempty"`
+}
+
+/*
+Operation describes a method on a route
+*/
+type Operation struct {
+	/*
+		Optional, a short description of the operation
+	*/
+	Summary string
+
+	/*
+		Optional, the schema request bodies must match
+	*/
+	RequestSchema *Schema
+
+	/*
+		Example responses, the first is used by mock mode
+	*/
+	Examples []*Example
+}
+
+/*
+Example is an example response for an Operation
+*/
+type Example struct {
+	Status int
+	Header map[string][]string
+	Body   json.RawMessage
+}
+
+/*
+Describe attaches metadata for a method to the controller
+*/
+func (ctrl *Controller) Describe(method string, operation *Operation) *Controller {
+	if nil == ctrl.Operations {
+		ctrl.Operations = make(map[string]*Operation)
+	}
+	ctrl.Operations[method] = operation
+	return ctrl
+}
+
+/*
+Validate checks a decoded JSON value against the schema and returns a message
+for every violation
+*/
+func (schema *Schema) Validate(value interface{}) []string {
+	return schema.validate("body", value)
+}
+
+func (schema *Schema) validate(path string, value interface{}) []string {
+	if nil == schema {
+		return nil
+	}
+	errs := make([]string, 0)
+
+	if 0 != len(schema.Enum) {
+		found := false
+		for _, allowed := range schema.Enum {
+			if reflect.DeepEqual(normalizeNumber(allowed), normalizeNumber(value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: must be one of %v", path, schema.Enum))
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if !schema.allows("object") {
+			return append(errs, fmt.Sprintf("%s: expected %s, object found", path, schema.Type))
+		}
+		for _, name := range schema.Required {
+			if _, ok := typed[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s: is required", path, name))
+			}
+		}
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if v, ok := typed[name]; ok {
+				errs = append(errs, schema.Properties[name].validate(path+"."+name, v)...)
+			}
+		}
+
+	case []interface{}:
+		if !schema.allows("array") {
+			return append(errs, fmt.Sprintf("%s: expected %s, array found", path, schema.Type))
+		}
+		if nil != schema.MinItems && len(typed) < *schema.MinItems {
+			errs = append(errs, fmt.Sprintf("%s: must have at least %d items", path, *schema.MinItems))
+		}
+		if nil != schema.MaxItems && len(typed) > *schema.MaxItems {
+			errs = append(errs, fmt.Sprintf("%s: must have at most %d items", path, *schema.MaxItems))
+		}
+		for k, v := range typed {
+			errs = append(errs, schema.Items.validate(fmt.Sprintf("%s[%d]", path, k), v)...)
+		}
+
+	case string:
+		if !schema.allows("string") {
+			return append(errs, fmt.Sprintf("%s: expected %s, string found", path, schema.Type))
+		}
+		length := utf8.RuneCountInString(typed)
+		if nil != schema.MinLength && length < *schema.MinLength {
+			errs = append(errs, fmt.Sprintf("%s: must be at least %d characters", path, *schema.MinLength))
+		}
+		if nil != schema.MaxLength && length > *schema.MaxLength {
+			errs = append(errs, fmt.Sprintf("%s: must be at most %d characters", path, *schema.MaxLength))
+		}
+
+	case float64:
+		if !schema.allows("number") && !(schema.allows("integer") && typed == float64(int64(typed))) {
+			return append(errs, fmt.Sprintf("%s: expected %s, number found", path, schema.Type))
+		}
+		if nil != schema.Minimum && typed < *schema.Minimum {
+			errs = append(errs, fmt.Sprintf("%s: must be at least %v", path, *schema.Minimum))
+		}
+		if nil != schema.Maximum && typed > *schema.Maximum {
+			errs = append(errs, fmt.Sprintf("%s: must be at most %v", path, *schema.Maximum))
+		}
+
+	case bool:
+		if !schema.allows("boolean") {
+			return append(errs, fmt.Sprintf("%s: expected %s, boolean found", path, schema.Type))
+		}
+
+	case nil:
+		if !schema.allows("null") {
+			return append(errs, fmt.Sprintf("%s: expected %s, null found", path, schema.Type))
+		}
+	}
+	return errs
+}
+
+/*
+allows reports whether the schema accepts a JSON type, an empty type accepts
+everything
+*/
+func (schema *Schema) allows(typ string) bool {
+	return "" == schema.Type || typ == schema.Type
+}
+
+func normalizeNumber(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	}
+	return value
+}
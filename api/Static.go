@@ -0,0 +1,299 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Static serves files from a directory or an embedded file system
+*/
+type Static struct {
+	/*
+		The URL prefix files are served under, e.g. "/" or "/admin/"
+	*/
+	Prefix string
+
+	/*
+		The file system to serve, see os.DirFS and embed.FS
+	*/
+	FS fs.FS
+
+	/*
+		Cache-Control header value for files, defaults to one hour. The index
+		file is always served with "no-cache"
+	*/
+	CacheControl string
+
+	/*
+		The file served for directories and SPA fallback requests
+	*/
+	Index string
+
+	/*
+		Generate a listing for directories without an index file
+	*/
+	AllowListing bool
+
+	/*
+		Serve the index file for unknown paths without a file extension, so
+		client side routes in a single page application resolve
+	*/
+	SPAFallback bool
+
+	/*
+		Content hashes for files without a modification time, e.g. embedded
+		files
+	*/
+	etags sync.Map
+}
+
+/*
+NewStatic returns a pointer to a new Static serving fsys under prefix
+*/
+func NewStatic(prefix string, fsys fs.FS) *Static {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Static{
+		Prefix:       prefix,
+		FS:           fsys,
+		CacheControl: "public, max-age=3600",
+		Index:        "index.html",
+	}
+}
+
+/*
+NewStaticDir returns a pointer to a new Static serving a directory under
+prefix
+*/
+func NewStaticDir(prefix, dir string) *Static {
+	return NewStatic(prefix, os.DirFS(dir))
+}
+
+/*
+AddStatic adds static file serving to the Api
+*/
+func (api *Api) AddStatic(static *Static) *Api {
+	api.Static = append(api.Static, static)
+	return api
+}
+
+/*
+staticRoute serves a Static in a handler built by BuildHandler, passing
+requests that don't match a file to the controller sharing the prefix, if any
+*/
+type staticRoute struct {
+	static *Static
+	next   http.Handler
+}
+
+/*
+ServeHTTP implements http.Handler
+*/
+func (route *staticRoute) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	route.static.serve(writer, request, route.next)
+}
+
+/*
+ServeHTTP implements http.Handler
+*/
+func (static *Static) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	static.serve(writer, request, nil)
+}
+
+/*
+serve writes a file, or passes the request to next if it doesn't match one
+*/
+func (static *Static) serve(writer http.ResponseWriter, request *http.Request, next http.Handler) {
+	if http.MethodGet != request.Method && http.MethodHead != request.Method {
+		if nil != next {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		writer.Header().Set("Allow", "GET, HEAD")
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", request.Method))
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+request.URL.Path), strings.TrimSuffix(static.Prefix, "/"))
+	name = strings.Trim(name, "/")
+	if "" == name {
+		name = "."
+	}
+
+	if static.serveFile(writer, request, name) {
+		return
+	}
+	if nil != next {
+		next.ServeHTTP(writer, request)
+		return
+	}
+	if static.SPAFallback && "" == path.Ext(name) && static.serveFile(writer, request, static.Index) {
+		return
+	}
+	writeError(writer, http.StatusNotFound, fmt.Errorf("%s not found", request.URL.Path))
+}
+
+/*
+serveFile writes a file or directory, returning false if it does not exist
+*/
+func (static *Static) serveFile(writer http.ResponseWriter, request *http.Request, name string) bool {
+	info, err := fs.Stat(static.FS, name)
+	if nil != err {
+		return false
+	}
+
+	if info.IsDir() {
+		index := path.Join(name, static.Index)
+		if indexInfo, err := fs.Stat(static.FS, index); nil == err && !indexInfo.IsDir() {
+			if !strings.HasSuffix(request.URL.Path, "/") {
+				http.Redirect(writer, request, request.URL.Path+"/", http.StatusMovedPermanently)
+				return true
+			}
+			name, info = index, indexInfo
+		} else if static.AllowListing {
+			static.serveListing(writer, request, name)
+			return true
+		} else {
+			return false
+		}
+	}
+
+	// Prefer a precompressed variant if the client accepts it
+	served := name
+	var file fs.File
+	if acceptsEncoding(request.Header.Get("Accept-Encoding"), "gzip") {
+		if gzInfo, err := fs.Stat(static.FS, name+".gz"); nil == err && !gzInfo.IsDir() {
+			if gz, err := static.FS.Open(name + ".gz"); nil == err {
+				file, served, info = gz, name+".gz", gzInfo
+			}
+		}
+	}
+	if nil == file {
+		if file, err = static.FS.Open(name); nil != err {
+			return false
+		}
+	}
+	defer file.Close()
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if nil != err {
+			return false
+		}
+		content = bytes.NewReader(data)
+	}
+
+	writer.Header().Add("Vary", "Accept-Encoding")
+	if served != name {
+		writer.Header().Set("Content-Encoding", "gzip")
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); "" != contentType {
+		writer.Header().Set("Content-Type", contentType)
+	}
+	if name == static.Index || strings.HasSuffix(name, "/"+static.Index) {
+		writer.Header().Set("Cache-Control", "no-cache")
+	} else if "" != static.CacheControl {
+		writer.Header().Set("Cache-Control", static.CacheControl)
+	}
+	if info.ModTime().IsZero() {
+		writer.Header().Set("ETag", static.etag(served, content))
+	}
+
+	http.ServeContent(writer, request, name, info.ModTime(), content)
+	return true
+}
+
+/*
+etag returns a cached content hash for a file
+*/
+func (static *Static) etag(name string, content io.ReadSeeker) string {
+	if etag, ok := static.etags.Load(name); ok {
+		return etag.(string)
+	}
+	hash := sha256.New()
+	io.Copy(hash, content)
+	content.Seek(0, io.SeekStart)
+	etag := `"` + hex.EncodeToString(hash.Sum(nil))[:16] + `"`
+	static.etags.Store(name, etag)
+	return etag
+}
+
+/*
+acceptsEncoding reports whether an Accept-Encoding header accepts an
+encoding. A q-value of 0 refuses it, and the encoding named takes precedence
+over "*"
+*/
+func acceptsEncoding(header, encoding string) bool {
+	named, wildcard := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(part, ";")
+		token = strings.TrimSpace(token)
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(param, "=")
+			if !ok || !strings.EqualFold("q", strings.TrimSpace(key)) {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if nil != err {
+				parsed = 0
+			}
+			q = parsed
+		}
+		if strings.EqualFold(encoding, token) {
+			named = q
+		} else if "*" == token {
+			wildcard = q
+		}
+	}
+	if named >= 0 {
+		return named > 0
+	}
+	return wildcard > 0
+}
+
+/*
+serveListing writes an HTML listing of a directory
+*/
+func (static *Static) serveListing(writer http.ResponseWriter, request *http.Request, name string) {
+	entries, err := fs.ReadDir(static.FS, name)
+	if nil != err {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	base := strings.TrimSuffix(request.URL.Path, "/") + "/"
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<!doctype html>\n<title>%s</title>\n<ul>\n", html.EscapeString(base))
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		fmt.Fprintf(&buf, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(base+entryName), html.EscapeString(entryName))
+	}
+	buf.WriteString("</ul>\n")
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(writer, request, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
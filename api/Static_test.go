@@ -0,0 +1,163 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func staticServer(configure func(*Static)) http.Handler {
+	static := NewStatic("/", fstest.MapFS{
+		"index.html":         {Data: []byte("<html>app</html>")},
+		"app.js":             {Data: []byte("console.log('app')")},
+		"app.js.gz":          {Data: []byte("gzipped")},
+		"assets/logo.txt":    {Data: []byte("0123456789")},
+		"docs/guide.txt":     {Data: []byte("guide")},
+		"docs/sub/notes.txt": {Data: []byte("notes")},
+	})
+	if nil != configure {
+		configure(static)
+	}
+	server := NewServer()
+	server.AddStatic(static)
+	server.AddHandler("/api/", func(request *http.Request, response *Response) {
+		response.Channel <- "api"
+		response.Channel <- response.Done()
+	})
+	return server.BuildHandler()
+}
+
+func TestStaticFile(t *testing.T) {
+	handler := staticServer(nil)
+
+	recorder := serve(handler, "GET", "/assets/logo.txt", "", nil)
+	if "0123456789" != recorder.Body.String() || "public, max-age=3600" != recorder.Header().Get("Cache-Control") {
+		t.Errorf("unexpected response %d %v %q", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+	etag := recorder.Header().Get("ETag")
+	if "" == etag {
+		t.Fatalf("expected an ETag header")
+	}
+	if recorder := serve(handler, "GET", "/assets/logo.txt", "", map[string]string{"If-None-Match": etag}); http.StatusNotModified != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusNotModified, recorder.Code)
+	}
+
+	recorder = serve(handler, "GET", "/", "", nil)
+	if "<html>app</html>" != recorder.Body.String() || "no-cache" != recorder.Header().Get("Cache-Control") {
+		t.Errorf("expected uncached index, %v %q found", recorder.Header(), recorder.Body.String())
+	}
+}
+
+func TestStaticRange(t *testing.T) {
+	recorder := serve(staticServer(nil), "GET", "/assets/logo.txt", "", map[string]string{"Range": "bytes=2-4"})
+	if http.StatusPartialContent != recorder.Code || "234" != recorder.Body.String() {
+		t.Errorf("expected partial content, %d %q found", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	recorder := serve(staticServer(nil), "GET", "/app.js", "", map[string]string{"Accept-Encoding": "gzip, br"})
+	if "gzipped" != recorder.Body.String() || "gzip" != recorder.Header().Get("Content-Encoding") {
+		t.Errorf("expected gzip variant, %v %q found", recorder.Header(), recorder.Body.String())
+	}
+	if !strings.Contains(recorder.Header().Get("Content-Type"), "javascript") {
+		t.Errorf("expected javascript content type, %q found", recorder.Header().Get("Content-Type"))
+	}
+}
+
+/*
+gzOpenFailFS fails to open precompressed files it can stat
+*/
+type gzOpenFailFS struct {
+	fstest.MapFS
+}
+
+func (fsys gzOpenFailFS) Open(name string) (fs.File, error) {
+	if strings.HasSuffix(name, ".gz") {
+		return nil, fs.ErrPermission
+	}
+	return fsys.MapFS.Open(name)
+}
+
+func TestStaticAcceptEncoding(t *testing.T) {
+	handler := staticServer(nil)
+	for header, expect := range map[string]string{
+		"gzip;q=0":            "",
+		"gzip; q=0.0, br":     "",
+		"*;q=0.5":             "gzip",
+		"*, gzip;q=0":         "",
+		"br;q=1, GZIP;q=0.1":  "gzip",
+		"identity, deflate":   "",
+		"gzip;level=1;q=0.01": "gzip",
+	} {
+		recorder := serve(handler, "GET", "/app.js", "", map[string]string{"Accept-Encoding": header})
+		if expect != recorder.Header().Get("Content-Encoding") {
+			t.Errorf("%q: expected Content-Encoding %q, %q found", header, expect, recorder.Header().Get("Content-Encoding"))
+		}
+	}
+
+	server := NewServer()
+	server.AddStatic(NewStatic("/", gzOpenFailFS{fstest.MapFS{
+		"app.js":    {Data: []byte("plain")},
+		"app.js.gz": {Data: []byte("gzipped")},
+	}}))
+	recorder := serve(server.BuildHandler(), "GET", "/app.js", "", map[string]string{"Accept-Encoding": "gzip"})
+	if "plain" != recorder.Body.String() || "" != recorder.Header().Get("Content-Encoding") {
+		t.Errorf("expected the plain file without Content-Encoding, %v %q found", recorder.Header(), recorder.Body.String())
+	}
+}
+
+func TestStaticListing(t *testing.T) {
+	if recorder := serve(staticServer(nil), "GET", "/docs/", "", nil); http.StatusNotFound != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusNotFound, recorder.Code)
+	}
+
+	recorder := serve(staticServer(func(static *Static) {
+		static.AllowListing = true
+	}), "GET", "/docs/", "", nil)
+	if !strings.Contains(recorder.Body.String(), `href="/docs/sub/"`) {
+		t.Errorf("expected a directory listing, %q found", recorder.Body.String())
+	}
+}
+
+func TestStaticSPAFallback(t *testing.T) {
+	handler := staticServer(func(static *Static) {
+		static.SPAFallback = true
+	})
+
+	if recorder := serve(handler, "GET", "/users/42", "", nil); "<html>app</html>" != recorder.Body.String() {
+		t.Errorf("expected index fallback, %d %q found", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serve(handler, "GET", "/missing.js", "", nil); http.StatusNotFound != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusNotFound, recorder.Code)
+	}
+	if recorder := serve(handler, "GET", "/api/users", "", nil); `["api"]` != recorder.Body.String() {
+		t.Errorf("expected api response, %q found", recorder.Body.String())
+	}
+}
+
+func TestStaticReload(t *testing.T) {
+	server := NewServer()
+	server.AddStatic(NewStatic("/", fstest.MapFS{"index.html": {Data: []byte("index")}}))
+	server.AddHandler("/", func(request *http.Request, response *Response) {
+		response.Channel <- "api"
+		response.Channel <- response.Done()
+	})
+	first := server.BuildHandler()
+
+	server.config = DefaultConfig()
+	server.config.Routes = map[string]*RouteConfig{"/": {Disabled: true}}
+	second := server.BuildHandler()
+
+	if recorder := serve(first, "GET", "/users", "", nil); `["api"]` != recorder.Body.String() {
+		t.Errorf("expected the previous handler to keep its controller, %s found", recorder.Body.String())
+	}
+	if recorder := serve(second, "GET", "/users", "", nil); http.StatusNotFound != recorder.Code {
+		t.Errorf("expected 404 from the new handler, %d found", recorder.Code)
+	}
+}
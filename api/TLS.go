@@ -0,0 +1,165 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+DefaultCertReloadInterval is how often certificate files are checked for
+changes if TLSConfig.ReloadInterval is not set
+*/
+const DefaultCertReloadInterval = 10 * time.Second
+
+/*
+TLSConfig defines how an Api serves HTTPS
+*/
+type TLSConfig struct {
+	/*
+		PEM encoded certificate and private key files. The files are watched
+		and reloaded when they change
+	*/
+	CertFile string
+	KeyFile  string
+
+	/*
+		The minimum TLS version to accept, defaults to tls.VersionTLS12
+	*/
+	MinVersion uint16
+
+	/*
+		Optional, PEM encoded CA certificates used to verify client
+		certificates
+	*/
+	ClientCAFile string
+
+	/*
+		The client certificate policy. Defaults to
+		tls.RequireAndVerifyClientCert if ClientCAFile is set
+	*/
+	ClientAuth tls.ClientAuthType
+
+	/*
+		How often the certificate files are checked for changes
+	*/
+	ReloadInterval time.Duration
+}
+
+/*
+Build validates the configuration, loads the certificates and returns a
+*tls.Config that reloads the certificate when the files change
+*/
+func (cfg *TLSConfig) Build() (*tls.Config, error) {
+	if "" == cfg.CertFile || "" == cfg.KeyFile {
+		return nil, fmt.Errorf("tls: both a certificate and key file are required")
+	}
+
+	reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile, cfg.ReloadInterval)
+	if nil != err {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     cfg.MinVersion,
+		ClientAuth:     cfg.ClientAuth,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if 0 == config.MinVersion {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	if "" != cfg.ClientCAFile {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if nil != err {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in '%s'", cfg.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		if tls.NoClientCert == config.ClientAuth {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, nil
+}
+
+/*
+certReloader serves a certificate, reloading it when the files on disk change
+*/
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mux     sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	if 0 == interval {
+		interval = DefaultCertReloadInterval
+	}
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := reloader.reload(); nil != err {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+/*
+GetCertificate implements tls.Config.GetCertificate
+*/
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mux.Lock()
+	defer cr.mux.Unlock()
+	if time.Since(cr.checked) >= cr.interval {
+		if err := cr.reload(); nil != err {
+			log.Printf("tls: keeping current certificate: %v", err)
+		}
+	}
+	return cr.cert, nil
+}
+
+/*
+reload loads the certificate if either file has been modified since it was
+last loaded
+*/
+func (cr *certReloader) reload() error {
+	cr.checked = time.Now()
+
+	var modTime time.Time
+	for _, file := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(file)
+		if nil != err {
+			return err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if nil != cr.cert && modTime.Equal(cr.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if nil != err {
+		return err
+	}
+	cr.cert = &cert
+	cr.modTime = modTime
+	return nil
+}
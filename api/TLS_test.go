@@ -0,0 +1,191 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func generateCert(t *testing.T, serial int64, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	parentCert, parentKey := template, key
+	if nil != parent {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if nil != err {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeCert(t *testing.T, dir string, cert *testCert, modTime time.Time) (string, string) {
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	for file, data := range map[string][]byte{certFile: cert.certPEM, keyFile: cert.keyPEM} {
+		if err := os.WriteFile(file, data, 0600); nil != err {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, modTime, modTime)
+	}
+	return certFile, keyFile
+}
+
+func startServer(t *testing.T, api *Api) (string, func()) {
+	server, err := api.NewHTTPServer("")
+	if nil != err {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil != server.TLSConfig {
+		go server.ServeTLS(listener, "", "")
+	} else {
+		go server.Serve(listener)
+	}
+	return listener.Addr().String(), func() { server.Close() }
+}
+
+func TestTLSHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	ca := generateCert(t, 1, true, nil)
+	certFile, keyFile := writeCert(t, dir, generateCert(t, 2, false, ca), time.Now())
+
+	api := NewServer()
+	api.TLS = &TLSConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Millisecond}
+	addr, stop := startServer(t, api)
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+
+	response, err := client.Get("https://" + addr + HealthEndpoint)
+	if nil != err {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if 2 != response.ProtoMajor {
+		t.Errorf("expected HTTP/2, %s found", response.Proto)
+	}
+	if 0 != response.TLS.PeerCertificates[0].SerialNumber.Cmp(big.NewInt(2)) {
+		t.Errorf("expected certificate serial 2")
+	}
+
+	// Replace the certificate and expect new connections to use it
+	writeCert(t, dir, generateCert(t, 3, false, ca), time.Now().Add(time.Minute))
+	time.Sleep(5 * time.Millisecond)
+	client.CloseIdleConnections()
+	response, err = client.Get("https://" + addr + HealthEndpoint)
+	if nil != err {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if 0 != response.TLS.PeerCertificates[0].SerialNumber.Cmp(big.NewInt(3)) {
+		t.Errorf("expected reloaded certificate serial 3")
+	}
+}
+
+func TestTLSClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := generateCert(t, 1, true, nil)
+	certFile, keyFile := writeCert(t, dir, generateCert(t, 2, false, ca), time.Now())
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, ca.certPEM, 0600)
+
+	api := NewServer()
+	api.TLS = &TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, MinVersion: tls.VersionTLS13}
+	addr, stop := startServer(t, api)
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if response, err := client.Get("https://" + addr + HealthEndpoint); nil == err {
+		response.Body.Close()
+		t.Errorf("expected a request without a client certificate to fail")
+	}
+
+	clientCert := generateCert(t, 4, false, ca)
+	pair, _ := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{pair},
+	}}}
+	response, err := client.Get("https://" + addr + HealthEndpoint)
+	if nil != err {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if tls.VersionTLS13 != response.TLS.Version {
+		t.Errorf("expected TLS 1.3, %x found", response.TLS.Version)
+	}
+}
+
+func TestH2C(t *testing.T) {
+	api := NewServer()
+	api.H2C = true
+	addr, stop := startServer(t, api)
+	defer stop()
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	response, err := client.Get("http://" + addr + HealthEndpoint)
+	if nil != err {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if 2 != response.ProtoMajor {
+		t.Errorf("expected HTTP/2, %s found", response.Proto)
+	}
+}
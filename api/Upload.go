@@ -0,0 +1,330 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+/*
+UploadConfig enables multipart/form-data parsing for a Controller. The body is
+parsed once, before the handlers run, and every handler can read the result
+with GetUpload
+*/
+type UploadConfig struct {
+	/*
+		The largest file accepted, larger files return 413
+	*/
+	MaxFileBytes int64
+
+	/*
+		The largest non-file field accepted, larger fields return 413
+	*/
+	MaxFieldBytes int64
+
+	/*
+		The most files accepted in a single request
+	*/
+	MaxFiles int
+
+	/*
+		Optional, accepted content types, e.g. "image/png" or "image/*".
+		Types are detected from the file content, other files return 415
+	*/
+	AllowedTypes []string
+
+	/*
+		Directory for temporary files, defaults to os.TempDir(). Temporary
+		files are removed once all handlers have completed
+	*/
+	Dir string
+
+	/*
+		Optional, receives file contents instead of a temporary file
+	*/
+	Sink func(file *UploadedFile) (io.WriteCloser, error)
+}
+
+/*
+UploadedFile describes a file received in a multipart request
+*/
+type UploadedFile struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+
+	/*
+		The temporary file holding the contents, empty if a Sink was used
+	*/
+	Path string `json:"-"`
+}
+
+/*
+Open opens the temporary file holding the contents
+*/
+func (file *UploadedFile) Open() (*os.File, error) {
+	if "" == file.Path {
+		return nil, fmt.Errorf("'%s' was written to a sink", file.Filename)
+	}
+	return os.Open(file.Path)
+}
+
+/*
+Upload holds the parsed fields and files of a multipart request
+*/
+type Upload struct {
+	Fields map[string][]string
+	Files  map[string][]*UploadedFile
+}
+
+/*
+FormValue returns the first value of a field
+*/
+func (upload *Upload) FormValue(name string) string {
+	if values := upload.Fields[name]; 0 != len(values) {
+		return values[0]
+	}
+	return ""
+}
+
+/*
+File returns the first file uploaded in a field
+*/
+func (upload *Upload) File(name string) *UploadedFile {
+	if files := upload.Files[name]; 0 != len(files) {
+		return files[0]
+	}
+	return nil
+}
+
+/*
+cleanup removes the temporary files
+*/
+func (upload *Upload) cleanup() {
+	for _, files := range upload.Files {
+		for _, file := range files {
+			if "" != file.Path {
+				os.Remove(file.Path)
+			}
+		}
+	}
+}
+
+/*
+StatusError is an error with an associated HTTP status code
+*/
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+/*
+Error implements error
+*/
+func (err *StatusError) Error() string {
+	return err.Err.Error()
+}
+
+/*
+Unwrap returns the underlying error
+*/
+func (err *StatusError) Unwrap() error {
+	return err.Err
+}
+
+type uploadKey struct{}
+
+/*
+GetUpload returns the parsed multipart body of a request, or nil if the
+controller doesn't accept uploads or the request isn't multipart
+*/
+func GetUpload(request *http.Request) *Upload {
+	upload, _ := request.Context().Value(uploadKey{}).(*Upload)
+	return upload
+}
+
+/*
+isMultipart reports whether a request has a multipart/form-data body
+*/
+func isMultipart(request *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	return nil == err && "multipart/form-data" == mediaType
+}
+
+/*
+parseUpload streams the parts of a multipart request to temporary files or the
+configured sink
+*/
+func (cfg *UploadConfig) parseUpload(request *http.Request) (*Upload, error) {
+	reader, err := request.MultipartReader()
+	if nil != err {
+		return nil, &StatusError{Status: http.StatusBadRequest, Err: err}
+	}
+
+	upload := &Upload{
+		Fields: make(map[string][]string),
+		Files:  make(map[string][]*UploadedFile),
+	}
+	files := 0
+	for {
+		part, err := reader.NextPart()
+		if io.EOF == err {
+			return upload, nil
+		}
+		if nil != err {
+			upload.cleanup()
+			return nil, uploadReadError(err)
+		}
+
+		if "" == part.FileName() {
+			value, err := readLimited(part, cfg.MaxFieldBytes)
+			if nil != err {
+				upload.cleanup()
+				return nil, err
+			}
+			upload.Fields[part.FormName()] = append(upload.Fields[part.FormName()], string(value))
+			continue
+		}
+
+		files++
+		if cfg.MaxFiles > 0 && files > cfg.MaxFiles {
+			upload.cleanup()
+			return nil, &StatusError{Status: http.StatusRequestEntityTooLarge, Err: fmt.Errorf("more than %d files uploaded", cfg.MaxFiles)}
+		}
+		file, err := cfg.saveFile(part)
+		if nil != err {
+			upload.cleanup()
+			return nil, err
+		}
+		upload.Files[file.Field] = append(upload.Files[file.Field], file)
+	}
+}
+
+func (cfg *UploadConfig) saveFile(part *multipart.Part) (*UploadedFile, error) {
+	file := &UploadedFile{Field: part.FormName(), Filename: path.Base(part.FileName())}
+
+	// Detect the content type from the first bytes of the file
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if nil != err && io.ErrUnexpectedEOF != err && io.EOF != err {
+		return nil, uploadReadError(err)
+	}
+	head = head[:n]
+	file.ContentType = http.DetectContentType(head)
+	if declared := part.Header.Get("Content-Type"); "application/octet-stream" == file.ContentType && "" != declared {
+		file.ContentType = declared
+	}
+	if !cfg.allowsType(file.ContentType) {
+		return nil, &StatusError{Status: http.StatusUnsupportedMediaType, Err: fmt.Errorf("'%s' has unsupported type %s", file.Filename, file.ContentType)}
+	}
+
+	var sink io.WriteCloser
+	if nil != cfg.Sink {
+		sink, err = cfg.Sink(file)
+	} else {
+		var tmp *os.File
+		tmp, err = os.CreateTemp(cfg.Dir, "upload-*")
+		if nil == err {
+			file.Path = tmp.Name()
+			sink = tmp
+		}
+	}
+	if nil != err {
+		return nil, &StatusError{Status: http.StatusInternalServerError, Err: err}
+	}
+
+	hash := sha256.New()
+	var content io.Reader = io.MultiReader(bytes.NewReader(head), part)
+	if cfg.MaxFileBytes > 0 {
+		content = io.LimitReader(content, cfg.MaxFileBytes+1)
+	}
+	file.Size, err = io.Copy(io.MultiWriter(sink, hash), content)
+	if closeErr := sink.Close(); nil == err {
+		err = closeErr
+	}
+	if nil == err && cfg.MaxFileBytes > 0 && file.Size > cfg.MaxFileBytes {
+		err = &StatusError{Status: http.StatusRequestEntityTooLarge, Err: fmt.Errorf("'%s' exceeds %d bytes", file.Filename, cfg.MaxFileBytes)}
+	}
+	if nil != err {
+		if "" != file.Path {
+			os.Remove(file.Path)
+		}
+		return nil, uploadReadError(err)
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+func (cfg *UploadConfig) allowsType(contentType string) bool {
+	if 0 == len(cfg.AllowedTypes) {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, allowed := range cfg.AllowedTypes {
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func readLimited(reader io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		data, err := io.ReadAll(reader)
+		if nil != err {
+			return nil, uploadReadError(err)
+		}
+		return data, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if nil != err {
+		return nil, uploadReadError(err)
+	}
+	if int64(len(data)) > limit {
+		return nil, &StatusError{Status: http.StatusRequestEntityTooLarge, Err: fmt.Errorf("form field exceeds %d bytes", limit)}
+	}
+	return data, nil
+}
+
+/*
+uploadReadError maps body read errors to a StatusError, the limitedBody
+wrapping the request records the cause
+*/
+func uploadReadError(err error) error {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return err
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &StatusError{Status: http.StatusRequestEntityTooLarge, Err: err}
+	}
+	return &StatusError{Status: http.StatusBadRequest, Err: err}
+}
+
+/*
+withUpload parses a multipart request and returns it with the upload attached
+to its context
+*/
+func (cfg *UploadConfig) withUpload(request *http.Request) (*http.Request, *Upload, error) {
+	upload, err := cfg.parseUpload(request)
+	if nil != err {
+		return request, nil, err
+	}
+	return request.WithContext(context.WithValue(request.Context(), uploadKey{}, upload)), upload, nil
+}
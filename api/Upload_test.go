@@ -0,0 +1,125 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func multipartRequest(t *testing.T, fields map[string]string, files map[string]string) *http.Request {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	for name, content := range files {
+		part, _ := writer.CreateFormFile(name, name+".txt")
+		io.WriteString(part, content)
+	}
+	writer.Close()
+	request := httptest.NewRequest("POST", "/", &buf)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+func TestUploadSharedWithHandlers(t *testing.T) {
+	var mux sync.Mutex
+	paths := make([]string, 0)
+	handler := func(request *http.Request, response *Response) {
+		upload := GetUpload(request)
+		file := upload.File("doc")
+		reader, err := file.Open()
+		if nil != err {
+			t.Error(err)
+		} else {
+			data, _ := io.ReadAll(reader)
+			reader.Close()
+			response.Channel <- upload.FormValue("title") + ":" + string(data) + ":" + file.ContentType
+		}
+		mux.Lock()
+		paths = append(paths, file.Path)
+		mux.Unlock()
+		response.Channel <- response.Done()
+	}
+
+	ctrl := NewController("/")
+	ctrl.Uploads = &UploadConfig{Dir: t.TempDir()}
+	ctrl.AddHandler(handler).AddHandler(handler)
+
+	recorder := httptest.NewRecorder()
+	ctrl.HandlerFunc()(recorder, multipartRequest(t, map[string]string{"title": "a"}, map[string]string{"doc": "hello"}))
+	expect := `["a:hello:text/plain; charset=utf-8","a:hello:text/plain; charset=utf-8"]`
+	if expect != recorder.Body.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected temporary file %s to be removed", path)
+		}
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	ctrl := NewController("/")
+	ctrl.Uploads = &UploadConfig{Dir: t.TempDir(), MaxFileBytes: 4, AllowedTypes: []string{"text/*"}}
+	ctrl.AddHandler(func(request *http.Request, response *Response) {
+		response.Channel <- response.Done()
+	})
+
+	recorder := httptest.NewRecorder()
+	ctrl.HandlerFunc()(recorder, multipartRequest(t, nil, map[string]string{"doc": "hello"}))
+	if http.StatusRequestEntityTooLarge != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	ctrl.HandlerFunc()(recorder, multipartRequest(t, nil, map[string]string{"doc": "\x00\x01\x02"}))
+	if http.StatusUnsupportedMediaType != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusUnsupportedMediaType, recorder.Code)
+	}
+}
+
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (sink *bufferSink) Close() error {
+	return nil
+}
+
+func TestUploadSink(t *testing.T) {
+	sink := new(bufferSink)
+	ctrl := NewController("/")
+	ctrl.Uploads = &UploadConfig{Sink: func(file *UploadedFile) (io.WriteCloser, error) {
+		return sink, nil
+	}}
+	ctrl.AddHandler(func(request *http.Request, response *Response) {
+		file := GetUpload(request).File("doc")
+		response.Channel <- file.SHA256
+		response.Channel <- file.Size
+		response.Channel <- response.Done()
+	})
+
+	recorder := httptest.NewRecorder()
+	ctrl.HandlerFunc()(recorder, multipartRequest(t, nil, map[string]string{"doc": "hello"}))
+	expect := `["2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",5]`
+	if expect != recorder.Body.String() || "hello" != sink.String() {
+		t.Errorf("expected %s, %s found", expect, recorder.Body.String())
+	}
+}
+
+func TestControllerWithoutHandlers(t *testing.T) {
+	recorder := serve(http.HandlerFunc(NewController("/").HandlerFunc()), "GET", "/", "", nil)
+	if "null" != strings.TrimSpace(recorder.Body.String()) {
+		t.Errorf("expected empty response, %s found", recorder.Body.String())
+	}
+}
@@ -0,0 +1,328 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Upstream is an HTTP client for a service called by handlers. Calls are guarded
+by a circuit breaker, retried with jittered exponential backoff, optionally
+hedged, and bounded by the inbound request's context. Only idempotent requests
+are retried and hedged, see Retryable.
+*/
+type Upstream struct {
+	/*
+		Name of the upstream, used in metrics and errors
+	*/
+	Name string
+
+	/*
+		Prepended to every request path
+	*/
+	BaseURL string
+
+	/*
+		The HTTP client used to make requests
+	*/
+	Client *http.Client
+
+	/*
+		Optional, guards calls to the upstream
+	*/
+	Breaker *CircuitBreaker
+
+	/*
+		The number of additional attempts after a failed call
+	*/
+	Retries int
+
+	/*
+		The initial and maximum delay between retries
+	*/
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+
+	/*
+		If set, a second concurrent attempt is made when the first hasn't
+		completed within this time, and the first response is used
+	*/
+	HedgeAfter time.Duration
+
+	/*
+		Upper bound for each attempt, further limited by the inbound request
+		deadline
+	*/
+	Timeout time.Duration
+}
+
+/*
+UpstreamResponse is a fully read upstream response
+*/
+type UpstreamResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+/*
+UpstreamError is returned when an upstream call fails after all attempts
+*/
+type UpstreamError struct {
+	Upstream   string
+	StatusCode int
+	Err        error
+}
+
+/*
+Error implements error
+*/
+func (err *UpstreamError) Error() string {
+	if nil != err.Err {
+		return fmt.Sprintf("upstream '%s': %v", err.Upstream, err.Err)
+	}
+	return fmt.Sprintf("upstream '%s': status %d", err.Upstream, err.StatusCode)
+}
+
+/*
+Unwrap returns the underlying error
+*/
+func (err *UpstreamError) Unwrap() error {
+	return err.Err
+}
+
+type retryKey struct{}
+
+/*
+Retryable returns a context that lets the upstream call made with it be
+retried and hedged whatever its method. Use it for calls that are safe to
+repeat, e.g. a POST the upstream deduplicates
+*/
+func Retryable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+/*
+retryable reports whether a call can be repeated: its method is idempotent,
+it has an Idempotency-Key header or the caller opted in with Retryable
+*/
+func retryable(ctx context.Context, method string, header http.Header) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if "" != header.Get(IdempotencyHeader) {
+		return true
+	}
+	optIn, _ := ctx.Value(retryKey{}).(bool)
+	return optIn
+}
+
+/*
+NewUpstream returns a pointer to a new Upstream with a circuit breaker and
+default retry settings
+*/
+func NewUpstream(name, baseURL string) *Upstream {
+	return &Upstream{
+		Name:        name,
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		Client:      http.DefaultClient,
+		Breaker:     NewCircuitBreaker(5, 30*time.Second),
+		Retries:     2,
+		BackoffBase: 50 * time.Millisecond,
+		BackoffMax:  time.Second,
+		Timeout:     10 * time.Second,
+	}
+}
+
+/*
+Get calls the upstream with a GET request in the context of an inbound request
+*/
+func (up *Upstream) Get(inbound *http.Request, path string) (*UpstreamResponse, error) {
+	return up.Do(inbound.Context(), http.MethodGet, path, nil, nil)
+}
+
+/*
+Do calls the upstream. Network errors and 5xx responses are reported to the
+circuit breaker and retried if the call is retryable, other responses are
+returned as-is
+*/
+func (up *Upstream) Do(ctx context.Context, method, path string, header http.Header, body []byte) (*UpstreamResponse, error) {
+	retries := up.Retries
+	repeat := retryable(ctx, method, header)
+	if !repeat {
+		retries = 0
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(up.backoff(attempt)):
+			case <-ctx.Done():
+				return nil, &UpstreamError{Upstream: up.Name, Err: ctx.Err()}
+			}
+		}
+
+		response, err := up.hedge(ctx, repeat, method, path, header, body)
+		if nil == err {
+			return response, nil
+		}
+		lastErr = err
+		if errors.Is(err, ErrCircuitOpen) || nil != ctx.Err() {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+/*
+Metrics returns the circuit breaker metrics for the upstream
+*/
+func (up *Upstream) Metrics() BreakerMetrics {
+	if nil == up.Breaker {
+		return BreakerMetrics{State: BreakerClosed.String()}
+	}
+	return up.Breaker.Metrics()
+}
+
+/*
+backoff returns a random delay up to BackoffBase * 2^attempt, capped at
+BackoffMax
+*/
+func (up *Upstream) backoff(attempt int) time.Duration {
+	delay := up.BackoffBase << uint(attempt-1)
+	if delay <= 0 || (up.BackoffMax > 0 && delay > up.BackoffMax) {
+		delay = up.BackoffMax
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+/*
+hedge makes an attempt, starting a second concurrent attempt if the first is
+slower than HedgeAfter and the call can be repeated, and returns the first
+successful result
+*/
+func (up *Upstream) hedge(ctx context.Context, repeat bool, method, path string, header http.Header, body []byte) (*UpstreamResponse, error) {
+	type result struct {
+		response *UpstreamResponse
+		err      error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	attempts := 1
+	if up.HedgeAfter > 0 && repeat {
+		attempts = 2
+	}
+	results := make(chan result, attempts)
+	launch := func() {
+		go func() {
+			response, err := up.attempt(ctx, method, path, header, body)
+			results <- result{response, err}
+		}()
+	}
+
+	launch()
+	var hedge <-chan time.Time
+	if attempts > 1 {
+		timer := time.NewTimer(up.HedgeAfter)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var lastErr error
+	for pending := 1; pending > 0; {
+		select {
+		case <-hedge:
+			hedge = nil
+			pending++
+			launch()
+		case res := <-results:
+			pending--
+			if nil == res.err {
+				return res.response, nil
+			}
+			lastErr = res.err
+			// wait for a hedged attempt that has already started
+		}
+	}
+	return nil, lastErr
+}
+
+/*
+attempt makes a single call, guarded by the circuit breaker
+*/
+func (up *Upstream) attempt(ctx context.Context, method, path string, header http.Header, body []byte) (*UpstreamResponse, error) {
+	if nil != up.Breaker {
+		if err := up.Breaker.Allow(); nil != err {
+			return nil, err
+		}
+	}
+
+	if up.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, up.Timeout)
+		defer cancel()
+	}
+
+	response, err := up.send(ctx, method, path, header, body)
+	if nil == err && response.StatusCode >= 500 {
+		err = &UpstreamError{Upstream: up.Name, StatusCode: response.StatusCode}
+	}
+	if nil != up.Breaker {
+		if nil == err {
+			up.Breaker.Success()
+		} else if context.Canceled == ctx.Err() {
+			// cancelled hedges aren't failures of the upstream
+			up.Breaker.release()
+		} else {
+			up.Breaker.Failure()
+		}
+	}
+	return response, err
+}
+
+func (up *Upstream) send(ctx context.Context, method, path string, header http.Header, body []byte) (*UpstreamResponse, error) {
+	var reader io.Reader
+	if nil != body {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, up.BaseURL+path, reader)
+	if nil != err {
+		return nil, &UpstreamError{Upstream: up.Name, Err: err}
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+
+	client := up.Client
+	if nil == client {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if nil != err {
+		return nil, &UpstreamError{Upstream: up.Name, Err: err}
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if nil != err {
+		return nil, &UpstreamError{Upstream: up.Name, Err: err}
+	}
+	return &UpstreamResponse{StatusCode: response.StatusCode, Header: response.Header, Body: data}, nil
+}
@@ -0,0 +1,164 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	cb := NewCircuitBreaker(2, 20*time.Millisecond)
+
+	for a := 0; a < 2; a++ {
+		if err := cb.Allow(); nil != err {
+			t.Fatalf("expected closed breaker to allow calls, %v found", err)
+		}
+		cb.Failure()
+	}
+	if BreakerOpen != cb.State() || ErrCircuitOpen != cb.Allow() {
+		t.Fatalf("expected open breaker, %s found", cb.State())
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if err := cb.Allow(); nil != err {
+		t.Fatalf("expected half-open breaker to allow a probe, %v found", err)
+	}
+	if ErrCircuitOpen != cb.Allow() {
+		t.Errorf("expected half-open breaker to allow a single probe")
+	}
+	cb.Success()
+	if BreakerClosed != cb.State() {
+		t.Errorf("expected closed breaker, %s found", cb.State())
+	}
+
+	metrics := cb.Metrics()
+	if 2 != metrics.Failures || 1 != metrics.Successes || 2 != metrics.Rejected || 1 != metrics.Opened {
+		t.Errorf("unexpected metrics %+v", metrics)
+	}
+}
+
+func TestUpstreamRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			writer.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		writer.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	up := NewUpstream("test", server.URL)
+	up.BackoffBase = time.Millisecond
+	response, err := up.Do(context.Background(), "GET", "/", nil, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "ok" != string(response.Body) || 3 != calls {
+		t.Errorf("expected success on third attempt, %q after %d calls found", response.Body, calls)
+	}
+}
+
+func TestUpstreamRetryUnsafe(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writer.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	up := NewUpstream("test", server.URL)
+	up.BackoffBase = time.Millisecond
+	up.HedgeAfter = time.Nanosecond
+	up.Breaker = nil
+	if _, err := up.Do(context.Background(), "POST", "/", nil, []byte("{}")); nil == err || 1 != calls {
+		t.Errorf("expected a single POST attempt, %d calls %v found", calls, err)
+	}
+
+	// Callers can opt in for calls that are safe to repeat
+	atomic.StoreInt32(&calls, 0)
+	header := http.Header{IdempotencyHeader: []string{"key-1"}}
+	if _, err := up.Do(context.Background(), "PATCH", "/", header, nil); nil == err || atomic.LoadInt32(&calls) < 3 {
+		t.Errorf("expected PATCH with an idempotency key to be retried, %d calls found", calls)
+	}
+	atomic.StoreInt32(&calls, 0)
+	if _, err := up.Do(Retryable(context.Background()), "POST", "/", nil, nil); nil == err || atomic.LoadInt32(&calls) < 3 {
+		t.Errorf("expected a Retryable POST to be retried, %d calls found", calls)
+	}
+}
+
+func TestUpstreamBreakerOpens(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	up := NewUpstream("test", server.URL)
+	up.Breaker = NewCircuitBreaker(2, time.Minute)
+	up.BackoffBase = time.Millisecond
+	up.Retries = 5
+	if _, err := up.Do(context.Background(), "GET", "/", nil, nil); ErrCircuitOpen != err {
+		t.Errorf("expected %v, %v found", ErrCircuitOpen, err)
+	}
+	if 2 != calls || "open" != up.Metrics().State {
+		t.Errorf("expected breaker to open after 2 calls, %d calls %+v found", calls, up.Metrics())
+	}
+}
+
+func TestUpstreamHedge(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if 1 == atomic.AddInt32(&calls, 1) {
+			select {
+			case <-time.After(time.Second):
+			case <-request.Context().Done():
+			}
+		}
+		writer.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	up := NewUpstream("test", server.URL)
+	up.HedgeAfter = 10 * time.Millisecond
+	start := time.Now()
+	response, err := up.Do(context.Background(), "GET", "/", nil, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "ok" != string(response.Body) || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected hedged response, %q after %s found", response.Body, time.Since(start))
+	}
+	if 0 != up.Metrics().Failures {
+		t.Errorf("expected cancelled hedge not to count as a failure, %+v found", up.Metrics())
+	}
+}
+
+func TestUpstreamInboundDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-request.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	inbound := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+	start := time.Now()
+	if _, err := NewUpstream("test", server.URL).Get(inbound, "/"); nil == err {
+		t.Errorf("expected the inbound deadline to cancel the call")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected call to stop at the inbound deadline, %s found", time.Since(start))
+	}
+}
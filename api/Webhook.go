@@ -0,0 +1,1009 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+Webhook request headers
+*/
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+/*
+Delivery states
+*/
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+/*
+Subscription registers a URL to receive events
+*/
+type Subscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+
+	/*
+		The events to deliver, "*" receives every event
+	*/
+	Events []string `json:"events"`
+
+	/*
+		The key used to sign payloads, only returned when the subscription is
+		created
+	*/
+	Secret string `json:"secret,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+/*
+matches reports whether the subscription receives an event
+*/
+func (sub *Subscription) matches(event string) bool {
+	for _, name := range sub.Events {
+		if "*" == name || event == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+DeliveryAttempt records a single attempt to deliver an event
+*/
+type DeliveryAttempt struct {
+	At       time.Time     `json:"at"`
+	Status   int           `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+/*
+Delivery is an event queued for a subscription, with its delivery history
+*/
+type Delivery struct {
+	ID             string             `json:"id"`
+	SubscriptionID string             `json:"subscription_id"`
+	Event          string             `json:"event"`
+	Payload        json.RawMessage    `json:"payload"`
+	State          string             `json:"state"`
+	Attempts       []*DeliveryAttempt `json:"attempts"`
+	NextAttempt    time.Time          `json:"next_attempt,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+/*
+copy returns a copy that is safe to use outside the dispatcher lock
+*/
+func (delivery *Delivery) copy() *Delivery {
+	dup := *delivery
+	dup.Attempts = append([]*DeliveryAttempt(nil), delivery.Attempts...)
+	return &dup
+}
+
+/*
+DeliveryFilter selects deliveries from the log, empty fields match everything
+*/
+type DeliveryFilter struct {
+	SubscriptionID string
+	Event          string
+	State          string
+
+	/*
+		The most recent deliveries returned, 0 returns all of them
+	*/
+	Limit int
+}
+
+/*
+URLPolicy decides which URLs can subscribe to webhooks. By default only
+public addresses are allowed, so subscribers can't make the server send
+requests to itself or its internal network
+*/
+type URLPolicy struct {
+	/*
+		If set, only these hosts can be used. "*.example.com" matches any
+		subdomain of example.com
+	*/
+	AllowHosts []string
+
+	/*
+		Hosts that can't be used, in the same form as AllowHosts
+	*/
+	DenyHosts []string
+
+	/*
+		Allow loopback, private, link-local and other addresses that aren't
+		public
+	*/
+	AllowPrivate bool
+}
+
+/*
+matchHost reports whether a host matches one of patterns
+*/
+func matchHost(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if host == pattern || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+checkHost checks a host name against the allow and deny lists
+*/
+func (policy *URLPolicy) checkHost(host string) error {
+	if matchHost(host, policy.DenyHosts) || (0 != len(policy.AllowHosts) && !matchHost(host, policy.AllowHosts)) {
+		return fmt.Errorf("%w: host '%s'", ErrWebhookURLDenied, host)
+	}
+	return nil
+}
+
+/*
+checkIP rejects addresses that aren't public unless AllowPrivate is set
+*/
+func (policy *URLPolicy) checkIP(ip net.IP) error {
+	if policy.AllowPrivate {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: address %s isn't public", ErrWebhookURLDenied, ip)
+	}
+	return nil
+}
+
+/*
+Check returns an error if a URL can't be used for webhooks. Host names are
+resolved and every address they resolve to must be allowed
+*/
+func (policy *URLPolicy) Check(ctx context.Context, endpoint string) error {
+	parsed, err := url.Parse(endpoint)
+	if nil != err || ("http" != parsed.Scheme && "https" != parsed.Scheme) || "" == parsed.Hostname() {
+		return fmt.Errorf("invalid webhook url '%s'", endpoint)
+	}
+	host := parsed.Hostname()
+	if err := policy.checkHost(host); nil != err {
+		return err
+	}
+	if policy.AllowPrivate {
+		return nil
+	}
+	if ip := net.ParseIP(host); nil != ip {
+		return policy.checkIP(ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if nil != err {
+		return fmt.Errorf("%w: %v", ErrWebhookURLDenied, err)
+	}
+	for _, addr := range addrs {
+		if err := policy.checkIP(addr.IP); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+WebhookAuth authorizes a request to the webhook endpoints, returning an error
+to reject it with 401 Unauthorized
+*/
+type WebhookAuth func(request *http.Request) error
+
+/*
+webhookRecord is a line in the dispatcher journal
+*/
+type webhookRecord struct {
+	Subscription *Subscription `json:"subscription,omitempty"`
+	Deleted      string        `json:"deleted,omitempty"`
+	Delivery     *Delivery     `json:"delivery,omitempty"`
+}
+
+/*
+Dispatcher delivers events to webhook subscribers. Subscriptions and queued
+deliveries are journaled to a file so pending deliveries survive a restart.
+Payloads are signed with the subscription secret, failed deliveries are
+retried with exponential backoff and dead-lettered after MaxAttempts
+*/
+type Dispatcher struct {
+	/*
+		The client used for deliveries, defaults to a client with a 10 second
+		timeout that only connects to addresses URLPolicy allows. A custom
+		client only has the subscribed host names checked
+	*/
+	Client *http.Client
+
+	/*
+		The URLs that can be subscribed, nil only allows public addresses
+	*/
+	URLPolicy *URLPolicy
+
+	/*
+		Attempts before a delivery is dead-lettered
+	*/
+	MaxAttempts int
+
+	/*
+		The delay after the first failed attempt, doubled after each attempt
+		up to BackoffMax
+	*/
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+
+	/*
+		The most deliveries sent at once
+	*/
+	Concurrency int
+
+	mux           sync.Mutex
+	file          *os.File
+	subscriptions map[string]*Subscription
+	deliveries    map[string]*Delivery
+	order         []string
+	inflight      map[string]bool
+	wake          chan struct{}
+	now           func() time.Time
+}
+
+/*
+NewDispatcher returns a pointer to a new Dispatcher journaling to a file in
+dir, loading any subscriptions and deliveries already journaled there
+*/
+func NewDispatcher(dir string) (*Dispatcher, error) {
+	if err := os.MkdirAll(dir, 0700); nil != err {
+		return nil, err
+	}
+	dispatcher := &Dispatcher{
+		MaxAttempts:   8,
+		BackoffBase:   time.Second,
+		BackoffMax:    time.Hour,
+		Concurrency:   4,
+		subscriptions: make(map[string]*Subscription),
+		deliveries:    make(map[string]*Delivery),
+		inflight:      make(map[string]bool),
+		wake:          make(chan struct{}, 1),
+		now:           time.Now,
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, Control: dispatcher.checkDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	dispatcher.Client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	if err := dispatcher.open(filepath.Join(dir, "webhooks.jsonl")); nil != err {
+		return nil, err
+	}
+	return dispatcher, nil
+}
+
+/*
+open replays the journal, then rewrites it with only the current state. A
+last record that can't be decoded was torn by a crash while it was appended
+and is dropped, corruption before it is an error
+*/
+func (dispatcher *Dispatcher) open(file string) error {
+	if handle, err := os.Open(file); nil == err {
+		var torn error
+		scanner := bufio.NewScanner(handle)
+		scanner.Buffer(make([]byte, 64*1024), 64<<20)
+		for line := 1; scanner.Scan(); line++ {
+			if nil != torn {
+				handle.Close()
+				return torn
+			}
+			var record webhookRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); nil != err {
+				torn = fmt.Errorf("%s:%d: %v", file, line, err)
+				continue
+			}
+			dispatcher.replay(&record)
+		}
+		handle.Close()
+		if err := scanner.Err(); nil != err {
+			return err
+		}
+		if nil != torn {
+			log.Printf("webhooks: dropping an incomplete last record, %v", torn)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	handle, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if nil != err {
+		return err
+	}
+	encoder := json.NewEncoder(handle)
+	for _, sub := range dispatcher.subscriptions {
+		if err := encoder.Encode(&webhookRecord{Subscription: sub}); nil != err {
+			handle.Close()
+			return err
+		}
+	}
+	for _, id := range dispatcher.order {
+		if err := encoder.Encode(&webhookRecord{Delivery: dispatcher.deliveries[id]}); nil != err {
+			handle.Close()
+			return err
+		}
+	}
+	if err := handle.Sync(); nil != err {
+		handle.Close()
+		return err
+	}
+	handle.Close()
+	if err := os.Rename(tmp, file); nil != err {
+		return err
+	}
+
+	dispatcher.file, err = os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0600)
+	return err
+}
+
+func (dispatcher *Dispatcher) replay(record *webhookRecord) {
+	switch {
+	case nil != record.Subscription:
+		dispatcher.subscriptions[record.Subscription.ID] = record.Subscription
+	case "" != record.Deleted:
+		delete(dispatcher.subscriptions, record.Deleted)
+	case nil != record.Delivery:
+		if _, ok := dispatcher.deliveries[record.Delivery.ID]; !ok {
+			dispatcher.order = append(dispatcher.order, record.Delivery.ID)
+		}
+		dispatcher.deliveries[record.Delivery.ID] = record.Delivery
+	}
+}
+
+/*
+journal appends a record and flushes it to disk, the caller holds the lock
+*/
+func (dispatcher *Dispatcher) journal(record *webhookRecord) error {
+	data, err := json.Marshal(record)
+	if nil != err {
+		return err
+	}
+	if _, err := dispatcher.file.Write(append(data, '\n')); nil != err {
+		return err
+	}
+	return dispatcher.file.Sync()
+}
+
+/*
+Close closes the journal
+*/
+func (dispatcher *Dispatcher) Close() error {
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	return dispatcher.file.Close()
+}
+
+/*
+urlPolicy returns the URLPolicy, the default policy if there isn't one
+*/
+func (dispatcher *Dispatcher) urlPolicy() *URLPolicy {
+	if nil != dispatcher.URLPolicy {
+		return dispatcher.URLPolicy
+	}
+	return &URLPolicy{}
+}
+
+/*
+checkDial is the dialer control of the default client, it checks the address
+a delivery connects to so a host can't be pointed at a private address after
+it subscribed
+*/
+func (dispatcher *Dispatcher) checkDial(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if nil != err {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if nil == ip {
+		return fmt.Errorf("%w: address %s", ErrWebhookURLDenied, address)
+	}
+	return dispatcher.urlPolicy().checkIP(ip)
+}
+
+/*
+Subscribe registers a URL for events, the URL must be allowed by the
+URLPolicy. A secret is generated if one isn't given
+*/
+func (dispatcher *Dispatcher) Subscribe(endpoint string, events []string, secret string) (*Subscription, error) {
+	if err := dispatcher.urlPolicy().Check(context.Background(), endpoint); nil != err {
+		return nil, err
+	}
+	if 0 == len(events) {
+		return nil, fmt.Errorf("at least one event is required")
+	}
+	if "" == secret {
+		secret = "whsec_" + randomID()
+	}
+
+	sub := &Subscription{
+		ID:        randomID(),
+		URL:       endpoint,
+		Events:    events,
+		Secret:    secret,
+		CreatedAt: dispatcher.now().UTC(),
+	}
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	if err := dispatcher.journal(&webhookRecord{Subscription: sub}); nil != err {
+		return nil, err
+	}
+	dispatcher.subscriptions[sub.ID] = sub
+	dup := *sub
+	return &dup, nil
+}
+
+/*
+Unsubscribe removes a subscription, its pending deliveries are dead-lettered
+when they are next attempted
+*/
+func (dispatcher *Dispatcher) Unsubscribe(id string) error {
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	if _, ok := dispatcher.subscriptions[id]; !ok {
+		return ErrSubscriptionNotFound
+	}
+	if err := dispatcher.journal(&webhookRecord{Deleted: id}); nil != err {
+		return err
+	}
+	delete(dispatcher.subscriptions, id)
+	return nil
+}
+
+/*
+Subscriptions returns the registered subscriptions, without their secrets
+*/
+func (dispatcher *Dispatcher) Subscriptions() []*Subscription {
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	subs := make([]*Subscription, 0, len(dispatcher.subscriptions))
+	for _, sub := range dispatcher.subscriptions {
+		dup := *sub
+		dup.Secret = ""
+		subs = append(subs, &dup)
+	}
+	sort.Slice(subs, func(a, b int) bool {
+		return subs[a].CreatedAt.Before(subs[b].CreatedAt) || (subs[a].CreatedAt.Equal(subs[b].CreatedAt) && subs[a].ID < subs[b].ID)
+	})
+	return subs
+}
+
+/*
+Publish queues an event for every matching subscription
+*/
+func (dispatcher *Dispatcher) Publish(event string, payload interface{}) ([]*Delivery, error) {
+	data, err := json.Marshal(payload)
+	if nil != err {
+		return nil, err
+	}
+
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	now := dispatcher.now().UTC()
+	queued := make([]*Delivery, 0)
+	for _, sub := range dispatcher.subscriptions {
+		if !sub.matches(event) {
+			continue
+		}
+		delivery := &Delivery{
+			ID:             randomID(),
+			SubscriptionID: sub.ID,
+			Event:          event,
+			Payload:        data,
+			State:          DeliveryPending,
+			Attempts:       make([]*DeliveryAttempt, 0),
+			NextAttempt:    now,
+			CreatedAt:      now,
+		}
+		if err := dispatcher.journal(&webhookRecord{Delivery: delivery}); nil != err {
+			return queued, err
+		}
+		dispatcher.deliveries[delivery.ID] = delivery
+		dispatcher.order = append(dispatcher.order, delivery.ID)
+		queued = append(queued, delivery.copy())
+	}
+	dispatcher.notify()
+	return queued, nil
+}
+
+/*
+Redeliver queues a delivered or dead-lettered delivery again
+*/
+func (dispatcher *Dispatcher) Redeliver(id string) (*Delivery, error) {
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	delivery, ok := dispatcher.deliveries[id]
+	if !ok {
+		return nil, ErrDeliveryNotFound
+	}
+	if DeliveryPending != delivery.State {
+		updated := delivery.copy()
+		updated.State = DeliveryPending
+		updated.NextAttempt = dispatcher.now().UTC()
+		updated.Attempts = make([]*DeliveryAttempt, 0)
+		if err := dispatcher.journal(&webhookRecord{Delivery: updated}); nil != err {
+			return nil, err
+		}
+		dispatcher.deliveries[id] = updated
+		delivery = updated
+		dispatcher.notify()
+	}
+	return delivery.copy(), nil
+}
+
+/*
+Delivery returns a delivery from the log
+*/
+func (dispatcher *Dispatcher) Delivery(id string) (*Delivery, error) {
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	delivery, ok := dispatcher.deliveries[id]
+	if !ok {
+		return nil, ErrDeliveryNotFound
+	}
+	return delivery.copy(), nil
+}
+
+/*
+Deliveries returns the deliveries matching a filter, most recent first
+*/
+func (dispatcher *Dispatcher) Deliveries(filter DeliveryFilter) []*Delivery {
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	found := make([]*Delivery, 0)
+	for a := len(dispatcher.order) - 1; a >= 0; a-- {
+		delivery := dispatcher.deliveries[dispatcher.order[a]]
+		if ("" != filter.SubscriptionID && filter.SubscriptionID != delivery.SubscriptionID) ||
+			("" != filter.Event && filter.Event != delivery.Event) ||
+			("" != filter.State && filter.State != delivery.State) {
+			continue
+		}
+		found = append(found, delivery.copy())
+		if filter.Limit > 0 && len(found) >= filter.Limit {
+			break
+		}
+	}
+	return found
+}
+
+func (dispatcher *Dispatcher) notify() {
+	select {
+	case dispatcher.wake <- struct{}{}:
+	default:
+	}
+}
+
+/*
+Run sends queued deliveries until ctx is done. Deliveries that were in
+progress when the process stopped are sent again, so receivers should use the
+delivery ID to ignore duplicates
+*/
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	concurrency := dispatcher.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		due, next := dispatcher.due(cap(slots) - len(slots))
+		for _, delivery := range due {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(delivery *Delivery) {
+				defer wg.Done()
+				dispatcher.deliver(ctx, delivery)
+				<-slots
+				dispatcher.notify()
+			}(delivery)
+		}
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = next.Sub(dispatcher.now())
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-dispatcher.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+/*
+due claims up to max deliveries that are ready to send and returns the time
+the next pending delivery is ready
+*/
+func (dispatcher *Dispatcher) due(max int) ([]*Delivery, time.Time) {
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	now := dispatcher.now()
+	due := make([]*Delivery, 0)
+	var next time.Time
+	for _, id := range dispatcher.order {
+		delivery := dispatcher.deliveries[id]
+		if DeliveryPending != delivery.State || dispatcher.inflight[id] {
+			continue
+		}
+		if !delivery.NextAttempt.After(now) {
+			// Deliveries that don't fit are claimed when a slot is released
+			if len(due) < max {
+				dispatcher.inflight[id] = true
+				due = append(due, delivery.copy())
+			}
+			continue
+		}
+		if next.IsZero() || delivery.NextAttempt.Before(next) {
+			next = delivery.NextAttempt
+		}
+	}
+	return due, next
+}
+
+/*
+deliver makes one attempt to send a delivery and journals the result
+*/
+func (dispatcher *Dispatcher) deliver(ctx context.Context, delivery *Delivery) {
+	dispatcher.mux.Lock()
+	sub, ok := dispatcher.subscriptions[delivery.SubscriptionID]
+	dispatcher.mux.Unlock()
+
+	attempt := &DeliveryAttempt{At: dispatcher.now().UTC()}
+	if !ok {
+		attempt.Error = "subscription removed"
+	} else {
+		attempt.Status, attempt.Error = dispatcher.send(ctx, sub, delivery)
+	}
+	attempt.Duration = dispatcher.now().Sub(attempt.At)
+	if nil != ctx.Err() {
+		// Shutting down, the attempt is retried on the next run
+		dispatcher.mux.Lock()
+		delete(dispatcher.inflight, delivery.ID)
+		dispatcher.mux.Unlock()
+		return
+	}
+
+	claimed := len(delivery.Attempts)
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	switch {
+	case "" == attempt.Error:
+		delivery.State = DeliveryDelivered
+		delivery.NextAttempt = time.Time{}
+	case !ok || len(delivery.Attempts) >= dispatcher.MaxAttempts:
+		delivery.State = DeliveryDead
+		delivery.NextAttempt = time.Time{}
+	default:
+		delivery.NextAttempt = attempt.At.Add(dispatcher.backoff(len(delivery.Attempts)))
+	}
+
+	dispatcher.mux.Lock()
+	defer dispatcher.mux.Unlock()
+	delete(dispatcher.inflight, delivery.ID)
+	// A delivery that was redelivered while it was being sent has a new
+	// history, this result is for the old one
+	current, ok := dispatcher.deliveries[delivery.ID]
+	if !ok || DeliveryPending != current.State || claimed != len(current.Attempts) {
+		return
+	}
+	dispatcher.deliveries[delivery.ID] = delivery
+	dispatcher.journal(&webhookRecord{Delivery: delivery})
+}
+
+/*
+backoff returns BackoffBase * 2^(attempt-1), capped at BackoffMax
+*/
+func (dispatcher *Dispatcher) backoff(attempt int) time.Duration {
+	delay := dispatcher.BackoffBase << uint(attempt-1)
+	if delay <= 0 || (dispatcher.BackoffMax > 0 && delay > dispatcher.BackoffMax) {
+		delay = dispatcher.BackoffMax
+	}
+	return delay
+}
+
+/*
+send posts a signed delivery and returns the response status and an error
+message if the delivery failed
+*/
+func (dispatcher *Dispatcher) send(ctx context.Context, sub *Subscription, delivery *Delivery) (int, string) {
+	if parsed, err := url.Parse(sub.URL); nil != err {
+		return 0, err.Error()
+	} else if err := dispatcher.urlPolicy().checkHost(parsed.Hostname()); nil != err {
+		return 0, err.Error()
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"id":         delivery.ID,
+		"event":      delivery.Event,
+		"created_at": delivery.CreatedAt,
+		"data":       delivery.Payload,
+	})
+	if nil != err {
+		return 0, err.Error()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if nil != err {
+		return 0, err.Error()
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookEventHeader, delivery.Event)
+	request.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	request.Header.Set(WebhookSignatureHeader, SignWebhook(sub.Secret, dispatcher.now(), body))
+
+	response, err := dispatcher.Client.Do(request)
+	if nil != err {
+		return 0, err.Error()
+	}
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Sprintf("unexpected status %d", response.StatusCode)
+	}
+	return response.StatusCode, ""
+}
+
+/*
+SignWebhook returns the signature header value for a payload:
+"t=<unix time>,v1=<hex HMAC-SHA256 of '<unix time>.<payload>'>"
+*/
+func SignWebhook(secret string, at time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+VerifyWebhook checks a signature header created by SignWebhook. Signatures
+older than tolerance are rejected, 0 disables the check
+*/
+func VerifyWebhook(secret, header string, payload []byte, tolerance time.Duration) error {
+	var timestamp string
+	signatures := make([]string, 0)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if nil != err || 0 == len(signatures) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(seconds, 0)) > tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+	expect := SignWebhook(secret, time.Unix(seconds, 0), payload)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(expect), []byte("t="+timestamp+",v1="+signature)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+/*
+randomID returns a random 128 bit hex identifier
+*/
+func randomID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+/*
+Register adds the subscription and delivery log endpoints under a prefix,
+e.g. "/webhooks". Every request must be authorized by auth, a nil auth
+rejects them all:
+
+	GET    /webhooks/subscriptions
+	POST   /webhooks/subscriptions
+	GET    /webhooks/subscriptions/{id}
+	DELETE /webhooks/subscriptions/{id}
+	GET    /webhooks/deliveries?subscription=&event=&state=&limit=
+	GET    /webhooks/deliveries/{id}
+	POST   /webhooks/deliveries/{id}/redeliver
+*/
+func (dispatcher *Dispatcher) Register(api *Api, prefix string, auth WebhookAuth) *Api {
+	prefix = strings.TrimSuffix(prefix, "/")
+	api.AddHandler(prefix+"/subscriptions", authorize(auth, dispatcher.handleSubscriptions))
+	api.AddHandler(prefix+"/subscriptions/{id}", authorize(auth, dispatcher.handleSubscription))
+	api.AddHandler(prefix+"/deliveries", authorize(auth, dispatcher.handleDeliveries))
+	api.AddHandler(prefix+"/deliveries/{id}", authorize(auth, dispatcher.handleDelivery))
+	api.AddHandler(prefix+"/deliveries/{id}/redeliver", authorize(auth, dispatcher.handleRedeliver))
+	return api
+}
+
+/*
+authorize wraps a handler, responding 401 Unauthorized to requests auth
+rejects
+*/
+func authorize(auth WebhookAuth, handler func(*http.Request, *Response)) func(*http.Request, *Response) {
+	return func(request *http.Request, response *Response) {
+		err := ErrUnauthorized
+		if nil != auth {
+			err = auth(request)
+		}
+		if nil != err {
+			response.SetStatusCode(http.StatusUnauthorized).AddError(err)
+			response.Channel <- response.Done()
+			return
+		}
+		handler(request, response)
+	}
+}
+
+/*
+allowMethods sets a 405 response if the request method isn't listed
+*/
+func allowMethods(request *http.Request, response *Response, methods ...string) bool {
+	for _, method := range methods {
+		if method == request.Method {
+			return true
+		}
+	}
+	response.SetStatusCode(http.StatusMethodNotAllowed).
+		AddHeader("Allow", strings.Join(methods, ", ")).
+		AddError(fmt.Errorf("method %s not allowed", request.Method))
+	return false
+}
+
+func (dispatcher *Dispatcher) handleSubscriptions(request *http.Request, response *Response) {
+	defer func() { response.Channel <- response.Done() }()
+	if !allowMethods(request, response, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if http.MethodGet == request.Method {
+		for _, sub := range dispatcher.Subscriptions() {
+			response.Channel <- sub
+		}
+		return
+	}
+
+	var body struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); nil != err {
+		response.SetStatusCode(http.StatusBadRequest).AddError(fmt.Errorf("invalid JSON body: %v", err))
+		return
+	}
+	sub, err := dispatcher.Subscribe(body.URL, body.Events, body.Secret)
+	if nil != err {
+		response.SetStatusCode(http.StatusUnprocessableEntity).AddError(err)
+		return
+	}
+	response.SetStatusCode(http.StatusCreated)
+	response.Channel <- sub
+}
+
+func (dispatcher *Dispatcher) handleSubscription(request *http.Request, response *Response) {
+	defer func() { response.Channel <- response.Done() }()
+	if !allowMethods(request, response, http.MethodGet, http.MethodDelete) {
+		return
+	}
+
+	id := request.PathValue("id")
+	if http.MethodDelete == request.Method {
+		if err := dispatcher.Unsubscribe(id); nil != err {
+			response.SetStatusCode(webhookErrorStatus(err)).AddError(err)
+			return
+		}
+		response.SetStatusCode(http.StatusNoContent)
+		return
+	}
+	for _, sub := range dispatcher.Subscriptions() {
+		if id == sub.ID {
+			response.Channel <- sub
+			return
+		}
+	}
+	response.SetStatusCode(http.StatusNotFound).AddError(ErrSubscriptionNotFound)
+}
+
+func (dispatcher *Dispatcher) handleDeliveries(request *http.Request, response *Response) {
+	defer func() { response.Channel <- response.Done() }()
+	if !allowMethods(request, response, http.MethodGet) {
+		return
+	}
+
+	query := request.URL.Query()
+	filter := DeliveryFilter{
+		SubscriptionID: query.Get("subscription"),
+		Event:          query.Get("event"),
+		State:          query.Get("state"),
+	}
+	if limit := query.Get("limit"); "" != limit {
+		var err error
+		if filter.Limit, err = strconv.Atoi(limit); nil != err || filter.Limit < 0 {
+			response.SetStatusCode(http.StatusBadRequest).AddError(fmt.Errorf("invalid limit '%s'", limit))
+			return
+		}
+	}
+	for _, delivery := range dispatcher.Deliveries(filter) {
+		response.Channel <- delivery
+	}
+}
+
+func (dispatcher *Dispatcher) handleDelivery(request *http.Request, response *Response) {
+	defer func() { response.Channel <- response.Done() }()
+	if !allowMethods(request, response, http.MethodGet) {
+		return
+	}
+	delivery, err := dispatcher.Delivery(request.PathValue("id"))
+	if nil != err {
+		response.SetStatusCode(webhookErrorStatus(err)).AddError(err)
+		return
+	}
+	response.Channel <- delivery
+}
+
+func (dispatcher *Dispatcher) handleRedeliver(request *http.Request, response *Response) {
+	defer func() { response.Channel <- response.Done() }()
+	if !allowMethods(request, response, http.MethodPost) {
+		return
+	}
+	delivery, err := dispatcher.Redeliver(request.PathValue("id"))
+	if nil != err {
+		response.SetStatusCode(webhookErrorStatus(err)).AddError(err)
+		return
+	}
+	response.SetStatusCode(http.StatusAccepted)
+	response.Channel <- delivery
+}
+
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, ErrSubscriptionNotFound) || errors.Is(err, ErrDeliveryNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,326 @@
+/*
+Package api is a Golang API service
+*/
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitForDelivery(t *testing.T, dispatcher *Dispatcher, id, state string) *Delivery {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		delivery, err := dispatcher.Delivery(id)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if state == delivery.State {
+			return delivery
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected delivery %s to be %s", id, state)
+	return nil
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	var mux sync.Mutex
+	received := make([]string, 0)
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		if err := VerifyWebhook("secret", request.Header.Get(WebhookSignatureHeader), body, time.Minute); nil != err {
+			t.Error(err)
+		}
+		var payload struct {
+			Event string          `json:"event"`
+			Data  json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(body, &payload)
+		mux.Lock()
+		received = append(received, request.Header.Get(WebhookEventHeader)+" "+payload.Event+" "+string(payload.Data))
+		mux.Unlock()
+	}))
+	defer receiver.Close()
+
+	dispatcher, err := NewDispatcher(t.TempDir())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer dispatcher.Close()
+	dispatcher.URLPolicy = &URLPolicy{AllowPrivate: true}
+	dispatcher.Subscribe(receiver.URL, []string{"order.created"}, "secret")
+	dispatcher.Subscribe(receiver.URL, []string{"user.created"}, "other")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	deliveries, err := dispatcher.Publish("order.created", map[string]int{"id": 7})
+	if nil != err || 1 != len(deliveries) {
+		t.Fatalf("expected 1 delivery, %d %v found", len(deliveries), err)
+	}
+	delivery := waitForDelivery(t, dispatcher, deliveries[0].ID, DeliveryDelivered)
+	if 1 != len(delivery.Attempts) || http.StatusOK != delivery.Attempts[0].Status {
+		t.Errorf("expected a single successful attempt, %+v found", delivery.Attempts)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if expect := `order.created order.created {"id":7}`; 1 != len(received) || expect != received[0] {
+		t.Errorf("expected [%s], %v found", expect, received)
+	}
+}
+
+func TestWebhookRetryAndDeadLetter(t *testing.T) {
+	var mux sync.Mutex
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.Lock()
+		calls++
+		mux.Unlock()
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	dispatcher, _ := NewDispatcher(t.TempDir())
+	defer dispatcher.Close()
+	dispatcher.MaxAttempts = 3
+	dispatcher.BackoffBase = time.Millisecond
+	dispatcher.URLPolicy = &URLPolicy{AllowPrivate: true}
+	dispatcher.Subscribe(receiver.URL, []string{"*"}, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	deliveries, _ := dispatcher.Publish("ping", nil)
+	delivery := waitForDelivery(t, dispatcher, deliveries[0].ID, DeliveryDead)
+	if 3 != len(delivery.Attempts) {
+		t.Errorf("expected 3 attempts, %d found", len(delivery.Attempts))
+	}
+	if expect := "unexpected status 503"; expect != delivery.Attempts[2].Error {
+		t.Errorf("expected '%s', '%s' found", expect, delivery.Attempts[2].Error)
+	}
+	if dead := dispatcher.Deliveries(DeliveryFilter{State: DeliveryDead}); 1 != len(dead) {
+		t.Errorf("expected 1 dead delivery, %d found", len(dead))
+	}
+
+	if _, err := dispatcher.Redeliver(delivery.ID); nil != err {
+		t.Fatal(err)
+	}
+	waitForDelivery(t, dispatcher, delivery.ID, DeliveryDead)
+	mux.Lock()
+	defer mux.Unlock()
+	if 6 != calls {
+		t.Errorf("expected 6 calls, %d found", calls)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	dispatcher := &Dispatcher{BackoffBase: time.Second, BackoffMax: 5 * time.Second}
+	expect := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for k, delay := range expect {
+		if found := dispatcher.backoff(k + 1); delay != found {
+			t.Errorf("attempt %d: expected %v, %v found", k+1, delay, found)
+		}
+	}
+}
+
+func TestWebhookJournal(t *testing.T) {
+	dir := t.TempDir()
+	dispatcher, _ := NewDispatcher(dir)
+	dispatcher.URLPolicy = &URLPolicy{AllowPrivate: true}
+	sub, _ := dispatcher.Subscribe("http://127.0.0.1:1/hook", []string{"a"}, "secret")
+	removed, _ := dispatcher.Subscribe("http://127.0.0.1:1/other", []string{"a"}, "secret")
+	dispatcher.Unsubscribe(removed.ID)
+	deliveries, _ := dispatcher.Publish("a", "payload")
+	dispatcher.Close()
+
+	dispatcher, err := NewDispatcher(dir)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer dispatcher.Close()
+	if subs := dispatcher.Subscriptions(); 1 != len(subs) || sub.ID != subs[0].ID || "" != subs[0].Secret {
+		t.Errorf("expected the subscription to be restored without its secret, %+v found", subs)
+	}
+	delivery, err := dispatcher.Delivery(deliveries[0].ID)
+	if nil != err || DeliveryPending != delivery.State || `"payload"` != string(delivery.Payload) {
+		t.Errorf("expected the pending delivery to be restored, %+v %v found", delivery, err)
+	}
+}
+
+func TestWebhookJournalTorn(t *testing.T) {
+	dir := t.TempDir()
+	dispatcher, _ := NewDispatcher(dir)
+	dispatcher.URLPolicy = &URLPolicy{AllowPrivate: true}
+	sub, _ := dispatcher.Subscribe("http://127.0.0.1:1/hook", []string{"a"}, "secret")
+	dispatcher.Close()
+
+	file := filepath.Join(dir, "webhooks.jsonl")
+	journal, _ := os.ReadFile(file)
+	os.WriteFile(file, append(journal, `{"delivery": {"id": "torn-delivery", "sta`...), 0600)
+	dispatcher, err := NewDispatcher(dir)
+	if nil != err {
+		t.Fatal(err)
+	}
+	dispatcher.Close()
+	if subs := dispatcher.Subscriptions(); 1 != len(subs) || sub.ID != subs[0].ID {
+		t.Errorf("expected the subscription to be restored, %+v found", subs)
+	}
+	if rewritten, _ := os.ReadFile(file); strings.Contains(string(rewritten), "torn-delivery") {
+		t.Errorf("expected the torn record to be removed, %s found", rewritten)
+	}
+
+	// corruption before the last record is an error
+	os.WriteFile(file, append([]byte("{nope\n"), journal...), 0600)
+	if _, err := NewDispatcher(dir); nil == err {
+		t.Errorf("expected an error for a corrupt record")
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"a":1}`)
+	header := SignWebhook("secret", time.Now(), body)
+	if err := VerifyWebhook("secret", header, body, time.Minute); nil != err {
+		t.Error(err)
+	}
+	if err := VerifyWebhook("wrong", header, body, time.Minute); nil == err {
+		t.Errorf("expected a signature with the wrong secret to fail")
+	}
+	if err := VerifyWebhook("secret", SignWebhook("secret", time.Now().Add(-time.Hour), body), body, time.Minute); nil == err {
+		t.Errorf("expected an old signature to fail")
+	}
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	dispatcher, _ := NewDispatcher(t.TempDir())
+	defer dispatcher.Close()
+	api := NewServer()
+	dispatcher.Register(api, "/webhooks/", func(request *http.Request) error {
+		if "Bearer admin" != request.Header.Get("Authorization") {
+			return ErrUnauthorized
+		}
+		return nil
+	})
+	handler := api.BuildHandler()
+
+	admin := map[string]string{"Authorization": "Bearer admin"}
+
+	if unauthorized := serve(handler, "GET", "/webhooks/deliveries", "", nil); http.StatusUnauthorized != unauthorized.Code {
+		t.Errorf("expected status %d, %d found", http.StatusUnauthorized, unauthorized.Code)
+	}
+
+	recorder := serve(handler, "POST", "/webhooks/subscriptions", `{"url":"https://93.184.215.14/hook","events":["a"],"secret":"s"}`, admin)
+	if http.StatusCreated != recorder.Code {
+		t.Fatalf("expected status %d, %d found: %s", http.StatusCreated, recorder.Code, recorder.Body.String())
+	}
+	var created []*Subscription
+	json.Unmarshal(recorder.Body.Bytes(), &created)
+	if 1 != len(created) || "s" != created[0].Secret {
+		t.Fatalf("expected the created subscription with its secret, %s found", recorder.Body.String())
+	}
+
+	for _, url := range []string{"ftp://example.com", "http://127.0.0.1/hook", "http://169.254.169.254/latest"} {
+		if recorder := serve(handler, "POST", "/webhooks/subscriptions", `{"url":"`+url+`","events":["a"]}`, admin); http.StatusUnprocessableEntity != recorder.Code {
+			t.Errorf("%s: expected status %d, %d found", url, http.StatusUnprocessableEntity, recorder.Code)
+		}
+	}
+	if recorder := serve(handler, "GET", "/webhooks/subscriptions/"+created[0].ID, "", admin); strings.Contains(recorder.Body.String(), `"secret"`) {
+		t.Errorf("expected the secret to be hidden, %s found", recorder.Body.String())
+	}
+
+	dispatcher.Publish("a", 1)
+	dispatcher.Publish("a", 2)
+	recorder = serve(handler, "GET", "/webhooks/deliveries?event=a&limit=1", "", admin)
+	var deliveries []*Delivery
+	json.Unmarshal(recorder.Body.Bytes(), &deliveries)
+	if 1 != len(deliveries) || "2" != string(deliveries[0].Payload) {
+		t.Errorf("expected the most recent delivery, %s found", recorder.Body.String())
+	}
+
+	if recorder := serve(handler, "GET", "/webhooks/deliveries/unknown", "", admin); http.StatusNotFound != recorder.Code {
+		t.Errorf("expected status %d, %d found", http.StatusNotFound, recorder.Code)
+	}
+	if recorder := serve(handler, "GET", "/webhooks/deliveries/unknown/redeliver", "", admin); http.StatusMethodNotAllowed != recorder.Code || "POST" != recorder.Header().Get("Allow") {
+		t.Errorf("expected status %d, %d found", http.StatusMethodNotAllowed, recorder.Code)
+	}
+	if recorder := serve(handler, "DELETE", "/webhooks/subscriptions/"+created[0].ID, "", admin); http.StatusNoContent != recorder.Code || 0 != recorder.Body.Len() {
+		t.Errorf("expected status %d without a body, %d %q found", http.StatusNoContent, recorder.Code, recorder.Body.String())
+	}
+	if 0 != len(dispatcher.Subscriptions()) {
+		t.Errorf("expected the subscription to be removed")
+	}
+}
+
+func TestWebhookURLPolicy(t *testing.T) {
+	tests := []struct {
+		policy *URLPolicy
+		url    string
+		allow  bool
+	}{
+		{&URLPolicy{}, "https://93.184.215.14/hook", true},
+		{&URLPolicy{}, "http://127.0.0.1:8080/hook", false},
+		{&URLPolicy{}, "http://[::1]/hook", false},
+		{&URLPolicy{}, "http://10.1.2.3/hook", false},
+		{&URLPolicy{}, "http://169.254.169.254/latest", false},
+		{&URLPolicy{}, "http://0.0.0.0/hook", false},
+		{&URLPolicy{}, "http://localhost/hook", false},
+		{&URLPolicy{AllowPrivate: true}, "http://127.0.0.1/hook", true},
+		{&URLPolicy{AllowPrivate: true, AllowHosts: []string{"*.internal"}}, "http://hooks.internal/a", true},
+		{&URLPolicy{AllowPrivate: true, AllowHosts: []string{"*.internal"}}, "http://example.com/a", false},
+		{&URLPolicy{AllowPrivate: true, DenyHosts: []string{"metadata.internal"}}, "http://METADATA.internal./a", false},
+		{&URLPolicy{AllowPrivate: true}, "gopher://example.com", false},
+	}
+	for _, test := range tests {
+		err := test.policy.Check(context.Background(), test.url)
+		if test.allow != (nil == err) {
+			t.Errorf("%s %+v: expected allowed %v, %v found", test.url, test.policy, test.allow, err)
+		}
+	}
+
+	// The default client checks the address it connects to
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	defer receiver.Close()
+	dispatcher, _ := NewDispatcher(t.TempDir())
+	defer dispatcher.Close()
+	dispatcher.URLPolicy = &URLPolicy{AllowPrivate: true}
+	sub, _ := dispatcher.Subscribe(receiver.URL, []string{"a"}, "")
+	dispatcher.URLPolicy = &URLPolicy{}
+	if _, message := dispatcher.send(context.Background(), sub, &Delivery{}); !strings.Contains(message, ErrWebhookURLDenied.Error()) {
+		t.Errorf("expected the delivery to be denied, %q found", message)
+	}
+}
+
+func TestWebhookRedeliverWhileSending(t *testing.T) {
+	dispatcher, _ := NewDispatcher(t.TempDir())
+	defer dispatcher.Close()
+	dispatcher.URLPolicy = &URLPolicy{AllowPrivate: true}
+	dispatcher.Subscribe("http://127.0.0.1:1/hook", []string{"a"}, "")
+	deliveries, _ := dispatcher.Publish("a", nil)
+	id := deliveries[0].ID
+
+	// The delivery is claimed with one failed attempt and redelivered with a
+	// new history before the claimed attempt finishes
+	dispatcher.deliveries[id].Attempts = append(dispatcher.deliveries[id].Attempts, &DeliveryAttempt{Error: "failed"})
+	claimed, _ := dispatcher.due(1)
+	dispatcher.deliveries[id].State = DeliveryDead
+	if _, err := dispatcher.Redeliver(id); nil != err {
+		t.Fatal(err)
+	}
+	dispatcher.deliver(context.Background(), claimed[0])
+
+	if delivery, _ := dispatcher.Delivery(id); DeliveryPending != delivery.State || 0 != len(delivery.Attempts) {
+		t.Errorf("expected the redelivered history to be kept, %+v found", delivery)
+	}
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+)
+
+/*
+parse parses a positional value by the type of the argument's Default and
+validates it
+*/
+func (arg *Arg) parse(value string) (interface{}, error) {
+	flag := &Flag{Name: arg.Name, Default: arg.Default, Allowed: arg.Allowed}
+	if nil == flag.Default {
+		flag.Default = ""
+	}
+	if err := flag.Set(value); nil != err {
+		return nil, err
+	}
+	if nil != arg.Validate {
+		if err := arg.Validate(flag.Value); nil != err {
+			return nil, err
+		}
+	}
+	return flag.Value, nil
+}
+
+/*
+synopsis returns how the argument is shown in a usage line, e.g. "<src>",
+"[dest]" or "<files>..."
+*/
+func (arg *Arg) synopsis() string {
+	name := arg.Name
+	if arg.Variadic {
+		name += "..."
+	}
+	if arg.Required || (arg.Variadic && arg.Min > 0) {
+		return "<" + name + ">"
+	}
+	return "[" + name + "]"
+}
+
+/*
+argSpec returns the spec for the positional argument at index, nil if there
+isn't one
+*/
+func (cmd *Cmd) argSpec(index int) *Arg {
+	if 0 == len(cmd.ArgSpecs) {
+		return nil
+	}
+	if index < len(cmd.ArgSpecs) {
+		return cmd.ArgSpecs[index]
+	}
+	if last := cmd.ArgSpecs[len(cmd.ArgSpecs)-1]; last.Variadic {
+		return last
+	}
+	return nil
+}
+
+/*
+checkArgSpecs checks the ArgSpecs of the command and its sub-commands: only
+the last argument may be variadic and Min can't be more than Max
+*/
+func (cmd *Cmd) checkArgSpecs() error {
+	for k, spec := range cmd.ArgSpecs {
+		if spec.Variadic && k != len(cmd.ArgSpecs)-1 {
+			return &ArgSpecError{Cmd: cmd.commandPath(), Arg: spec.Name, Reason: "only the last argument can be variadic"}
+		}
+		if spec.Max > 0 && spec.Min > spec.Max {
+			return &ArgSpecError{Cmd: cmd.commandPath(), Arg: spec.Name, Reason: "min is greater than max"}
+		}
+	}
+
+	names := make([]string, 0, len(cmd.Cmds))
+	for name := range cmd.Cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub := cmd.Cmds[name]
+		sub.parent = cmd
+		if err := sub.checkArgSpecs(); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+validateArgs parses the positional values into the command's ArgSpecs,
+checking required arguments and counts. Commands without ArgSpecs accept any
+positional values
+*/
+func (cmd *Cmd) validateArgs(values []string) error {
+	if 0 == len(cmd.ArgSpecs) {
+		return nil
+	}
+
+	a := 0
+	for _, spec := range cmd.ArgSpecs {
+		if spec.Variadic {
+			rest := values[a:]
+			min := spec.Min
+			if spec.Required && min < 1 {
+				min = 1
+			}
+			if 0 == len(rest) && min > 0 {
+				return &MissingArgError{Cmd: cmd.commandPath(), Arg: spec.Name}
+			}
+			if len(rest) < min || (spec.Max > 0 && len(rest) > spec.Max) {
+				return &ArgCountError{Cmd: cmd.commandPath(), Arg: spec.Name, Min: min, Max: spec.Max, Count: len(rest)}
+			}
+			parsed := make([]interface{}, 0, len(rest))
+			for _, value := range rest {
+				result, err := spec.parse(value)
+				if nil != err {
+					return &InvalidArgError{Cmd: cmd.commandPath(), Arg: spec.Name, Value: value, Err: err}
+				}
+				parsed = append(parsed, result)
+			}
+			if 0 != len(parsed) {
+				spec.Value = parsed
+				spec.Called = true
+			}
+			a = len(values)
+			break
+		}
+
+		if a >= len(values) {
+			if spec.Required {
+				return &MissingArgError{Cmd: cmd.commandPath(), Arg: spec.Name}
+			}
+			continue
+		}
+		result, err := spec.parse(values[a])
+		if nil != err {
+			return &InvalidArgError{Cmd: cmd.commandPath(), Arg: spec.Name, Value: values[a], Err: err}
+		}
+		spec.Value = result
+		spec.Called = true
+		a++
+	}
+
+	if a < len(values) {
+		return &UnexpectedArgError{Cmd: cmd.commandPath(), Value: values[a]}
+	}
+	return nil
+}
+
+/*
+ArgValue returns the parsed value of a positional argument, its default if it
+wasn't given, or nil if it isn't defined
+*/
+func (cmd *Cmd) ArgValue(name string) interface{} {
+	for _, spec := range cmd.ArgSpecs {
+		if name != spec.Name {
+			continue
+		}
+		if nil != spec.Value {
+			return spec.Value
+		}
+		return spec.Default
+	}
+	return nil
+}
+
+/*
+argsSynopsis returns the positional part of the command's usage line
+*/
+func (cmd *Cmd) argsSynopsis() string {
+	if 0 == len(cmd.ArgSpecs) {
+		return "[args...]"
+	}
+	parts := make([]string, 0, len(cmd.ArgSpecs))
+	for _, spec := range cmd.ArgSpecs {
+		parts = append(parts, spec.synopsis())
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArgSpecs(t *testing.T) {
+	app := newApp(nil, &Cmd{
+		Name: "copy",
+		ArgSpecs: []*Arg{
+			{Name: "dest"},
+			{Name: "mode", Default: "fast"},
+			{Name: "sources", Variadic: true},
+		},
+	}, &Cmd{
+		Name:     "wait",
+		ArgSpecs: []*Arg{{Name: "timeout", Default: time.Duration(0)}},
+	})
+	if err := app.Execute([]string{"app", "copy", "/tmp", "safe", "a", "b"}); nil != err {
+		t.Fatal(err)
+	}
+	cmd := app.Cmds["copy"]
+	if "/tmp" != cmd.ArgValue("dest") || "safe" != cmd.ArgValue("mode") {
+		t.Errorf("expected dest and mode to be set, %v found", cmd.ArgSpecs)
+	}
+	if expect := []interface{}{"a", "b"}; !reflect.DeepEqual(expect, cmd.ArgValue("sources")) {
+		t.Errorf("expected %v, %v found", expect, cmd.ArgValue("sources"))
+	}
+
+	if err := app.Execute([]string{"app", "wait", "90s"}); nil != err {
+		t.Fatal(err)
+	}
+	if 90*time.Second != app.Cmds["wait"].ArgValue("timeout") || !app.Cmds["wait"].ArgSpecs[0].Called {
+		t.Errorf("expected a 90s timeout, %v found", app.Cmds["wait"].ArgValue("timeout"))
+	}
+	if err := app.Execute([]string{"app", "wait"}); nil != err || time.Duration(0) != app.Cmds["wait"].ArgValue("timeout") {
+		t.Errorf("expected the default timeout, %v (%v) found", app.Cmds["wait"].ArgValue("timeout"), err)
+	}
+}
+
+func TestArgSpecErrors(t *testing.T) {
+	tests := []struct {
+		args   []string
+		target interface{}
+		expect string
+	}{
+		{[]string{"copy"}, new(*MissingArgError), "missing argument <dest> for 'app copy'"},
+		{[]string{"copy", "/tmp", "fast"}, new(*MissingArgError), "missing argument <sources> for 'app copy'"},
+		{[]string{"copy", "/tmp", "slow", "a"}, new(*InvalidArgError), "invalid value 'slow' for argument <mode> of 'app copy': must be one of fast, safe"},
+		{[]string{"copy", "/tmp", "fast", "a", "b", "c", "d"}, new(*ArgCountError), "argument <sources> of 'app copy' takes at most 3 values, 4 given"},
+		{[]string{"wait", "2h"}, new(*InvalidArgError), "invalid value '2h' for argument <timeout> of 'app wait': at most 1h"},
+		{[]string{"wait", "1s", "2s"}, new(*UnexpectedArgError), "unexpected argument '2s' for 'app wait'"},
+	}
+	app := newApp(nil, &Cmd{
+		Name: "copy",
+		ArgSpecs: []*Arg{
+			{Name: "dest", Required: true},
+			{Name: "mode", Default: "fast", Allowed: []string{"fast", "safe"}},
+			{Name: "sources", Variadic: true, Min: 1, Max: 3},
+		},
+	}, &Cmd{
+		Name: "wait",
+		ArgSpecs: []*Arg{
+			{Name: "timeout", Default: time.Duration(0), Validate: func(value interface{}) error {
+				if value.(time.Duration) > time.Hour {
+					return fmt.Errorf("at most 1h")
+				}
+				return nil
+			}},
+		},
+	})
+	for _, test := range tests {
+		err := app.Execute(append([]string{"app"}, test.args...))
+		if !errors.As(err, test.target) || test.expect != err.Error() {
+			t.Errorf("%v: expected %s, %v found", test.args, test.expect, err)
+		}
+		if ExitUsage != ExitCode(err) {
+			t.Errorf("%v: expected exit status %d, %d found", test.args, ExitUsage, ExitCode(err))
+		}
+	}
+}
+
+func TestArgSpecDefinitions(t *testing.T) {
+	tests := []struct {
+		specs  []*Arg
+		expect string
+	}{
+		{[]*Arg{{Name: "sources", Variadic: true}, {Name: "dest"}}, "invalid argument <sources> of 'app copy': only the last argument can be variadic"},
+		{[]*Arg{{Name: "dest"}, {Name: "sources", Variadic: true, Min: 3, Max: 2}}, "invalid argument <sources> of 'app copy': min is greater than max"},
+		{[]*Arg{{Name: "dest"}, {Name: "sources", Variadic: true, Min: 3}}, ""},
+	}
+	app := newApp(nil, &Cmd{Name: "copy"}, &Cmd{Name: "wait"})
+	for _, test := range tests {
+		app.Cmds["copy"].ArgSpecs = test.specs
+
+		// the specs of every command are checked, not only the one called
+		err := app.Execute([]string{"app", "wait"})
+		var specErr *ArgSpecError
+		if "" == test.expect && nil != err {
+			t.Errorf("expected no error, %v found", err)
+		} else if "" != test.expect && (!errors.As(err, &specErr) || test.expect != err.Error()) {
+			t.Errorf("expected %s, %v found", test.expect, err)
+		}
+	}
+}
+
+func TestArgSpecHelp(t *testing.T) {
+	t.Setenv("COLUMNS", "80")
+	var stdout bytes.Buffer
+	app := newApp(nil, &Cmd{
+		Name: "copy",
+		ArgSpecs: []*Arg{
+			{Name: "dest", Required: true, Description: "Where to copy to"},
+			{Name: "mode", Default: "fast", Allowed: []string{"fast", "safe"}},
+			{Name: "sources", Variadic: true, Min: 1},
+		},
+	})
+	app.Stdout = &stdout
+	if err := app.RunContext(context.Background(), []string{"app", "copy", "--help"}); nil != err {
+		t.Fatal(err)
+	}
+	expect := `Usage:
+  app copy [flags] <dest> [mode] <sources...>
+
+Arguments:
+  <dest>             Where to copy to (required)
+  [mode] fast|safe   (default "fast")
+  <sources...>
+`
+	if !strings.HasPrefix(stdout.String(), expect) {
+		t.Errorf("expected\n%s\nfound\n%s", expect, stdout.String())
+	}
+}
@@ -12,6 +12,7 @@ func New1(arguments ...[]string) (*Cli, error) {
 type Cli struct {
 	cmd   string
 	path  string
+	Args  []string
 	Flags []*Flag
 }
 
@@ -19,6 +20,32 @@ func (cli *Cli) Push(flag *Flag) {
 	cli.Flags = append(cli.Flags, flag)
 }
 
+/*
+Cmd returns the program name
+*/
+func (cli *Cli) Cmd() string {
+	return cli.cmd
+}
+
+/*
+Path returns the directory of the program
+*/
+func (cli *Cli) Path() string {
+	return cli.path
+}
+
+/*
+Flag returns the last flag passed with a name, or nil
+*/
+func (cli *Cli) Flag(name string) *Flag {
+	for a := len(cli.Flags) - 1; a >= 0; a-- {
+		if name == cli.Flags[a].Name {
+			return cli.Flags[a]
+		}
+	}
+	return nil
+}
+
 /*
 Cli is an interface
 */
@@ -29,70 +56,6 @@ type CliIface interface {
 	Workdir() string
 }
 
-/*
-Parse parses the os.Args parameters by default. Optionally a []string
-value may be passed.
-*/
-func Parse(arguments ...[]string) (*Cli, error) {
-	return nil, nil
-	//	args := os.Args
-	//	if len(arguments) > 0 {
-	//		args = arguments[0]
-	//	}
-	//
-	//	// break the path and the command into separate tokens
-	//	args = append([]string{path.Dir(args[0]), path.Base(args[0])}, args[1:]...)
-	//
-	//	cli := &Cli{}
-	//	flag := &Flag{}
-	//	var isLongFlag bool
-	//	var isShortFlag bool
-	//	var isArg bool
-	//	var wasLongFlag bool
-	//	var wasShortFlag bool
-	//	var wasArg bool
-	//	for idx, token := range args {
-	//		wasLongFlag = isLongFlag
-	//		wasShortFlag = isShortFlag
-	//		wasArg = isArg
-	//
-	//		runes := []rune(token)
-	//		var isArg bool
-	//		if "---" == string(runes[0:3]) || "-" != string(runes[0:1]) {
-	//			isArg = true
-	//		}
-	//
-	//		var isLongFlag bool
-	//		if "--" == string(runes[0:2]) && !isArg {
-	//			isLongFlag = true
-	//			runes = runes[2:]
-	//		}
-	//
-	//		var isShortFlag bool
-	//		if "-" == string(runes[0:]) && !isLongFlag {
-	//			isShortFlag = true
-	//			runes = runes[1:]
-	//		}
-	//
-	//		if wasArg && isArg {
-	//
-	//		}
-	//
-	//		if isLongFlag || isShortFlag {
-	//			parts := strings.Split(token, "=")
-	//			token = parts[0]
-	//			if 2 == len(parts) {
-	//				flag.Value = parts[1]
-	//			}
-	//		}
-	//
-	//		//cli.Push()
-	//
-	//		fmt.Println(token)
-	//	}
-	//	return cli, nil
-}
-
 /*
 Usage is a func
 */
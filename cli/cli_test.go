@@ -1,32 +1,214 @@
 package cli
 
 import (
-	"fmt"
+	"errors"
+	"reflect"
 	"testing"
 )
 
-func Test(t *testing.T) {
-	app := New(func() { fmt.Println("") })
-	cmds := []*Cmd{
-		&Cmd{
-			Name: "cmd-name",
-			Flags: map[string]*Flag{
-				"cmd-flag-name": {
-					Name:     "cmd-flag-name",
-					Default:  "cmd-flag-value",
-					Required: false,
-				},
-			},
+/*
+newApp returns an "app" command with the given flags and subcommands
+*/
+func newApp(flags map[string]*Flag, cmds ...*Cmd) *Cmd {
+	app := &Cmd{Name: "app", Cmds: map[string]*Cmd{}, Flags: flags}
+	app.PushCmds(cmds...)
+	return app
+}
+
+func TestExecute(t *testing.T) {
+	app := newApp(map[string]*Flag{
+		"app-flag-name": {Name: "app-flag-name", Default: "app-flag-value"},
+		"debug":         {Name: "debug", Default: false},
+	}, &Cmd{
+		Name: "cmd-name",
+		Flags: map[string]*Flag{
+			"cmd-flag-name": {Name: "cmd-flag-name", Default: "cmd-flag-value"},
+			"count":         {Name: "count", Default: 0},
+			"v":             {Name: "v", Default: false},
 		},
+	})
+	err := app.Execute([]string{"/usr/bin/app", "--app-flag-name=a", "--debug", "cmd-name", "--cmd-flag-name", "b", "-count=3", "-v", "one", "--", "--two"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "app" != app.Name || "/usr/bin" != app.Path {
+		t.Errorf("expected app in /usr/bin, %s in %s found", app.Name, app.Path)
+	}
+	if "a" != app.Flags["app-flag-name"].Value || true != app.Flags["debug"].Value {
+		t.Errorf("expected root flags to be set, %v found", app.Flags)
+	}
+
+	cmd := app.Cmds["cmd-name"]
+	if !cmd.Called {
+		t.Errorf("expected cmd-name to be called")
+	}
+	if "b" != cmd.Flags["cmd-flag-name"].Value || 3 != cmd.Flags["count"].Value || true != cmd.Flags["v"].Value {
+		t.Errorf("expected command flags to be set, %v found", cmd.Flags)
+	}
+	if expect := []string{"one", "--two"}; !reflect.DeepEqual(expect, cmd.Positional) {
+		t.Errorf("expected %v, %v found", expect, cmd.Positional)
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	app := newApp(map[string]*Flag{
+		"app-flag-name": {Name: "app-flag-name", Default: "app-flag-value"},
+	}, &Cmd{
+		Name:  "cmd-name",
+		Flags: map[string]*Flag{"count": {Name: "count", Default: 0}},
+	})
+
+	var unknownFlag *UnknownFlagError
+	err := app.Execute([]string{"app", "cmd-name", "--nope"})
+	if !errors.As(err, &unknownFlag) || "app cmd-name" != unknownFlag.Cmd || "--nope" != unknownFlag.Flag {
+		t.Errorf("expected an UnknownFlagError, %v found", err)
+	}
+
+	var unknownCmd *UnknownCommandError
+	if err := app.Execute([]string{"app", "nope"}); !errors.As(err, &unknownCmd) || "nope" != unknownCmd.Name {
+		t.Errorf("expected an UnknownCommandError, %v found", err)
+	}
+
+	var missing *MissingValueError
+	if err := app.Execute([]string{"app", "--app-flag-name"}); !errors.As(err, &missing) {
+		t.Errorf("expected a MissingValueError, %v found", err)
+	}
+
+	var invalid *InvalidValueError
+	if err := app.Execute([]string{"app", "cmd-name", "--count", "x"}); !errors.As(err, &invalid) || "x" != invalid.Value {
+		t.Errorf("expected an InvalidValueError, %v found", err)
+	}
+}
+
+func TestExecuteShortArgs(t *testing.T) {
+	app := newApp(nil, &Cmd{Name: "cmd-name"})
+	if err := app.Execute([]string{"app", "cmd-name", "-", "-5", "a"}); nil != err {
+		t.Fatal(err)
+	}
+	if expect := []string{"-", "-5", "a"}; !reflect.DeepEqual(expect, app.Cmds["cmd-name"].Positional) {
+		t.Errorf("expected %v, %v found", expect, app.Cmds["cmd-name"].Positional)
+	}
+}
+
+func TestParse(t *testing.T) {
+	cli, err := Parse([]string{"/bin/tool", "--name=value", "-v", "arg", "--", "--not-a-flag"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "tool" != cli.Cmd() || "/bin" != cli.Path() {
+		t.Errorf("expected tool in /bin, %s in %s found", cli.Cmd(), cli.Path())
+	}
+	if flag := cli.Flag("name"); nil == flag || "value" != flag.Value {
+		t.Errorf("expected --name=value, %v found", flag)
+	}
+	if flag := cli.Flag("v"); nil == flag || true != flag.Value {
+		t.Errorf("expected -v, %v found", flag)
+	}
+	if expect := []string{"arg", "--not-a-flag"}; !reflect.DeepEqual(expect, cli.Args) {
+		t.Errorf("expected %v, %v found", expect, cli.Args)
+	}
+}
+
+func TestExecuteShortFlags(t *testing.T) {
+	app := newApp(map[string]*Flag{
+		"extract": {Name: "extract", Short: "x", Default: false},
+		"verbose": {Name: "verbose", Short: "v", Default: Counter(0)},
+		"file":    {Name: "file", Short: "f", Default: ""},
+		"exclude": {Name: "exclude", Default: []string{"*.tmp"}},
+		"label":   {Name: "label", Short: "l", Default: map[string]string{}},
+		"port":    {Name: "port", Default: []int(nil)},
+	})
+	err := app.Execute([]string{"tar", "-xvvf", "a.tar", "-v", "--exclude", "*.log", "--exclude=*.bak", "-l", "env=prod", "--label=team=web", "--port", "80", "-lregion=eu", "b"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	flags := FlagSet(app.Flags)
+	if !flags.Bool("extract") || 3 != flags.Count("verbose") || "a.tar" != flags.String("file") {
+		t.Errorf("expected -xvvf a.tar -v to be parsed, %v found", app.Flags)
+	}
+	if expect := []string{"*.log", "*.bak"}; !reflect.DeepEqual(expect, flags.Strings("exclude")) {
+		t.Errorf("expected %v, %v found", expect, flags.Strings("exclude"))
+	}
+	if expect := map[string]string{"env": "prod", "team": "web", "region": "eu"}; !reflect.DeepEqual(expect, flags.StringMap("label")) {
+		t.Errorf("expected %v, %v found", expect, flags.StringMap("label"))
+	}
+	if expect := []int{80}; !reflect.DeepEqual(expect, flags.Value("port")) {
+		t.Errorf("expected %v, %v found", expect, flags.Value("port"))
+	}
+	if expect := []string{"b"}; !reflect.DeepEqual(expect, app.Positional) {
+		t.Errorf("expected %v, %v found", expect, app.Positional)
+	}
+
+	if err := app.Execute([]string{"tar", "-fx"}); nil != err || "x" != flags.String("file") {
+		t.Errorf("expected the rest of a bundle to be the value, %v (%v) found", flags.Value("file"), err)
+	}
+	if err := app.Execute([]string{"tar", "--verbose=5"}); nil != err || 5 != flags.Count("verbose") {
+		t.Errorf("expected a count to be set, %v (%v) found", flags.Value("verbose"), err)
+	}
+	if err := app.Execute([]string{"tar"}); nil != err || !reflect.DeepEqual([]string{"*.tmp"}, flags.Strings("exclude")) {
+		t.Errorf("expected the default slice, %v (%v) found", flags.Value("exclude"), err)
+	}
+
+	var unknown *UnknownFlagError
+	if err := app.Execute([]string{"tar", "-xq"}); !errors.As(err, &unknown) || "-q" != unknown.Flag {
+		t.Errorf("expected an UnknownFlagError for -q, %v found", err)
+	}
+	var missing *MissingValueError
+	if err := app.Execute([]string{"tar", "-xf"}); !errors.As(err, &missing) || "-f" != missing.Flag {
+		t.Errorf("expected a MissingValueError for -f, %v found", err)
+	}
+	var invalid *InvalidValueError
+	if err := app.Execute([]string{"tar", "--label", "nope"}); !errors.As(err, &invalid) {
+		t.Errorf("expected an InvalidValueError, %v found", err)
+	}
+}
+
+func TestExecutePersistentFlags(t *testing.T) {
+	db := &Cmd{Name: "db", Cmds: map[string]*Cmd{}, Flags: map[string]*Flag{}}
+	migrate := &Cmd{
+		Name:  "migrate",
+		Flags: map[string]*Flag{"region": {Name: "region", Default: 0}},
+	}
+	db.PushCmds(migrate)
+	app := newApp(map[string]*Flag{
+		"verbose": {Name: "verbose", Short: "v", Default: false, Persistent: true},
+		"region":  {Name: "region", Default: "eu", Persistent: true},
+		"local":   {Name: "local", Default: false},
+	}, db)
+
+	for _, args := range [][]string{
+		{"app", "--verbose", "db", "migrate"},
+		{"app", "db", "--verbose", "migrate"},
+		{"app", "db", "migrate", "-v"},
+	} {
+		if err := app.Execute(args); nil != err {
+			t.Fatal(err)
+		}
+		if true != app.Flags["verbose"].Value || !migrate.Called {
+			t.Errorf("%v: expected --verbose to be set, %v found", args, app.Flags["verbose"].Value)
+		}
+	}
+
+	// a local flag shadows a persistent flag with the same name
+	if err := app.Execute([]string{"app", "--region=us", "db", "migrate", "--region", "3"}); nil != err {
+		t.Fatal(err)
+	}
+	if "us" != app.Flags["region"].Value || 3 != migrate.Flags["region"].Value {
+		t.Errorf("expected both region flags to be set, %v and %v found", app.Flags["region"].Value, migrate.Flags["region"].Value)
+	}
+	if flags := migrate.resolvedFlags(); 3 != flags.Int("region") {
+		t.Errorf("expected the local region flag, %v found", flags.Value("region"))
+	}
+	if err := app.Execute([]string{"app", "db", "--region", "us"}); nil != err || "us" != app.Flags["region"].Value {
+		t.Errorf("expected the persistent region flag, %v (%v) found", app.Flags["region"].Value, err)
+	}
+
+	// flags that aren't persistent only belong to their command
+	var unknown *UnknownFlagError
+	if err := app.Execute([]string{"app", "db", "--local"}); !errors.As(err, &unknown) || "app db" != unknown.Cmd {
+		t.Errorf("expected an UnknownFlagError, %v found", err)
+	}
+	if err := app.Execute([]string{"app", "--local", "db"}); nil != err || true != app.Flags["local"].Value {
+		t.Errorf("expected --local before db to be set, %v found", err)
 	}
-	flags := []*Flag{{
-		Name:     "app-flag-name",
-		Default:  "app-flag-value",
-		Required: false,
-	}}
-	app.PushCmds(cmds...)
-	app.PushFlags(flags...)
-	fmt.Printf("\n\n%s\n\n", app)
-	Parse()
-	t.Errorf("no")
 }
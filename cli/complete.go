@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+CompleteCmd is the hidden command the completion scripts run to get the
+candidates for the word being completed:
+
+	app __complete serve --port ""
+*/
+const CompleteCmd = "__complete"
+
+/*
+CompleteFunc returns the candidates for a flag value or positional argument.
+flags holds the flags given so far, args the positional arguments before the
+word being completed. Candidates that don't start with toComplete are
+dropped
+*/
+type CompleteFunc func(ctx context.Context, flags FlagSet, args []string, toComplete string) []string
+
+/*
+Shells that completion scripts can be generated for
+*/
+var Shells = []string{"bash", "zsh", "fish", "powershell"}
+
+var completionTemplates = map[string]string{
+	"bash": `# bash completion for %[1]s
+_%[2]s_complete() {
+    local IFS=$'\n'
+    COMPREPLY=($("${COMP_WORDS[0]}" %[3]s "${COMP_WORDS[@]:1:$COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _%[2]s_complete %[1]s
+`,
+	"zsh": `#compdef %[1]s
+_%[2]s() {
+    local -a candidates
+    candidates=("${(@f)$("${words[1]}" %[3]s "${(@)words[2,$CURRENT]}" 2>/dev/null)}")
+    if [[ -n "${candidates[1]}" ]]; then
+        compadd -Q -- "${candidates[@]}"
+    else
+        _files
+    fi
+}
+compdef _%[2]s %[1]s
+`,
+	"fish": `function __%[2]s_complete
+    set -l words (commandline -opc) (commandline -ct)
+    $words[1] %[3]s $words[2..-1] 2>/dev/null
+end
+complete -c %[1]s -f -a '(__%[2]s_complete)'
+`,
+	"powershell": `Register-ArgumentCompleter -Native -CommandName '%[1]s' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements |
+        Where-Object { $_.Extent.StartOffset -lt $cursorPosition } |
+        ForEach-Object { $_.ToString() })
+    if ('' -eq $wordToComplete) { $words += '' }
+    $rest = @($words | Select-Object -Skip 1)
+    & $words[0] %[3]s @rest 2>$null | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+/*
+Completion writes the completion script for a shell, one of Shells. The
+script completes the command tree by running the program with CompleteCmd
+*/
+func (cmd *Cmd) Completion(shell string, writer io.Writer) error {
+	script, ok := completionTemplates[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell '%s', expected one of %s", shell, strings.Join(Shells, ", "))
+	}
+	_, err := fmt.Fprintf(writer, script, cmd.Name, unsafeName.ReplaceAllString(cmd.Name, "_"), CompleteCmd)
+	return err
+}
+
+/*
+CompletionCmd returns a "completion" command that writes the completion
+script for the shell given as its argument
+
+	app.PushCmds(app.CompletionCmd())
+*/
+func (cmd *Cmd) CompletionCmd() *Cmd {
+	return &Cmd{
+		Name:        "completion",
+		Short:       "Generate a shell completion script",
+		Description: fmt.Sprintf("Writes the completion script for %s to stdout.", strings.Join(Shells, ", ")),
+		Examples:    []string{"source <(" + cmd.Name + " completion bash)"},
+		// The script doesn't depend on the flags, required flags such as
+		// credentials must not stop it from being generated
+		SkipFlagChecks: true,
+		Complete: func(ctx context.Context, flags FlagSet, args []string, toComplete string) []string {
+			if 0 != len(args) {
+				return nil
+			}
+			return Shells
+		},
+		Run: func(ctx context.Context, flags FlagSet, args []string) error {
+			if 1 != len(args) {
+				return fmt.Errorf("expected a shell, one of %s", strings.Join(Shells, ", "))
+			}
+			return cmd.Completion(args[0], cmd.stdout())
+		},
+	}
+}
+
+/*
+isCompletion reports whether the arguments run CompleteCmd
+*/
+func isCompletion(args []string) bool {
+	return len(args) > 1 && CompleteCmd == args[1]
+}
+
+/*
+complete writes the candidates for the last argument, one per line. The
+arguments before it are parsed leniently, invalid flags are ignored
+*/
+func (cmd *Cmd) complete(ctx context.Context, args []string, writer io.Writer) error {
+	cmd.Path = path.Dir(args[0])
+	cmd.Name = path.Base(args[0])
+	words := args[2:]
+	toComplete := ""
+	if 0 != len(words) {
+		toComplete = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	cmd.defineConfigFlag()
+	pending, terminated, _ := cmd.parseArgs(words, true)
+	current := cmd.Selected()
+	positional := current.Positional
+
+	var candidates []string
+	prefix := ""
+	flags := current.resolvedFlags()
+	name, value, hasValue := splitFlag(toComplete)
+	named := current.lookupFlag(name)
+	switch {
+	case nil != pending:
+		candidates = pending.completeValue(ctx, flags, positional, toComplete)
+
+	case !terminated && strings.HasPrefix(toComplete, "-") && hasValue && nil != named:
+		prefix = toComplete[:len(toComplete)-len(value)]
+		candidates = named.completeValue(ctx, flags, positional, value)
+		toComplete = value
+
+	case !terminated && isBundle(toComplete) && !isNumberArg(toComplete):
+		candidates, prefix, toComplete = current.completeBundle(ctx, flags, positional, toComplete)
+
+	case !terminated && strings.HasPrefix(toComplete, "-"):
+		for name, flag := range flags {
+			if 1 == len(name) {
+				candidates = append(candidates, "-"+name)
+			} else {
+				candidates = append(candidates, "--"+name)
+			}
+			if "" != flag.Short {
+				candidates = append(candidates, "-"+flag.Short)
+			}
+		}
+
+	default:
+		if 0 == len(positional) && !terminated {
+			for name := range current.Cmds {
+				candidates = append(candidates, name)
+			}
+		}
+		for name := range current.Args {
+			candidates = append(candidates, name)
+		}
+		if spec := current.argSpec(len(positional)); nil != spec {
+			candidates = append(candidates, spec.Allowed...)
+		}
+		if nil != current.Complete {
+			candidates = append(candidates, current.Complete(ctx, flags, positional, toComplete)...)
+		}
+	}
+
+	sort.Strings(candidates)
+	for k, candidate := range candidates {
+		if strings.HasPrefix(candidate, toComplete) && (0 == k || candidate != candidates[k-1]) {
+			if _, err := fmt.Fprintln(writer, prefix+candidate); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+completeBundle returns the candidates for bundled short flags: "-xv" completes
+to itself and the short flags that can follow it, "-xfa" to the values of -f
+starting with "a". It returns the prefix to write before each candidate and
+the part of the word the candidates must start with
+*/
+func (cmd *Cmd) completeBundle(ctx context.Context, flags FlagSet, args []string, toComplete string) ([]string, string, string) {
+	for k := 1; k < len(toComplete); k++ {
+		flag := cmd.lookupFlag(toComplete[k : k+1])
+		if nil == flag {
+			return nil, "", toComplete
+		}
+		if flag.takesValue() {
+			prefix := toComplete[:k+1]
+			if strings.HasPrefix(toComplete[k+1:], "=") {
+				prefix += "="
+			}
+			value := toComplete[len(prefix):]
+			return flag.completeValue(ctx, flags, args, value), prefix, value
+		}
+	}
+
+	candidates := []string{toComplete}
+	for name, flag := range flags {
+		if 1 == len(name) {
+			candidates = append(candidates, toComplete+name)
+		}
+		if "" != flag.Short {
+			candidates = append(candidates, toComplete+flag.Short)
+		}
+	}
+	return candidates, "", toComplete
+}
+
+/*
+completeValue returns the candidates for a flag's value: the Complete
+callback, the allowed values of an enum or true and false
+*/
+func (f *Flag) completeValue(ctx context.Context, flags FlagSet, args []string, toComplete string) []string {
+	switch {
+	case nil != f.Complete:
+		return f.Complete(ctx, flags, args, toComplete)
+	case 0 != len(f.Allowed):
+		return f.Allowed
+	case Bool == f.Type():
+		return []string{"false", "true"}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	var stdout bytes.Buffer
+	app := newApp(map[string]*Flag{
+		"v":      {Name: "v", Default: false, Persistent: true},
+		"format": {Name: "format", Short: "o", Default: "json", Allowed: []string{"json", "yaml", "text"}, Persistent: true},
+	}, &Cmd{
+		Name: "deploy",
+		Args: map[string]*Arg{"all": {Name: "all"}},
+		Flags: map[string]*Flag{
+			"region": {
+				Name:    "region",
+				Default: "",
+				Complete: func(ctx context.Context, flags FlagSet, args []string, toComplete string) []string {
+					if flags.Bool("v") {
+						return []string{"eu-west-1", "eu-central-1", "us-east-1"}
+					}
+					return []string{"eu-west-1", "us-east-1"}
+				},
+			},
+		},
+		Complete: func(ctx context.Context, flags FlagSet, args []string, toComplete string) []string {
+			return []string{"web-" + flags.String("region"), "worker"}
+		},
+	}, &Cmd{Name: "destroy"})
+	app.PushCmds(app.CompletionCmd())
+	app.Stdout = &stdout
+
+	for args, expect := range map[string]string{
+		"":                                  "completion deploy destroy",
+		"de":                                "deploy destroy",
+		"-":                                 "--format -o -v",
+		"-o ":                               "json text yaml",
+		"--format ":                         "json text yaml",
+		"--format y":                        "yaml",
+		"--format=t":                        "--format=text",
+		"--format json de":                  "deploy destroy",
+		"deploy --region eu":                "eu-west-1",
+		"-v deploy --region eu":             "eu-central-1 eu-west-1",
+		"deploy --":                         "--format --region",
+		"deploy -":                          "--format --region -o -v",
+		"deploy --region us-east-1 ":        "all web-us-east-1 worker",
+		"deploy --region us-east-1 worker ": "all web-us-east-1 worker",
+		"deploy -o ":                        "json text yaml",
+		"destroy -v --":                     "--format",
+		"deploy -- -":                       "",
+		"-vo ":                              "json text yaml",
+		"-vo y":                             "yaml",
+		"-vo":                               "-vojson -votext -voyaml",
+		"-vo=t":                             "-vo=text",
+		"-vv":                               "-vv -vvo -vvv",
+		"-vq":                               "",
+		"-vo yaml de":                       "deploy destroy",
+		"-v deploy -vo ":                    "json text yaml",
+		"-- de":                             "",
+		"completion ":                       "bash fish powershell zsh",
+		"nope ":                             "",
+	} {
+		stdout.Reset()
+		words := strings.Split(args, " ")
+		if err := app.RunContext(context.Background(), append([]string{"/bin/app", CompleteCmd}, words...)); nil != err {
+			t.Fatal(err)
+		}
+		if found := strings.Join(strings.Fields(stdout.String()), " "); expect != found {
+			t.Errorf("%q: expected %q, %q found", args, expect, found)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	var stdout bytes.Buffer
+	app := newApp(map[string]*Flag{
+		"token": {Name: "token", Default: "", Required: true, Persistent: true},
+	}, &Cmd{Name: "deploy"})
+	app.PushCmds(app.CompletionCmd())
+	app.Stdout = &stdout
+
+	// required flags don't stop the script from being generated
+	for _, shell := range Shells {
+		stdout.Reset()
+		if err := app.RunContext(context.Background(), []string{"my-app", "completion", shell}); nil != err {
+			t.Fatal(err)
+		}
+		if !strings.Contains(stdout.String(), "my-app") || !strings.Contains(stdout.String(), CompleteCmd) {
+			t.Errorf("%s: expected a script for my-app, %s found", shell, stdout.String())
+		}
+	}
+	if err := app.Execute([]string{"app", "deploy"}); nil == err {
+		t.Errorf("expected --token to be required for other commands")
+	}
+
+	stdout.Reset()
+	if err := app.Completion("tcsh", &stdout); nil == err {
+		t.Errorf("expected an error for an unsupported shell")
+	}
+	app.Completion("bash", &stdout)
+	if !strings.Contains(stdout.String(), "_app_complete()") {
+		t.Errorf("expected a bash function, %s found", stdout.String())
+	}
+}
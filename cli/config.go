@@ -0,0 +1,345 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+/*
+Where a flag's value came from, set in Flag.Source by Execute
+*/
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+/*
+DefaultConfigFlag is the name of the flag that selects a config file when a
+command has ConfigPaths but no ConfigFlag
+*/
+const DefaultConfigFlag = "config"
+
+/*
+configFlag returns the name of the flag that selects a config file, empty if
+config files aren't used
+*/
+func (cmd *Cmd) configFlag() string {
+	if "" != cmd.ConfigFlag {
+		return cmd.ConfigFlag
+	}
+	if 0 != len(cmd.ConfigPaths) {
+		return DefaultConfigFlag
+	}
+	return ""
+}
+
+/*
+defineConfigFlag adds the config file flag if the command uses config files
+and doesn't define it
+*/
+func (cmd *Cmd) defineConfigFlag() {
+	name := cmd.configFlag()
+	if "" == name {
+		return
+	}
+	if nil == cmd.Flags {
+		cmd.Flags = make(map[string]*Flag)
+	}
+	if _, ok := cmd.Flags[name]; !ok {
+		cmd.Flags[name] = &Flag{Name: name, Default: "", Description: "Configuration file", Persistent: true}
+	}
+}
+
+/*
+lookupEnv returns the first of a flag's environment variables that is set
+*/
+func (f *Flag) lookupEnv() (name, value string, ok bool) {
+	for _, name := range f.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			return name, value, true
+		}
+	}
+	return "", "", false
+}
+
+/*
+findConfig returns the config file to load: the value of the config flag,
+from the command line or the environment, or the first of ConfigPaths that
+exists
+*/
+func (cmd *Cmd) findConfig() (string, error) {
+	flag, ok := cmd.Flags[cmd.configFlag()]
+	if !ok {
+		return "", nil
+	}
+	if flag.Called {
+		return formatValue(flag.Value), nil
+	}
+	if _, value, ok := flag.lookupEnv(); ok {
+		return value, nil
+	}
+	for _, file := range cmd.ConfigPaths {
+		file = expandPath(file)
+		if _, err := os.Stat(file); nil == err {
+			return file, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", &ConfigFileError{Path: file, Err: err}
+		}
+	}
+	return "", nil
+}
+
+/*
+expandPath expands environment variables and a leading "~/"
+*/
+func expandPath(file string) string {
+	file = os.ExpandEnv(file)
+	if strings.HasPrefix(file, "~/") {
+		if home, err := os.UserHomeDir(); nil == err {
+			file = filepath.Join(home, file[2:])
+		}
+	}
+	return file
+}
+
+/*
+LoadConfigFile reads a JSON, YAML or TOML file, chosen by its extension
+*/
+func LoadConfigFile(file string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if nil != err {
+		return nil, &ConfigFileError{Path: file, Err: err}
+	}
+
+	var value interface{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&value)
+	case ".yaml", ".yml":
+		value, err = ParseYAML(data)
+	case ".toml":
+		value, err = ParseTOML(data)
+	default:
+		err = fmt.Errorf("unsupported format, expected .json, .yaml, .yml or .toml")
+	}
+	if nil != err {
+		return nil, &ConfigFileError{Path: file, Err: err}
+	}
+
+	switch typed := value.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return typed, nil
+	}
+	return nil, &ConfigFileError{Path: file, Err: fmt.Errorf("expected a mapping of settings")}
+}
+
+/*
+configSettings flattens a config file section into flag names. Nested
+mappings are joined with "-" and "_" is read as "-", so "limits: {max_size:
+1}" sets --limits-max-size. Mappings named after a sub-command are that
+command's section and are returned separately
+*/
+func (cmd *Cmd) configSettings(section map[string]interface{}) (settings map[string]interface{}, sections map[string]map[string]interface{}, err error) {
+	settings = make(map[string]interface{})
+	sections = make(map[string]map[string]interface{})
+	unknown := make([]string, 0)
+
+	var flatten func(prefix string, values map[string]interface{})
+	flatten = func(prefix string, values map[string]interface{}) {
+		for key, value := range values {
+			name := prefix + strings.ReplaceAll(key, "_", "-")
+			if nested, ok := value.(map[string]interface{}); ok {
+				if _, isCmd := cmd.Cmds[name]; isCmd && "" == prefix {
+					sections[name] = nested
+					continue
+				}
+				if _, isFlag := cmd.Flags[name]; !isFlag {
+					flatten(name+"-", nested)
+					continue
+				}
+			}
+			if _, ok := cmd.Flags[name]; !ok {
+				unknown = append(unknown, name)
+				continue
+			}
+			settings[name] = value
+		}
+	}
+	flatten("", section)
+
+	if 0 != len(unknown) {
+		sort.Strings(unknown)
+		return nil, nil, fmt.Errorf("unknown settings for '%s': %s", cmd.commandPath(), strings.Join(unknown, ", "))
+	}
+	return settings, sections, nil
+}
+
+/*
+configValues formats a config file value so it can be passed to Flag.Set.
+Lists set repeatable flags once for each item and mappings set map flags once
+for each key
+*/
+func configValues(flag *Flag, value interface{}) ([]string, error) {
+	if JSON == flag.Type() {
+		data, err := json.Marshal(value)
+		return []string{string(data)}, err
+	}
+
+	switch typed := value.(type) {
+	case []interface{}:
+		if Slice != flag.Type() {
+			return nil, fmt.Errorf("expected a single value")
+		}
+		values := make([]string, 0, len(typed))
+		for _, item := range typed {
+			values = append(values, formatValue(item))
+		}
+		return values, nil
+	case map[string]interface{}:
+		if Map != flag.Type() {
+			return nil, fmt.Errorf("expected a single value")
+		}
+		values := make([]string, 0, len(typed))
+		for key, item := range typed {
+			values = append(values, key+"="+formatValue(item))
+		}
+		sort.Strings(values)
+		return values, nil
+	}
+	return []string{formatValue(value)}, nil
+}
+
+/*
+envValues splits an environment variable on commas for slice and map flags
+*/
+func envValues(flag *Flag, value string) []string {
+	switch flag.Type() {
+	case Slice, Map:
+		return strings.Split(value, ",")
+	}
+	return []string{value}
+}
+
+/*
+setAll sets a flag to each of values in turn
+*/
+func (f *Flag) setAll(values []string) (string, error) {
+	for _, value := range values {
+		if err := f.Set(value); nil != err {
+			return value, err
+		}
+	}
+	return "", nil
+}
+
+/*
+bind sets the flags that weren't passed on the command line from their
+environment variables, then the config file, and records where every value
+came from. Only the commands that were called are bound
+*/
+func (cmd *Cmd) bind() error {
+	file, err := cmd.findConfig()
+	if nil != err {
+		return err
+	}
+	section := map[string]interface{}{}
+	if "" != file {
+		if section, err = LoadConfigFile(file); nil != err {
+			return err
+		}
+	}
+
+	path := cmd.calledPath()
+	for k, current := range path {
+		settings, sections, err := current.configSettings(section)
+		if nil != err {
+			return &ConfigFileError{Path: file, Err: err}
+		}
+		for name, flag := range current.Flags {
+			if err := flag.bind(file, settings[name]); nil != err {
+				return err
+			}
+		}
+		if k+1 < len(path) {
+			section = sections[path[k+1].Name]
+		}
+	}
+	return nil
+}
+
+/*
+bind sets a flag from its environment or the config file value if it wasn't
+passed on the command line
+*/
+func (f *Flag) bind(file string, setting interface{}) error {
+	f.Source, f.Origin = SourceDefault, ""
+	if f.Called {
+		f.Source = SourceFlag
+		return nil
+	}
+
+	if name, value, ok := f.lookupEnv(); ok {
+		if invalid, err := f.setAll(envValues(f, value)); nil != err {
+			return &InvalidValueError{Flag: "--" + f.Name, Value: invalid, Source: "$" + name, Err: err}
+		}
+		f.Source, f.Origin = SourceEnv, name
+		return nil
+	}
+
+	if nil != setting {
+		values, err := configValues(f, setting)
+		invalid := formatValue(setting)
+		if nil == err {
+			invalid, err = f.setAll(values)
+		}
+		if nil != err {
+			return &InvalidValueError{Flag: "--" + f.Name, Value: invalid, Source: file, Err: err}
+		}
+		f.Source, f.Origin = SourceFile, file
+	}
+	return nil
+}
+
+/*
+WriteConfig writes the effective value of every flag and where it came from,
+e.g.
+
+	port    9000       env APP_PORT
+	root    ./public   file /etc/app.yaml
+	debug   false      default
+*/
+func (flags FlagSet) WriteConfig(writer io.Writer) error {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tabwriter.NewWriter(writer, 0, 0, 3, ' ', 0)
+	for _, name := range names {
+		flag := flags[name]
+		source := flag.Source
+		if "" == source {
+			source = SourceDefault
+		}
+		if "" != flag.Origin {
+			source += " " + flag.Origin
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", name, formatValue(flags.Value(name)), source)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	os.WriteFile(file, []byte(`
+debug: true
+timeout: 5s
+db:
+  host: db.internal
+hosts: [a, b]
+serve:
+  port: 9000
+  tags: [a, b]
+`), 0600)
+	t.Setenv("DB_HOST", "db.env")
+	t.Setenv("APP_PORT", "9100")
+
+	app := newApp(map[string]*Flag{
+		"debug":   {Name: "debug", Default: false, Env: []string{"APP_DEBUG"}, Persistent: true},
+		"timeout": {Name: "timeout", Default: time.Second, Persistent: true},
+		"db-host": {Name: "db-host", Default: "localhost", Env: []string{"APP_DB_HOST", "DB_HOST"}, Persistent: true},
+		"hosts":   {Name: "hosts", Default: []string{}, Persistent: true},
+	}, &Cmd{
+		Name: "serve",
+		Flags: map[string]*Flag{
+			"port": {Name: "port", Default: 8080, Env: []string{"APP_PORT"}},
+			"tags": {Name: "tags", Default: []byte{}},
+		},
+	})
+	app.ConfigPaths = []string{filepath.Join(filepath.Dir(file), "missing.yaml"), file}
+	if err := app.Execute([]string{"app", "--debug=false", "serve"}); nil != err {
+		t.Fatal(err)
+	}
+	flags := app.Cmds["serve"].resolvedFlags()
+	if flags.Bool("debug") || SourceFlag != flags["debug"].Source {
+		t.Errorf("expected the command line to win, %v from %s found", flags.Value("debug"), flags["debug"].Source)
+	}
+	if "db.env" != flags.String("db-host") || SourceEnv != flags["db-host"].Source || "DB_HOST" != flags["db-host"].Origin {
+		t.Errorf("expected db-host from DB_HOST, %v from %s found", flags.Value("db-host"), flags["db-host"].Source)
+	}
+	if 9100 != flags.Int("port") {
+		t.Errorf("expected port from APP_PORT, %v found", flags.Value("port"))
+	}
+	if 5*time.Second != flags.Duration("timeout") || SourceFile != flags["timeout"].Source || file != flags["timeout"].Origin {
+		t.Errorf("expected timeout from %s, %v from %s found", file, flags.Value("timeout"), flags["timeout"].Origin)
+	}
+	if expect := []string{"a", "b"}; !reflect.DeepEqual(expect, flags.Strings("hosts")) {
+		t.Errorf("expected %v, %v found", expect, flags.Value("hosts"))
+	}
+	if "[a b]" != flags.String("tags") {
+		t.Errorf("expected tags from the serve section, %v found", flags.Value("tags"))
+	}
+
+	var out bytes.Buffer
+	flags.WriteConfig(&out)
+	expect := "config                default\n" +
+		"db-host   db.env      env DB_HOST\n" +
+		"debug     false       flag\n" +
+		"hosts     a,b         file " + file + "\n" +
+		"port      9100        env APP_PORT\n" +
+		"tags      [\"a\",\"b\"]   file " + file + "\n" +
+		"timeout   5s          file " + file + "\n"
+	if expect != out.String() {
+		t.Errorf("expected\n%s\nfound\n%s", expect, out.String())
+	}
+}
+
+func TestConfigFlag(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.toml")
+	os.WriteFile(file, []byte(`
+# settings
+debug = true
+
+[serve]
+port = 9_000
+`), 0600)
+	app := newApp(map[string]*Flag{
+		"debug": {Name: "debug", Default: false, Persistent: true},
+	}, &Cmd{
+		Name:  "serve",
+		Flags: map[string]*Flag{"port": {Name: "port", Default: 8080}},
+	})
+	app.ConfigFlag = "settings"
+	if err := app.Execute([]string{"app", "--settings", file, "serve"}); nil != err {
+		t.Fatal(err)
+	}
+	if 9000 != app.Cmds["serve"].Flags["port"].Value || true != app.Flags["debug"].Value {
+		t.Errorf("expected settings from %s, %v found", file, app.Cmds["serve"].Flags["port"].Value)
+	}
+
+	file = filepath.Join(t.TempDir(), "app.json")
+	os.WriteFile(file, []byte(`{"serve": {"port": 9001}}`), 0600)
+	t.Setenv("APP_CONFIG", file)
+	app = newApp(map[string]*Flag{
+		"config": {Name: "config", Default: "", Env: []string{"APP_CONFIG"}},
+	}, &Cmd{
+		Name:  "serve",
+		Flags: map[string]*Flag{"port": {Name: "port", Default: 8080}},
+	})
+	app.ConfigPaths = []string{"~/nowhere.json"}
+	if err := app.Execute([]string{"app", "serve"}); nil != err {
+		t.Fatal(err)
+	}
+	if 9001 != app.Cmds["serve"].Flags["port"].Value {
+		t.Errorf("expected the config file from APP_CONFIG, %v found", app.Cmds["serve"].Flags["port"].Value)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	app := newApp(map[string]*Flag{
+		"debug":   {Name: "debug", Default: false, Persistent: true},
+		"timeout": {Name: "timeout", Default: time.Second, Persistent: true},
+	}, &Cmd{
+		Name:  "serve",
+		Flags: map[string]*Flag{"port": {Name: "port", Default: 8080, Env: []string{"APP_PORT"}}},
+	})
+
+	var fileErr *ConfigFileError
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	os.WriteFile(file, []byte("debug: true\nverbose: true\nserve:\n  nope: 1\n"), 0600)
+	app.ConfigPaths = []string{file}
+	if err := app.Execute([]string{"app", "serve"}); !errors.As(err, &fileErr) || !strings.Contains(err.Error(), "unknown settings for 'app': verbose") {
+		t.Errorf("expected an unknown setting error, %v found", err)
+	}
+
+	file = filepath.Join(t.TempDir(), "app.yaml")
+	os.WriteFile(file, []byte("serve:\n  nope: 1\n"), 0600)
+	app.ConfigPaths = []string{file}
+	if err := app.Execute([]string{"app", "serve"}); !errors.As(err, &fileErr) || !strings.Contains(err.Error(), "'app serve': nope") {
+		t.Errorf("expected an unknown setting error, %v found", err)
+	}
+
+	app.ConfigPaths = []string{"app.json"}
+	if err := app.Execute([]string{"app", "--config", "missing.json"}); !errors.As(err, &fileErr) {
+		t.Errorf("expected a ConfigFileError, %v found", err)
+	}
+
+	var invalid *InvalidValueError
+	file = filepath.Join(t.TempDir(), "app.yaml")
+	os.WriteFile(file, []byte("timeout: soon\n"), 0600)
+	app.ConfigPaths = []string{file}
+	if err := app.Execute([]string{"app"}); !errors.As(err, &invalid) || file != invalid.Source {
+		t.Errorf("expected an InvalidValueError from %s, %v found", file, err)
+	}
+
+	app.ConfigPaths = nil
+	t.Setenv("APP_PORT", "x")
+	if err := app.Execute([]string{"app", "serve"}); !errors.As(err, &invalid) || "$APP_PORT" != invalid.Source {
+		t.Errorf("expected an InvalidValueError from $APP_PORT, %v found", err)
+	}
+
+	t.Setenv("APP_LABELS", "a=1,b")
+	app.PushFlags(&Flag{Name: "labels", Default: map[string]string{}, Env: []string{"APP_LABELS"}})
+	if err := app.Execute([]string{"app"}); !errors.As(err, &invalid) || "b" != invalid.Value {
+		t.Errorf("expected an InvalidValueError for b, %v found", err)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	value, err := ParseTOML([]byte(`
+title = "a \"quoted\" # title" # comment
+size = 1_024
+ratio = 0.5
+enabled = true
+hosts = ["a", 'b',]
+started = 2024-01-02T03:04:05Z
+server.port = 80
+
+[limits."max body"]
+bytes = 10
+`))
+	if nil != err {
+		t.Fatal(err)
+	}
+	limits := value["limits"].(map[string]interface{})["max body"].(map[string]interface{})
+	if `a "quoted" # title` != value["title"] || json.Number("1024") != value["size"] ||
+		true != value["enabled"] || 2 != len(value["hosts"].([]interface{})) || "2024-01-02T03:04:05Z" != value["started"] ||
+		json.Number("80") != value["server"].(map[string]interface{})["port"] || nil == limits["bytes"] {
+		t.Errorf("unexpected result %v", value)
+	}
+
+	for doc, expect := range map[string]string{
+		"a = 1\na = 2":  "toml: line 2: duplicate key 'a'",
+		"a = 1\n[a]":    "toml: line 2: key 'a' is not a table",
+		"a = \"x":       "toml: line 1: invalid string \"x",
+		"a":             "toml: line 1: expected key = value",
+		"[[items]]":     "toml: line 1: arrays of tables are not supported",
+		"a = {b = 1}":   "toml: line 1: inline tables are not supported",
+		"a b = 1":       "toml: line 1: invalid key 'a b'",
+		"a = yes":       "toml: line 1: invalid value yes",
+		"a = \"\"\"x\"": "toml: line 1: multi-line strings are not supported",
+	} {
+		if _, err := ParseTOML([]byte(doc)); nil == err || expect != err.Error() {
+			t.Errorf("%q: expected %s, %v found", doc, expect, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+ConstraintKind is a relationship between flags
+*/
+type ConstraintKind int
+
+const (
+	// At most one of the flags may be set
+	Exclusive ConstraintKind = iota
+	// At least one of the flags must be set
+	OneRequired
+	// Either every flag or none of them must be set
+	AllOrNone
+	// If the first flag is set the others must be too
+	Requires
+)
+
+/*
+Constraint is a rule about which of a command's flags may be set together.
+A flag is set if it was passed or set from the environment or a config file
+*/
+type Constraint struct {
+	Kind  ConstraintKind
+	Flags []string
+}
+
+/*
+MutuallyExclusive returns a constraint that allows at most one of the flags
+*/
+func MutuallyExclusive(flags ...string) Constraint {
+	return Constraint{Kind: Exclusive, Flags: flags}
+}
+
+/*
+OneOf returns a constraint that requires at least one of the flags
+*/
+func OneOf(flags ...string) Constraint {
+	return Constraint{Kind: OneRequired, Flags: flags}
+}
+
+/*
+Together returns a constraint that requires all of the flags or none of them
+*/
+func Together(flags ...string) Constraint {
+	return Constraint{Kind: AllOrNone, Flags: flags}
+}
+
+/*
+Require returns a constraint that requires the other flags when flag is set
+*/
+func Require(flag string, required ...string) Constraint {
+	return Constraint{Kind: Requires, Flags: append([]string{flag}, required...)}
+}
+
+/*
+flagName formats a flag name as it's passed, e.g. "--port" or "-v"
+*/
+func flagName(name string) string {
+	if 1 == len(name) {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+/*
+joinFlags formats a list of flag names, e.g. "--a, --b and --c"
+*/
+func joinFlags(names []string) string {
+	formatted := make([]string, 0, len(names))
+	for _, name := range names {
+		formatted = append(formatted, flagName(name))
+	}
+	if len(formatted) < 2 {
+		return strings.Join(formatted, "")
+	}
+	return strings.Join(formatted[:len(formatted)-1], ", ") + " and " + formatted[len(formatted)-1]
+}
+
+/*
+isSet reports whether a flag has a value that isn't its default
+*/
+func (f *Flag) isSet() bool {
+	return f.Called || SourceEnv == f.Source || SourceFile == f.Source
+}
+
+/*
+check returns a description of how the command's flags break the constraint,
+empty if they don't
+*/
+func (constraint Constraint) check(cmd *Cmd) string {
+	set := make([]string, 0, len(constraint.Flags))
+	unset := make([]string, 0, len(constraint.Flags))
+	for _, name := range constraint.Flags {
+		flag := cmd.lookupFlag(name)
+		if nil == flag {
+			return fmt.Sprintf("constraint on undefined flag %s", flagName(name))
+		}
+		if flag.isSet() {
+			set = append(set, name)
+		} else {
+			unset = append(unset, name)
+		}
+	}
+
+	switch constraint.Kind {
+	case Exclusive:
+		if len(set) > 1 {
+			return fmt.Sprintf("%s can't be used together", joinFlags(set))
+		}
+	case OneRequired:
+		if 0 == len(set) {
+			return fmt.Sprintf("one of %s is required", strings.Replace(joinFlags(unset), " and ", " or ", 1))
+		}
+	case AllOrNone:
+		if 0 != len(set) && 0 != len(unset) {
+			return fmt.Sprintf("%s must be used together, %s missing", joinFlags(constraint.Flags), joinFlags(unset))
+		}
+	case Requires:
+		if 0 != len(set) && set[0] == constraint.Flags[0] && 0 != len(unset) {
+			return fmt.Sprintf("%s requires %s", flagName(set[0]), joinFlags(unset))
+		}
+	}
+	return ""
+}
+
+/*
+checkFlags checks the required flags and constraints of every command that
+was called, returning all of the violations in a single ConstraintError. The
+checks are skipped if the last command sets SkipFlagChecks
+*/
+func (cmd *Cmd) checkFlags() error {
+	violations := make([]string, 0)
+	path := cmd.calledPath()
+	if path[len(path)-1].SkipFlagChecks {
+		return nil
+	}
+	for _, current := range path {
+		names := make([]string, 0, len(current.Flags))
+		for name := range current.Flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if flag := current.Flags[name]; flag.Required && !flag.isSet() {
+				violation := flagName(name) + " is required"
+				if 0 != len(flag.Env) {
+					violation += fmt.Sprintf(" (or set $%s)", flag.Env[0])
+				}
+				violations = append(violations, violation)
+			}
+		}
+		for _, constraint := range current.Constraints {
+			if violation := constraint.check(current); "" != violation {
+				violations = append(violations, violation)
+			}
+		}
+	}
+
+	if 0 != len(violations) {
+		return &ConstraintError{Cmd: path[len(path)-1].commandPath(), Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+	app := newApp(map[string]*Flag{
+		"token": {Name: "token", Default: "", Required: true, Env: []string{"APP_TOKEN"}, Persistent: true},
+	}, &Cmd{
+		Name: "fetch",
+		Flags: map[string]*Flag{
+			"url":      {Name: "url", Default: ""},
+			"file":     {Name: "file", Default: ""},
+			"json":     {Name: "json", Default: false},
+			"yaml":     {Name: "yaml", Default: false},
+			"o":        {Name: "o", Default: false},
+			"user":     {Name: "user", Default: ""},
+			"password": {Name: "password", Default: ""},
+			"key":      {Name: "key", Default: ""},
+			"cert":     {Name: "cert", Default: ""},
+			"ca":       {Name: "ca", Default: ""},
+		},
+		Constraints: []Constraint{
+			OneOf("url", "file"),
+			MutuallyExclusive("json", "yaml", "o"),
+			Together("user", "password"),
+			Require("key", "cert", "ca"),
+		},
+	})
+	valid := [][]string{
+		{"--token=t", "fetch", "--url=x"},
+		{"fetch", "--token=t", "--file=x", "--json"},
+		{"--token=t", "fetch", "--url=x", "--user=u", "--password=p"},
+		{"--token=t", "fetch", "--url=x", "--cert=c"},
+		{"--token=t", "fetch", "--url=x", "--key=k", "--cert=c", "--ca=a"},
+	}
+	for _, args := range valid {
+		if err := app.Execute(append([]string{"app"}, args...)); nil != err {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+
+	t.Setenv("APP_TOKEN", "t")
+	if err := app.Execute([]string{"app", "fetch", "--url=x"}); nil != err {
+		t.Errorf("expected the token from APP_TOKEN to satisfy --token, %v found", err)
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	app := newApp(map[string]*Flag{
+		"token": {Name: "token", Default: "", Required: true, Env: []string{"APP_TOKEN"}, Persistent: true},
+	}, &Cmd{
+		Name: "fetch",
+		Flags: map[string]*Flag{
+			"url":      {Name: "url", Default: ""},
+			"file":     {Name: "file", Default: ""},
+			"json":     {Name: "json", Default: false},
+			"yaml":     {Name: "yaml", Default: false},
+			"o":        {Name: "o", Default: false},
+			"user":     {Name: "user", Default: ""},
+			"password": {Name: "password", Default: ""},
+			"key":      {Name: "key", Default: ""},
+			"cert":     {Name: "cert", Default: ""},
+			"ca":       {Name: "ca", Default: ""},
+		},
+		Constraints: []Constraint{
+			OneOf("url", "file"),
+			MutuallyExclusive("json", "yaml", "o"),
+			Together("user", "password"),
+			Require("key", "cert", "ca"),
+		},
+	})
+	tests := []struct {
+		args   []string
+		expect []string
+	}{
+		{[]string{"fetch", "--url=x"}, []string{"--token is required (or set $APP_TOKEN)"}},
+		{[]string{"--token=t", "fetch"}, []string{"one of --url or --file is required"}},
+		{[]string{"--token=t", "fetch", "--url=x", "--json", "-o"}, []string{"--json and -o can't be used together"}},
+		{[]string{"--token=t", "fetch", "--url=x", "--password=p"}, []string{"--user and --password must be used together, --user missing"}},
+		{[]string{"--token=t", "fetch", "--url=x", "--key=k", "--ca=a"}, []string{"--key requires --cert"}},
+		{[]string{"fetch", "--json", "--yaml", "-o", "--user=u", "--key=k"}, []string{
+			"--token is required (or set $APP_TOKEN)",
+			"one of --url or --file is required",
+			"--json, --yaml and -o can't be used together",
+			"--user and --password must be used together, --password missing",
+			"--key requires --cert and --ca",
+		}},
+	}
+	for _, test := range tests {
+		var constraint *ConstraintError
+		err := app.Execute(append([]string{"app"}, test.args...))
+		if !errors.As(err, &constraint) {
+			t.Errorf("%v: expected a ConstraintError, %v found", test.args, err)
+			continue
+		}
+		if "app fetch" != constraint.Cmd || !reflect.DeepEqual(test.expect, constraint.Violations) {
+			t.Errorf("%v: expected %q, %q found", test.args, test.expect, constraint.Violations)
+		}
+		if ExitUsage != ExitCode(err) {
+			t.Errorf("%v: expected exit status %d, %d found", test.args, ExitUsage, ExitCode(err))
+		}
+	}
+
+	err := app.Execute([]string{"app", "fetch", "--url=x"})
+	if expect := "invalid flags for 'app fetch': --token is required (or set $APP_TOKEN)"; nil == err || expect != err.Error() {
+		t.Errorf("expected %s, %v found", expect, err)
+	}
+	err = app.Execute([]string{"app", "fetch"})
+	if expect := "invalid flags for 'app fetch':\n  --token is required (or set $APP_TOKEN)\n  one of --url or --file is required"; nil == err || expect != err.Error() {
+		t.Errorf("expected %s, %v found", expect, err)
+	}
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+usageError is implemented by errors caused by an invalid command line
+*/
+type usageError interface {
+	error
+	isUsageError()
+}
+
+func (*UnknownFlagError) isUsageError()    {}
+func (*UnknownCommandError) isUsageError() {}
+func (*MissingValueError) isUsageError()   {}
+func (*InvalidValueError) isUsageError()   {}
+func (*MissingCommandError) isUsageError() {}
+func (*MissingArgError) isUsageError()     {}
+func (*InvalidArgError) isUsageError()     {}
+func (*ArgCountError) isUsageError()       {}
+func (*UnexpectedArgError) isUsageError()  {}
+func (*ConstraintError) isUsageError()     {}
+
+/*
+UnknownFlagError is returned when a flag isn't defined for a command
+*/
+type UnknownFlagError struct {
+	Cmd  string
+	Flag string
+}
+
+func (err *UnknownFlagError) Error() string {
+	return fmt.Sprintf("unknown flag '%s' for '%s'", err.Flag, err.Cmd)
+}
+
+/*
+UnknownCommandError is returned when a command has sub-commands and the
+argument doesn't match any of them
+*/
+type UnknownCommandError struct {
+	Cmd  string
+	Name string
+}
+
+func (err *UnknownCommandError) Error() string {
+	return fmt.Sprintf("unknown command '%s' for '%s'", err.Name, err.Cmd)
+}
+
+/*
+MissingValueError is returned when a flag that takes a value is the last
+argument
+*/
+type MissingValueError struct {
+	Cmd  string
+	Flag string
+}
+
+func (err *MissingValueError) Error() string {
+	return fmt.Sprintf("flag '%s' for '%s' requires a value", err.Flag, err.Cmd)
+}
+
+/*
+InvalidValueError is returned when a flag value can't be parsed
+*/
+type InvalidValueError struct {
+	Flag  string
+	Value string
+	Err   error
+
+	// The environment variable or config file the value came from
+	Source string
+}
+
+func (err *InvalidValueError) Error() string {
+	if "" != err.Source {
+		return fmt.Sprintf("invalid value '%s' for flag '%s' from %s: %v", err.Value, err.Flag, err.Source, err.Err)
+	}
+	return fmt.Sprintf("invalid value '%s' for flag '%s': %v", err.Value, err.Flag, err.Err)
+}
+
+/*
+Unwrap returns the parse error
+*/
+func (err *InvalidValueError) Unwrap() error {
+	return err.Err
+}
+
+/*
+MissingCommandError is returned when a command without a Run function is the
+last command on the command line
+*/
+type MissingCommandError struct {
+	Cmd string
+}
+
+func (err *MissingCommandError) Error() string {
+	return fmt.Sprintf("'%s' requires a command", err.Cmd)
+}
+
+/*
+MissingArgError is returned when a required positional argument isn't given
+*/
+type MissingArgError struct {
+	Cmd string
+	Arg string
+}
+
+func (err *MissingArgError) Error() string {
+	return fmt.Sprintf("missing argument <%s> for '%s'", err.Arg, err.Cmd)
+}
+
+/*
+InvalidArgError is returned when a positional argument can't be parsed or
+fails its Validate function
+*/
+type InvalidArgError struct {
+	Cmd   string
+	Arg   string
+	Value string
+	Err   error
+}
+
+func (err *InvalidArgError) Error() string {
+	return fmt.Sprintf("invalid value '%s' for argument <%s> of '%s': %v", err.Value, err.Arg, err.Cmd, err.Err)
+}
+
+/*
+Unwrap returns the parse or validation error
+*/
+func (err *InvalidArgError) Unwrap() error {
+	return err.Err
+}
+
+/*
+ArgCountError is returned when a variadic argument is given too few or too
+many values
+*/
+type ArgCountError struct {
+	Cmd   string
+	Arg   string
+	Min   int
+	Max   int
+	Count int
+}
+
+func (err *ArgCountError) Error() string {
+	expect := fmt.Sprintf("at least %d", err.Min)
+	switch {
+	case err.Min == err.Max:
+		expect = fmt.Sprintf("%d", err.Min)
+	case err.Max > 0 && err.Count > err.Max:
+		expect = fmt.Sprintf("at most %d", err.Max)
+	}
+	return fmt.Sprintf("argument <%s> of '%s' takes %s values, %d given", err.Arg, err.Cmd, expect, err.Count)
+}
+
+/*
+UnexpectedArgError is returned when there are more positional arguments than
+a command takes
+*/
+type UnexpectedArgError struct {
+	Cmd   string
+	Value string
+}
+
+func (err *UnexpectedArgError) Error() string {
+	return fmt.Sprintf("unexpected argument '%s' for '%s'", err.Value, err.Cmd)
+}
+
+/*
+ArgSpecError is returned when a command's ArgSpecs are defined incorrectly,
+e.g. a variadic argument that isn't the last one
+*/
+type ArgSpecError struct {
+	Cmd    string
+	Arg    string
+	Reason string
+}
+
+func (err *ArgSpecError) Error() string {
+	return fmt.Sprintf("invalid argument <%s> of '%s': %s", err.Arg, err.Cmd, err.Reason)
+}
+
+/*
+ConstraintError is returned when required flags are missing or flags break
+the command's constraints. It lists every violation
+*/
+type ConstraintError struct {
+	Cmd        string
+	Violations []string
+}
+
+func (err *ConstraintError) Error() string {
+	if 1 == len(err.Violations) {
+		return fmt.Sprintf("invalid flags for '%s': %s", err.Cmd, err.Violations[0])
+	}
+	return fmt.Sprintf("invalid flags for '%s':\n  %s", err.Cmd, strings.Join(err.Violations, "\n  "))
+}
+
+/*
+ConfigFileError is returned when a config file can't be read or has settings
+that don't match any flag
+*/
+type ConfigFileError struct {
+	Path string
+	Err  error
+}
+
+func (err *ConfigFileError) Error() string {
+	return fmt.Sprintf("config file '%s': %v", err.Path, err.Err)
+}
+
+/*
+Unwrap returns the underlying error
+*/
+func (err *ConfigFileError) Unwrap() error {
+	return err.Err
+}
+
+/*
+ExitError sets the exit status returned by Main
+*/
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+/*
+Exit returns an error that makes Main return code
+*/
+func Exit(code int, err error) *ExitError {
+	return &ExitError{Code: code, Err: err}
+}
+
+func (err *ExitError) Error() string {
+	if nil == err.Err {
+		return fmt.Sprintf("exit status %d", err.Code)
+	}
+	return err.Err.Error()
+}
+
+/*
+Unwrap returns the underlying error
+*/
+func (err *ExitError) Unwrap() error {
+	return err.Err
+}
@@ -3,12 +3,21 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
 	"path"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
+/*
+FlagType is the kind of value a flag takes, determined by the type of its
+Default
+*/
 type FlagType int
 
 const (
@@ -18,8 +27,46 @@ const (
 	JSON
 	String
 	Time
+	Duration
+	Uint
+	IP
+	CIDR
+	URL
+	Enum
+	Bytes
+	Custom
+	Count
+	Slice
+	Map
 )
 
+var flagTypeNames = map[FlagType]string{
+	Bool:     "bool",
+	Float:    "float",
+	Int:      "int",
+	JSON:     "json",
+	String:   "string",
+	Time:     "time",
+	Duration: "duration",
+	Uint:     "uint",
+	IP:       "ip",
+	CIDR:     "cidr",
+	URL:      "url",
+	Enum:     "enum",
+	Bytes:    "bytes",
+	Custom:   "value",
+	Count:    "count",
+	Slice:    "slice",
+	Map:      "map",
+}
+
+/*
+String implements stringer
+*/
+func (typ FlagType) String() string {
+	return flagTypeNames[typ]
+}
+
 /*
 New returns a pointer to a struct representing a CLI application.
 */
@@ -46,6 +93,7 @@ PushCmds adds command definitions to the application.
 */
 func (cmd *Cmd) PushCmds(cmds ...*Cmd) {
 	for _, c := range cmds {
+		c.parent = cmd
 		cmd.Cmds[c.Name] = c
 	}
 }
@@ -59,105 +107,6 @@ func (cmd *Cmd) PushFlags(flags ...*Flag) {
 	}
 }
 
-/*
-Execute parses the CLI arguments and compares them to the defined
-commands, args, and flags.
-*/
-func (cmd *Cmd) Execute() error {
-
-	// break the path and the command into separate tokens
-	args := os.Args
-	args = append([]string{path.Dir(args[0]), path.Base(args[0])}, args[1:]...)
-	cmd.Path = args[0]
-	cmd.Name = args[1]
-	args = args[2:]
-
-	type token struct {
-		typ   string
-		name  string
-		value string
-	}
-	shift := func(args []string, cmd *Cmd) (*token, []string) {
-		var tkn *token
-		arg := args[0]
-		args = args[1:]
-		runes := []rune(arg)
-		if "---" != string(runes[0:3]) && ("-" == string(runes[0:1]) || "--" == string(runes[0:2])) {
-			parts := strings.Split(strings.Trim(arg, "-"), "=")
-			flag, ok := cmd.Flags[parts[0]]
-			if !ok {
-				// no matching flag definition
-				return nil, args
-			}
-
-			tkn.typ = "flag"
-			tkn.name = parts[0]
-
-			if 2 >= len(parts) {
-				tkn.value = strings.Join(parts[1:], "=")
-			} else {
-				switch flag.Default.(type) {
-				case bool:
-					tkn.value = "1"
-				default:
-					if len(args) > 0 {
-						tkn.value = args[0]
-						args = args[1:]
-					}
-				}
-			}
-		} else if _, ok := cmd.Cmds[arg]; ok {
-			tkn.name = arg
-			tkn.typ = "cmd"
-
-		} else if _, ok := cmd.Args[arg]; ok {
-			tkn.name = arg
-			tkn.typ = "arg"
-
-		} else {
-			return nil, args
-		}
-		return tkn, args
-	}
-
-	var tkn *token
-	path := cmd
-	for {
-		tkn, args = shift(args, path)
-		if nil == tkn {
-			// error, unknown token
-			continue
-		}
-		if "flag" == tkn.typ {
-			if _, ok := path.Flags[tkn.name]; ok {
-				path.Cmds[tkn.name].Called = true
-				path.Flags[tkn.name].Set(tkn.value)
-			}
-		} else if "cmd" == tkn.typ {
-			if _, ok := path.Cmds[tkn.name]; ok {
-				path.Cmds[tkn.name].Called = true
-				path = path.Cmds[tkn.name]
-			}
-		} else if "arg" == tkn.typ {
-			if _, ok := path.Args[tkn.name]; ok {
-				path.Args[tkn.name].Called = true
-			}
-		} else {
-			return fmt.Errorf("Unknown type '%v'", tkn.typ)
-		}
-
-		if 0 == len(args) {
-			break
-		}
-	}
-
-	//for k, v := range args {
-	//
-	//}
-
-	return nil
-}
-
 type Cmd struct {
 	Args   map[string]*Arg
 	Called bool
@@ -166,6 +115,104 @@ type Cmd struct {
 	Name   string
 	Path   string
 	Usage  Usage
+
+	/*
+		A one line summary shown in the parent's command list
+	*/
+	Short string
+
+	/*
+		Shown at the top of the command's help, defaults to Short
+	*/
+	Description string
+
+	/*
+		Example command lines shown in the command's help
+	*/
+	Examples []string
+
+	/*
+		Optional, a text/template for the command's help, passed a *HelpData.
+		Commands without a template use the nearest parent's or
+		DefaultHelpTemplate
+	*/
+	HelpTemplate string
+
+	/*
+		Config files searched in order when the config flag isn't passed,
+		the first that exists is loaded. Environment variables and a
+		leading "~/" are expanded
+	*/
+	ConfigPaths []string
+
+	/*
+		The name of the flag that selects a config file, DefaultConfigFlag
+		if ConfigPaths is set. The flag is defined if it doesn't exist.
+		Config files set flags that weren't passed or set by their Env, so
+		the order of precedence is flag, environment, config file, default
+	*/
+	ConfigFlag string
+
+	/*
+		The arguments following the last command that aren't flags or
+		named args, set on the last command called
+	*/
+	Positional []string
+
+	/*
+		Optional, the positional arguments the command takes, in order.
+		Positional values are checked against them
+	*/
+	ArgSpecs []*Arg
+
+	/*
+		Rules about which flags may be used together, checked with the
+		Required flags after parsing
+	*/
+	Constraints []Constraint
+
+	/*
+		Skip the Required flag and Constraints checks of every command when
+		this is the last command called, for utility commands such as
+		CompletionCmd that don't use the other commands' flags
+	*/
+	SkipFlagChecks bool
+
+	/*
+		Called with the resolved flags and positional args when this is the
+		last command on the command line
+	*/
+	Run RunFunc
+
+	/*
+		Returns the candidates for positional arguments in shell completion
+	*/
+	Complete CompleteFunc
+
+	/*
+		Called before and after Run. Commands without hooks use the hooks of
+		the nearest parent that has them
+	*/
+	PreRun  RunFunc
+	PostRun RunFunc
+
+	/*
+		Where errors are written by Main, defaults to the parent's or
+		os.Stderr
+	*/
+	Stderr io.Writer
+
+	/*
+		Where help is written, defaults to the parent's or os.Stdout
+	*/
+	Stdout io.Writer
+
+	parent *Cmd
+
+	/*
+		The command help was requested for, set on the root command
+	*/
+	help *Cmd
 }
 
 /*
@@ -190,10 +237,43 @@ func (cmd *Cmd) String() string {
 	return str
 }
 
+/*
+Arg is an argument. In Cmd.Args it's a named argument matched by its Name, in
+Cmd.ArgSpecs it defines a positional argument, parsed by the type of its
+Default like a Flag
+*/
 type Arg struct {
 	Called bool
 	Name   string
 	Flags  []*Flag
+
+	Default     interface{}
+	Description string
+	Required    bool
+
+	/*
+		The values a string argument accepts
+	*/
+	Allowed []string
+
+	/*
+		The last positional argument may take every remaining value, at
+		least Min and at most Max if it's set. Value is then a
+		[]interface{}
+	*/
+	Variadic bool
+	Min      int
+	Max      int
+
+	/*
+		Called with each parsed value, an error rejects it
+	*/
+	Validate func(value interface{}) error
+
+	/*
+		The parsed value after Execute, nil if it wasn't given
+	*/
+	Value interface{}
 }
 
 func (arg Arg) String() string {
@@ -204,85 +284,270 @@ func (arg Arg) String() string {
 	return str
 }
 
+/*
+Flag is a command line flag. The type of Default decides how values are
+parsed:
+
+	bool                    Bool
+	float32, float64        Float
+	int, int8 ... int64     Int
+	uint, uint8 ... uint64  Uint
+	[]byte                  JSON, the value is decoded into an interface{}
+	string                  String, or Enum when Allowed is set
+	time.Time               Time, RFC 3339 or YYYY-MM-DD
+	time.Duration           Duration, e.g. "1m30s"
+	net.IP                  IP
+	*net.IPNet              CIDR, e.g. "10.0.0.0/8"
+	*url.URL                URL, a scheme is required
+	ByteSize                Bytes, e.g. "10MiB"
+	Counter                 Count, every use adds one, e.g. "-vvv"
+	[]T                     Slice, every use appends a T
+	map[string]T            Map, every use adds a "key=T"
+	Value                   Custom, see NewValue
+*/
 type Flag struct {
-	Called   bool
-	Default  interface{}
-	Name     string
-	Required bool
-	Value    interface{}
-}
+	Called      bool
+	Default     interface{}
+	Description string
+	Name        string
+	Required    bool
+	Value       interface{}
 
-func (f Flag) String() string {
-	str := "--" + f.Name
+	/*
+		Persistent flags are accepted by the command's sub-commands at any
+		depth, before or after their names. A flag with the same name on a
+		sub-command shadows it
+	*/
+	Persistent bool
 
-	val := f.Default
-	if nil != f.Value {
-		val = f.Value
-	}
+	/*
+		A single letter alias, e.g. "v" for "--verbose". Short flags can
+		be bundled: "-xvf file"
+	*/
+	Short string
+
+	/*
+		The values a string flag accepts
+	*/
+	Allowed []string
+
+	/*
+		Environment variables read when the flag isn't passed, the first
+		that is set is used
+	*/
+	Env []string
+
+	/*
+		Where the value came from after Execute, one of SourceDefault,
+		SourceFile, SourceEnv or SourceFlag. Origin is the config file or
+		environment variable
+	*/
+	Source string
+	Origin string
+
+	/*
+		Returns the Value a Custom flag is parsed into, a new one for each
+		parse so the Default and earlier parses aren't changed. Defaults to
+		a new zero value of the Default's type
+	*/
+	NewValue func() Value
+
+	/*
+		Returns the candidates for the flag's value in shell completion
+	*/
+	Complete CompleteFunc
+}
 
+/*
+Type returns the kind of value the flag takes
+*/
+func (f *Flag) Type() FlagType {
 	switch f.Default.(type) {
 	case bool:
-		str = fmt.Sprintf("%s=%v", str, val.(bool))
+		return Bool
+	case float32, float64:
+		return Float
+	case int, int8, int16, int32, int64:
+		return Int
+	case uint, uint8, uint16, uint32, uint64:
+		return Uint
 	case []byte:
-		str = fmt.Sprintf("%s=%s", str, string(val.([]byte)))
-	case float32:
-		str = fmt.Sprintf("%s=%f", str, val.(float32))
-	case float64:
-		str = fmt.Sprintf("%s=%f", str, val.(float64))
-	case int:
-		str = fmt.Sprintf("%s=%d", str, val.(int))
-	case int8:
-		str = fmt.Sprintf("%s=%d", str, val.(int8))
-	case int16:
-		str = fmt.Sprintf("%s=%d", str, val.(int16))
-	case int32:
-		str = fmt.Sprintf("%s=%d", str, val.(int32))
-	case int64:
-		str = fmt.Sprintf("%s=%d", str, val.(int64))
+		return JSON
+	case time.Time:
+		return Time
+	case time.Duration:
+		return Duration
+	case net.IP:
+		return IP
+	case *net.IPNet:
+		return CIDR
+	case *url.URL:
+		return URL
+	case ByteSize:
+		return Bytes
 	case string:
-		str = fmt.Sprintf("%s=%s", str, val.(string))
+		if 0 != len(f.Allowed) {
+			return Enum
+		}
+		return String
+	case Counter:
+		return Count
+	case Value:
+		return Custom
 	}
-	return str
+	switch reflect.ValueOf(f.Default).Kind() {
+	case reflect.Slice:
+		return Slice
+	case reflect.Map:
+		if reflect.String == reflect.TypeOf(f.Default).Key().Kind() {
+			return Map
+		}
+	}
+	return String
 }
 
-func (f Flag) Set(val string) error {
-	var err error
+/*
+takesValue reports whether the flag needs a value, boolean and counting flags
+don't
+*/
+func (f *Flag) takesValue() bool {
+	return Bool != f.Type() && Count != f.Type()
+}
 
-	switch f.Default.(type) {
-	case bool:
+/*
+repeatable reports whether every use of the flag adds to its value
+*/
+func (f *Flag) repeatable() bool {
+	switch f.Type() {
+	case Count, Slice, Map:
+		return true
+	}
+	return false
+}
+
+/*
+use applies a flag from the command line: a flag without a value is set to
+true, or counted
+*/
+func (f *Flag) use(value string, hasValue bool) error {
+	switch {
+	case hasValue:
+		return f.Set(value)
+	case Count == f.Type():
+		count, _ := f.Value.(Counter)
+		f.Value = count + 1
+		return nil
+	}
+	return f.Set("true")
+}
+
+/*
+elem returns a flag that parses the elements of a slice or map flag
+*/
+func (f *Flag) elem() *Flag {
+	return &Flag{
+		Name:    f.Name,
+		Default: reflect.Zero(reflect.TypeOf(f.Default).Elem()).Interface(),
+		Allowed: f.Allowed,
+	}
+}
+
+/*
+String implements stringer
+*/
+func (f Flag) String() string {
+	val := f.Default
+	if nil != f.Value {
+		val = f.Value
+	}
+	return "--" + f.Name + "=" + formatValue(val)
+}
+
+/*
+Set parses a command line value according to the flag's type and stores it
+in Value
+*/
+func (f *Flag) Set(val string) error {
+	var (
+		value interface{}
+		err   error
+	)
+
+	switch f.Type() {
+	case Bool:
 		switch val {
-		case "":
-			f.Value = false
-		case "false":
-			f.Value = false
-		case "0":
-			f.Value = false
-		case "1":
-			f.Value = true
-		case "true":
-			f.Value = true
+		case "", "false", "0":
+			value = false
+		case "true", "1":
+			value = true
 		default:
 			return fmt.Errorf("invalid value for boolean argument: '%s'", val)
 		}
-	case float32:
-		f.Value, err = strconv.ParseFloat(val, 10)
-		if nil != err {
-			return err
-		}
-	case int:
-		f.Value, err = strconv.ParseInt(val, 10, 64)
-		if nil != err {
-			return err
+	case Float, Int, Uint:
+		value, err = parseNumber(val, f.Default)
+	case JSON:
+		err = json.Unmarshal([]byte(val), &value)
+	case Time:
+		value, err = parseTime(val)
+	case Duration:
+		value, err = time.ParseDuration(val)
+	case IP:
+		value, err = parseIP(val)
+	case CIDR:
+		_, value, err = net.ParseCIDR(val)
+	case URL:
+		value, err = parseURL(val)
+	case Bytes:
+		value, err = ParseByteSize(val)
+	case Enum:
+		value = val
+		if !contains(f.Allowed, val) {
+			err = fmt.Errorf("must be one of %s", strings.Join(f.Allowed, ", "))
 		}
-	case []byte:
-		err = json.Unmarshal([]byte(val), &f.Value)
-		if nil != err {
-			return err
+	case Custom:
+		custom, ok := f.Value.(Value)
+		if !ok {
+			custom = f.newValue()
 		}
-	case string:
-		f.Value = val
+		err = custom.Set(val)
+		value = custom
+	case Count:
+		var count int64
+		count, err = strconv.ParseInt(val, 10, 0)
+		value = Counter(count)
+	case Slice:
+		value, err = f.appendValue(val)
+	case Map:
+		value, err = f.putValue(val)
 	default:
-		f.Value = val
+		value = val
 	}
+	if nil != err {
+		return err
+	}
+	f.Value = value
 	return nil
 }
+
+/*
+newValue returns a new Value for a Custom flag
+*/
+func (f *Flag) newValue() Value {
+	if nil != f.NewValue {
+		return f.NewValue()
+	}
+	typ := reflect.TypeOf(f.Default)
+	if reflect.Ptr == typ.Kind() {
+		return reflect.New(typ.Elem()).Interface().(Value)
+	}
+	return reflect.New(typ).Elem().Interface().(Value)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type listValue []string
+
+func (list *listValue) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *listValue) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func TestFlagSet(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	endpoint, _ := url.Parse("https://example.com/hook")
+	tests := []struct {
+		flag   *Flag
+		value  string
+		expect interface{}
+		typ    FlagType
+	}{
+		{&Flag{Default: false}, "1", true, Bool},
+		{&Flag{Default: float32(0)}, "1.5", float32(1.5), Float},
+		{&Flag{Default: 0.0}, "0.1", 0.1, Float},
+		{&Flag{Default: 0}, "-42", -42, Int},
+		{&Flag{Default: int8(0)}, "-8", int8(-8), Int},
+		{&Flag{Default: int64(0)}, "9000000000", int64(9000000000), Int},
+		{&Flag{Default: uint(0)}, "42", uint(42), Uint},
+		{&Flag{Default: uint16(0)}, "65535", uint16(65535), Uint},
+		{&Flag{Default: []byte{}}, `{"a":[1]}`, map[string]interface{}{"a": []interface{}{1.0}}, JSON},
+		{&Flag{Default: ""}, "text", "text", String},
+		{&Flag{Default: time.Time{}}, "2024-02-03", time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC), Time},
+		{&Flag{Default: time.Time{}}, "2024-02-03T04:05:06Z", time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC), Time},
+		{&Flag{Default: time.Second}, "1m30s", 90 * time.Second, Duration},
+		{&Flag{Default: net.IP(nil)}, "::1", net.ParseIP("::1"), IP},
+		{&Flag{Default: (*net.IPNet)(nil)}, "10.0.0.0/8", network, CIDR},
+		{&Flag{Default: (*url.URL)(nil)}, "https://example.com/hook", endpoint, URL},
+		{&Flag{Default: "json", Allowed: []string{"json", "yaml"}}, "yaml", "yaml", Enum},
+		{&Flag{Default: ByteSize(0)}, "10MiB", 10 * MiB, Bytes},
+		{&Flag{Default: ByteSize(0)}, "1.5 GB", 1500 * MB, Bytes},
+		{&Flag{Default: &listValue{}}, "a", &listValue{"a"}, Custom},
+		{&Flag{Default: Counter(0)}, "3", Counter(3), Count},
+		{&Flag{Default: []string{"x"}}, "a", []string{"a"}, Slice},
+		{&Flag{Default: []time.Duration{}}, "1s", []time.Duration{time.Second}, Slice},
+		{&Flag{Default: map[string]int{}}, "a=1", map[string]int{"a": 1}, Map},
+	}
+	for _, test := range tests {
+		if test.typ != test.flag.Type() {
+			t.Errorf("%v: expected type %s, %s found", test.flag.Default, test.typ, test.flag.Type())
+		}
+		if err := test.flag.Set(test.value); nil != err {
+			t.Errorf("%s: %v", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.expect, test.flag.Value) {
+			t.Errorf("%s: expected %#v, %#v found", test.value, test.expect, test.flag.Value)
+		}
+	}
+}
+
+func TestFlagSetErrors(t *testing.T) {
+	tests := []struct {
+		flag  *Flag
+		value string
+	}{
+		{&Flag{Default: false}, "yes"},
+		{&Flag{Default: int8(0)}, "128"},
+		{&Flag{Default: uint(0)}, "-1"},
+		{&Flag{Default: 0.0}, "x"},
+		{&Flag{Default: []byte{}}, "{"},
+		{&Flag{Default: time.Time{}}, "yesterday"},
+		{&Flag{Default: time.Duration(0)}, "5"},
+		{&Flag{Default: net.IP(nil)}, "300.0.0.1"},
+		{&Flag{Default: (*net.IPNet)(nil)}, "10.0.0.0"},
+		{&Flag{Default: (*url.URL)(nil)}, "example.com"},
+		{&Flag{Default: "json", Allowed: []string{"json", "yaml"}}, "xml"},
+		{&Flag{Default: ByteSize(0)}, "10XB"},
+		{&Flag{Default: Counter(0)}, "x"},
+		{&Flag{Default: []int{}}, "x"},
+		{&Flag{Default: []string{}, Allowed: []string{"a"}}, "b"},
+		{&Flag{Default: map[string]int{}}, "a"},
+		{&Flag{Default: map[string]int{}}, "a=x"},
+	}
+	for _, test := range tests {
+		if err := test.flag.Set(test.value); nil == err {
+			t.Errorf("%T: expected an error for '%s', %v found", test.flag.Default, test.value, test.flag.Value)
+		}
+		if nil != test.flag.Value {
+			t.Errorf("%T: expected no value after an error, %v found", test.flag.Default, test.flag.Value)
+		}
+	}
+}
+
+func TestFlagCustomReset(t *testing.T) {
+	tags := &listValue{"default"}
+	app := &Cmd{Name: "app", Flags: map[string]*Flag{"tag": {Name: "tag", Default: tags}}}
+	flags := FlagSet(app.Flags)
+
+	if err := app.Execute([]string{"app", "--tag", "a", "--tag", "b"}); nil != err || "a,b" != flags.String("tag") {
+		t.Errorf("expected a,b, %v (%v) found", flags.Value("tag"), err)
+	}
+	if err := app.Execute([]string{"app", "--tag", "c"}); nil != err || "c" != flags.String("tag") {
+		t.Errorf("expected c, %v (%v) found", flags.Value("tag"), err)
+	}
+	if err := app.Execute([]string{"app"}); nil != err || "default" != flags.String("tag") {
+		t.Errorf("expected the default, %v (%v) found", flags.Value("tag"), err)
+	}
+
+	app.Flags["tag"].NewValue = func() Value { return &listValue{"new"} }
+	if err := app.Execute([]string{"app", "--tag", "d"}); nil != err || "new,d" != flags.String("tag") {
+		t.Errorf("expected new,d, %v (%v) found", flags.Value("tag"), err)
+	}
+}
+
+func TestFlagString(t *testing.T) {
+	flag := &Flag{Name: "size", Default: ByteSize(0)}
+	if expect := "--size=0B"; expect != flag.String() {
+		t.Errorf("expected %s, %s found", expect, flag.String())
+	}
+	flag.Set("2048")
+	if expect := "--size=2KiB"; expect != flag.String() {
+		t.Errorf("expected %s, %s found", expect, flag.String())
+	}
+
+	// A Value that doesn't match the Default's type must not panic
+	flag = &Flag{Name: "n", Default: 0, Value: "x"}
+	if expect := "--n=x"; expect != flag.String() {
+		t.Errorf("expected %s, %s found", expect, flag.String())
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	for str, expect := range map[string]ByteSize{
+		"512":    512,
+		"1kb":    KB,
+		"1K":     KB,
+		"4KiB":   4 * KiB,
+		"1.5MiB": 1536 * KiB,
+		"2 GiB":  2 * GiB,
+		"1TB":    TB,
+	} {
+		size, err := ParseByteSize(str)
+		if nil != err || expect != size {
+			t.Errorf("%s: expected %d, %d (%v) found", str, expect, size, err)
+		}
+	}
+	for _, str := range []string{"", "MiB", "-1", "1.2.3KB", "1EiB"} {
+		if _, err := ParseByteSize(str); nil == err {
+			t.Errorf("expected an error for '%s'", str)
+		}
+	}
+	if expect := "1500B"; expect != ByteSize(1500).String() {
+		t.Errorf("expected %s, %s found", expect, ByteSize(1500).String())
+	}
+}
@@ -0,0 +1,339 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+/*
+ErrHelp is returned by Execute when help was requested with -h, --help or the
+help command
+*/
+var ErrHelp = errors.New("help requested")
+
+/*
+DefaultHelpTemplate is used for commands without a HelpTemplate. Templates
+are given a *HelpData and the functions "wrap", "columns", which aligns a list
+of entries, and "flags", which aligns flag lists with each other
+*/
+const DefaultHelpTemplate = `{{if .Description}}{{wrap .Description 0}}
+
+{{end}}Usage:
+  {{.Synopsis}}
+{{if .Commands}}
+Commands:
+{{columns .Commands}}{{end}}{{if .Arguments}}
+Arguments:
+{{columns .Arguments}}{{end}}{{if .LocalFlags}}
+Flags:
+{{flags .LocalFlags}}{{end}}{{if .InheritedFlags}}
+Inherited Flags:
+{{flags .InheritedFlags}}{{end}}{{if .Examples}}
+Examples:
+{{range .Examples}}  {{.}}
+{{end}}{{end}}{{if .Commands}}
+Use "{{.Path}} help <command>" for more information about a command.
+{{end}}`
+
+/*
+HelpEntry is a row in a command or flag list
+*/
+type HelpEntry struct {
+	Name        string
+	Description string
+}
+
+/*
+HelpData is passed to help templates
+*/
+type HelpData struct {
+	Cmd            *Cmd
+	Path           string
+	Synopsis       string
+	Description    string
+	Commands       []HelpEntry
+	Arguments      []HelpEntry
+	LocalFlags     []HelpEntry
+	InheritedFlags []HelpEntry
+	Examples       []string
+	Width          int
+}
+
+/*
+TerminalWidth returns the width help is wrapped to, from the COLUMNS
+environment variable or 80
+*/
+func TerminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); nil == err && columns > 20 {
+		return columns
+	}
+	return 80
+}
+
+/*
+flagType returns the name of a flag's value type for help output, empty for
+boolean flags and the allowed values for enums
+*/
+func flagType(flag *Flag) string {
+	switch flag.Type() {
+	case Bool, Count:
+		return ""
+	case Enum:
+		return strings.Join(flag.Allowed, "|")
+	case Slice:
+		return flagType(flag.elem()) + "..."
+	case Map:
+		return "key=" + flagType(flag.elem())
+	}
+	return flag.Type().String()
+}
+
+/*
+helpFlag returns the help row for a flag
+*/
+func helpFlag(flag *Flag) HelpEntry {
+	name := "--" + flag.Name
+	if 1 == len(flag.Name) {
+		name = "-" + flag.Name
+	} else if "" != flag.Short {
+		name = "-" + flag.Short + ", " + name
+	}
+	if typ := flagType(flag); "" != typ {
+		name += " " + typ
+	}
+
+	description := flag.Description
+	if flag.repeatable() {
+		description = strings.TrimSpace(description + " (repeatable)")
+	}
+	if 0 != len(flag.Env) {
+		description = strings.TrimSpace(fmt.Sprintf("%s (env %s)", description, strings.Join(flag.Env, ", ")))
+	}
+	return HelpEntry{Name: name, Description: describeDefault(description, flag.Required, flag.Default)}
+}
+
+/*
+helpArg returns the help row for a positional argument
+*/
+func helpArg(arg *Arg) HelpEntry {
+	name := arg.synopsis()
+	if typ := flagType(&Flag{Default: arg.Default, Allowed: arg.Allowed}); "" != typ && "string" != typ {
+		name += " " + typ
+	}
+	return HelpEntry{Name: name, Description: describeDefault(arg.Description, arg.Required, arg.Default)}
+}
+
+/*
+describeDefault adds the required marker or the default value to a
+description
+*/
+func describeDefault(description string, required bool, value interface{}) string {
+	if required {
+		return strings.TrimSpace(description + " (required)")
+	} else if !isZero(value) {
+		return strings.TrimSpace(fmt.Sprintf("%s (default %v)", description, formatDefault(value)))
+	}
+	return description
+}
+
+func isZero(value interface{}) bool {
+	switch typed := value.(type) {
+	case nil:
+		return true
+	case []byte:
+		return 0 == len(typed)
+	}
+	switch reflected := reflect.ValueOf(value); reflected.Kind() {
+	case reflect.Slice, reflect.Map:
+		return 0 == reflected.Len()
+	}
+	return reflect.ValueOf(value).IsZero()
+}
+
+func formatDefault(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return strconv.Quote(str)
+	}
+	return formatValue(value)
+}
+
+func sortedFlags(flags map[string]*Flag) []HelpEntry {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]HelpEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, helpFlag(flags[name]))
+	}
+	return entries
+}
+
+/*
+helpData collects the values for a command's help template
+*/
+func (cmd *Cmd) helpData() *HelpData {
+	data := &HelpData{
+		Cmd:         cmd,
+		Path:        cmd.commandPath(),
+		Description: cmd.Description,
+		Examples:    cmd.Examples,
+		Width:       TerminalWidth(),
+	}
+	if "" == data.Description {
+		data.Description = cmd.Short
+	}
+
+	data.Synopsis = data.Path
+	if 0 != len(cmd.Flags) || nil != cmd.parent {
+		data.Synopsis += " [flags]"
+	}
+	if 0 != len(cmd.Cmds) {
+		data.Synopsis += " <command>"
+	} else {
+		data.Synopsis += " " + cmd.argsSynopsis()
+	}
+	for _, arg := range cmd.ArgSpecs {
+		data.Arguments = append(data.Arguments, helpArg(arg))
+	}
+
+	names := make([]string, 0, len(cmd.Cmds))
+	for name := range cmd.Cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data.Commands = append(data.Commands, HelpEntry{Name: name, Description: cmd.Cmds[name].Short})
+	}
+
+	data.LocalFlags = sortedFlags(cmd.Flags)
+	inherited := make(map[string]*Flag)
+	for name, flag := range cmd.resolvedFlags() {
+		if _, ok := cmd.Flags[name]; !ok {
+			inherited[name] = flag
+		}
+	}
+	data.InheritedFlags = sortedFlags(inherited)
+	return data
+}
+
+/*
+wrapText wraps text to width, indenting every line after the first by indent
+spaces. Existing line breaks are kept
+*/
+func wrapText(text string, indent, width int) string {
+	lines := make([]string, 0)
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if "" != line && len(line)+1+len(word) > width-indent {
+				lines = append(lines, line)
+				line = word
+				continue
+			}
+			if "" != line {
+				line += " "
+			}
+			line += word
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"+strings.Repeat(" ", indent))
+}
+
+/*
+nameColumn returns where descriptions start so that they line up across the
+lists, at most half the width
+*/
+func nameColumn(width int, lists ...[]HelpEntry) int {
+	column := 0
+	for _, entries := range lists {
+		for _, entry := range entries {
+			if len(entry.Name) > column {
+				column = len(entry.Name)
+			}
+		}
+	}
+	column += 5
+	if column > width/2 {
+		column = width / 2
+	}
+	return column
+}
+
+/*
+formatColumns indents a list of entries, starting descriptions at column and
+wrapping them to width
+*/
+func formatColumns(entries []HelpEntry, column, width int) string {
+	var out strings.Builder
+	for _, entry := range entries {
+		line := "  " + entry.Name
+		if "" != entry.Description {
+			if len(line)+2 > column {
+				line += "\n" + strings.Repeat(" ", column)
+			} else {
+				line += strings.Repeat(" ", column-len(line))
+			}
+			line += wrapText(entry.Description, column, width)
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String()
+}
+
+/*
+helpTemplate returns the nearest HelpTemplate
+*/
+func (cmd *Cmd) helpTemplate() string {
+	for current := cmd; nil != current; current = current.parent {
+		if "" != current.HelpTemplate {
+			return current.HelpTemplate
+		}
+	}
+	return DefaultHelpTemplate
+}
+
+/*
+Help writes the help text for the command. If the command has a Usage
+function it is called instead
+*/
+func (cmd *Cmd) Help(writer io.Writer) error {
+	if nil != cmd.Usage {
+		cmd.Usage()
+		return nil
+	}
+	data := cmd.helpData()
+	tmpl, err := template.New(cmd.Name).Funcs(template.FuncMap{
+		"wrap": func(text string, indent int) string {
+			return wrapText(text, indent, data.Width)
+		},
+		"columns": func(entries []HelpEntry) string {
+			return formatColumns(entries, nameColumn(data.Width, entries), data.Width)
+		},
+		"flags": func(entries []HelpEntry) string {
+			return formatColumns(entries, nameColumn(data.Width, data.LocalFlags, data.InheritedFlags), data.Width)
+		},
+	}).Parse(cmd.helpTemplate())
+	if nil != err {
+		return err
+	}
+	return tmpl.Execute(writer, data)
+}
+
+func (cmd *Cmd) stdout() io.Writer {
+	for current := cmd; nil != current; current = current.parent {
+		if nil != current.Stdout {
+			return current.Stdout
+		}
+	}
+	return os.Stdout
+}
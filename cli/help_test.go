@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHelp(t *testing.T) {
+	t.Setenv("COLUMNS", "60")
+	var stdout bytes.Buffer
+	app := newApp(map[string]*Flag{
+		"config": {Name: "config", Default: "app.yaml", Description: "Configuration file", Persistent: true},
+		"v":      {Name: "v", Default: false, Description: "Verbose output", Persistent: true},
+	}, &Cmd{
+		Name:        "serve",
+		Short:       "Start the server",
+		Description: "Serve starts the HTTP server and blocks until it is interrupted, draining connections before it exits.",
+		Flags: map[string]*Flag{
+			"port":    {Name: "port", Default: 8080, Description: "Port to listen on"},
+			"root":    {Name: "root", Default: "", Required: true, Description: "Directory to serve"},
+			"workers": {Name: "workers", Default: 0},
+		},
+		Examples: []string{"app serve --root ./public --port 9000"},
+		Run: func(ctx context.Context, flags FlagSet, args []string) error {
+			return nil
+		},
+	}, &Cmd{Name: "version", Short: "Print the version"})
+	app.Description = "App manages things."
+	app.Stdout = &stdout
+
+	expect := `Serve starts the HTTP server and blocks until it is
+interrupted, draining connections before it exits.
+
+Usage:
+  app serve [flags] [args...]
+
+Flags:
+  --port int        Port to listen on (default 8080)
+  --root string     Directory to serve (required)
+  --workers int
+
+Inherited Flags:
+  --config string   Configuration file (default "app.yaml")
+  -v                Verbose output
+
+Examples:
+  app serve --root ./public --port 9000
+`
+	for _, args := range [][]string{
+		{"app", "serve", "--help"},
+		{"app", "serve", "-h"},
+		{"app", "help", "serve"},
+	} {
+		stdout.Reset()
+		if err := app.RunContext(context.Background(), args); nil != err {
+			t.Fatal(err)
+		}
+		if expect != stdout.String() {
+			t.Errorf("%v: expected\n%s\nfound\n%s", args, expect, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	app.RunContext(context.Background(), []string{"app", "--help"})
+	expect = `App manages things.
+
+Usage:
+  app [flags] <command>
+
+Commands:
+  serve     Start the server
+  version   Print the version
+
+Flags:
+  --config string   Configuration file (default "app.yaml")
+  -v                Verbose output
+
+Use "app help <command>" for more information about a command.
+`
+	if expect != stdout.String() {
+		t.Errorf("expected\n%s\nfound\n%s", expect, stdout.String())
+	}
+
+	var unknown *UnknownCommandError
+	if err := app.Execute([]string{"app", "help", "nope"}); !errors.As(err, &unknown) {
+		t.Errorf("expected an UnknownCommandError, %v found", err)
+	}
+}
+
+func TestHelpTemplate(t *testing.T) {
+	var stdout bytes.Buffer
+	app := newApp(nil, &Cmd{
+		Name: "serve",
+		Flags: map[string]*Flag{
+			"port":    {Name: "port", Default: 8080},
+			"root":    {Name: "root", Default: ""},
+			"workers": {Name: "workers", Default: 0},
+		},
+	})
+	app.Stdout = &stdout
+	app.HelpTemplate = `{{.Path}}:{{range .LocalFlags}} {{.Name}}{{end}}`
+	app.RunContext(context.Background(), []string{"app", "serve", "-h"})
+	if expect := "app serve: --port int --root string --workers int"; expect != stdout.String() {
+		t.Errorf("expected '%s', '%s' found", expect, stdout.String())
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	if expect := "one two\n    three\n    four"; expect != wrapText("one two three four", 4, 13) {
+		t.Errorf("expected %q, %q found", expect, wrapText("one two three four", 4, 13))
+	}
+}
+
+func TestHelpShortFlags(t *testing.T) {
+	t.Setenv("COLUMNS", "80")
+	var stdout bytes.Buffer
+	app := newApp(map[string]*Flag{
+		"extract": {Name: "extract", Short: "x", Default: false},
+		"verbose": {Name: "verbose", Short: "v", Default: Counter(0)},
+		"file":    {Name: "file", Short: "f", Default: ""},
+		"exclude": {Name: "exclude", Default: []string{"*.tmp"}},
+		"label":   {Name: "label", Short: "l", Default: map[string]string{}},
+		"port":    {Name: "port", Default: []int(nil)},
+	})
+	app.Stdout = &stdout
+	if err := app.RunContext(context.Background(), []string{"tar", "-h"}); nil != err {
+		t.Fatal(err)
+	}
+	expect := `Flags:
+  --exclude string...      (repeatable) (default *.tmp)
+  -x, --extract
+  -f, --file string
+  -l, --label key=string   (repeatable)
+  --port int...            (repeatable)
+  -v, --verbose            (repeatable)
+`
+	if !strings.Contains(stdout.String(), expect) {
+		t.Errorf("expected\n%s\nfound\n%s", expect, stdout.String())
+	}
+}
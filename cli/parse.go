@@ -0,0 +1,365 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+)
+
+/*
+isFlagArg reports whether an argument is a flag, "-" on its own is an argument
+*/
+func isFlagArg(arg string) bool {
+	return len(arg) > 1 && '-' == arg[0]
+}
+
+/*
+isNumberArg reports whether an argument is a negative number, e.g. "-5"
+*/
+func isNumberArg(arg string) bool {
+	return len(arg) > 1 && '-' == arg[0] && unicode.IsDigit(rune(arg[1]))
+}
+
+/*
+splitFlag splits "--name=value", "--name", "-n=value" and "-n" into the flag
+name and value
+*/
+func splitFlag(arg string) (name, value string, hasValue bool) {
+	arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	name, value, hasValue = strings.Cut(arg, "=")
+	return name, value, hasValue
+}
+
+/*
+isBundle reports whether an argument may be bundled short flags, e.g. "-xvf"
+*/
+func isBundle(arg string) bool {
+	return len(arg) > 2 && '-' == arg[0] && '-' != arg[1]
+}
+
+/*
+lookup returns a flag by its name or short alias, nil if there isn't one
+*/
+func (flags FlagSet) lookup(name string) *Flag {
+	if flag, ok := flags[name]; ok {
+		return flag
+	}
+	if 1 != len(name) {
+		return nil
+	}
+	for _, flag := range flags {
+		if name == flag.Short {
+			return flag
+		}
+	}
+	return nil
+}
+
+/*
+lookupFlag returns a flag that can be used with the command, by its name or
+short alias: its own flag or the nearest parent's persistent flag
+*/
+func (cmd *Cmd) lookupFlag(name string) *Flag {
+	for current := cmd; nil != current; current = current.parent {
+		if flag := FlagSet(current.Flags).lookup(name); nil != flag && (current == cmd || flag.Persistent) {
+			return flag
+		}
+	}
+	return nil
+}
+
+/*
+parseBundle parses bundled short flags, e.g. "-xvf file" or "-vofile". A flag
+that takes a value ends the bundle, the rest of the bundle or the next
+argument is its value. It returns the number of following arguments used. A
+lenient parse skips unknown flags and invalid values
+*/
+func (cmd *Cmd) parseBundle(arg string, next []string, lenient bool) (int, error) {
+	shorts := arg[1:]
+	for k := 0; k < len(shorts); k++ {
+		short := "-" + shorts[k:k+1]
+		flag := cmd.lookupFlag(short[1:])
+		if nil == flag {
+			if lenient {
+				continue
+			}
+			return 0, &UnknownFlagError{Cmd: cmd.commandPath(), Flag: short}
+		}
+		if !flag.takesValue() {
+			if err := flag.use("", false); nil != err {
+				if lenient {
+					continue
+				}
+				return 0, &InvalidValueError{Flag: short, Err: err}
+			}
+			flag.Called = true
+			continue
+		}
+
+		used := 0
+		value := strings.TrimPrefix(shorts[k+1:], "=")
+		if "" == value {
+			if 0 == len(next) {
+				return 0, &MissingValueError{Cmd: cmd.commandPath(), Flag: short}
+			}
+			value, used = next[0], 1
+		}
+		if err := flag.Set(value); nil != err {
+			if lenient {
+				return used, nil
+			}
+			return 0, &InvalidValueError{Flag: short, Value: value, Err: err}
+		}
+		flag.Called = true
+		return used, nil
+	}
+	return 0, nil
+}
+
+/*
+commandPath returns the names of the command and its parents, e.g. "app sub"
+*/
+func (cmd *Cmd) commandPath() string {
+	if nil == cmd.parent {
+		return cmd.Name
+	}
+	return cmd.parent.commandPath() + " " + cmd.Name
+}
+
+/*
+reset clears the results of a previous parse
+*/
+func (cmd *Cmd) reset() {
+	cmd.Called = false
+	cmd.help = nil
+	cmd.Positional = nil
+	for _, flag := range cmd.Flags {
+		flag.Called = false
+		flag.Value = nil
+		flag.Source, flag.Origin = "", ""
+	}
+	for _, arg := range cmd.Args {
+		arg.Called = false
+	}
+	for _, arg := range cmd.ArgSpecs {
+		arg.Called = false
+		arg.Value = nil
+	}
+	for _, sub := range cmd.Cmds {
+		sub.parent = cmd
+		sub.reset()
+	}
+}
+
+/*
+parse walks the command tree, setting flags and marking each command and flag
+that was called. Arguments that aren't commands or flags are stored in the
+Positional field of the last command. Flag values may be given as
+"--flag=value" or "--flag value", boolean flags don't take a value unless it
+uses "=". A command accepts its own flags and the persistent flags of its
+parents. Everything after "--" is a positional argument
+*/
+func (cmd *Cmd) parse(args []string) error {
+	_, _, err := cmd.parseArgs(args, false)
+	return err
+}
+
+/*
+parseArgs implements parse. A lenient parse, used for completion, ignores
+unknown flags, invalid values, help and unknown commands, and returns the
+flag still waiting for its value at the end of the arguments, if any. It
+also reports whether the arguments contained "--"
+*/
+func (cmd *Cmd) parseArgs(args []string, lenient bool) (pending *Flag, terminated bool, err error) {
+	cmd.reset()
+	current := cmd
+	current.Called = true
+	positional := make([]string, 0)
+
+	for a := 0; a < len(args); a++ {
+		arg := args[a]
+		switch {
+		case terminated:
+			positional = append(positional, arg)
+
+		case "--" == arg:
+			terminated = true
+
+		case isFlagArg(arg):
+			name, value, hasValue := splitFlag(arg)
+			flag := current.lookupFlag(name)
+			if nil == flag && ("help" == name || "h" == name) && !lenient {
+				cmd.help = current
+				return nil, false, ErrHelp
+			}
+			if nil == flag {
+				if isNumberArg(arg) {
+					positional = append(positional, arg)
+					continue
+				}
+				if isBundle(arg) {
+					used, err := current.parseBundle(arg, args[a+1:], lenient)
+					var missing *MissingValueError
+					if lenient && errors.As(err, &missing) {
+						pending = current.lookupFlag(missing.Flag[1:])
+						continue
+					}
+					if nil != err {
+						return nil, false, err
+					}
+					a += used
+					continue
+				}
+				if lenient {
+					continue
+				}
+				return nil, false, &UnknownFlagError{Cmd: current.commandPath(), Flag: arg}
+			}
+			if !hasValue && flag.takesValue() {
+				if a+1 == len(args) {
+					if lenient {
+						pending = flag
+						continue
+					}
+					return nil, false, &MissingValueError{Cmd: current.commandPath(), Flag: arg}
+				}
+				a++
+				value, hasValue = args[a], true
+			}
+			if err := flag.use(value, hasValue); nil != err {
+				if lenient {
+					continue
+				}
+				return nil, false, &InvalidValueError{Flag: arg, Value: value, Err: err}
+			}
+			flag.Called = true
+
+		default:
+			// Commands can only follow flags and other commands
+			if 0 == len(positional) {
+				if sub, ok := current.Cmds[arg]; ok {
+					sub.parent = current
+					sub.Called = true
+					current = sub
+					continue
+				}
+			}
+			if _, ok := current.Cmds["help"]; !ok && !lenient && 0 == len(positional) && 0 != len(current.Cmds) && "help" == arg {
+				return nil, false, cmd.helpCommand(current, args[a+1:])
+			}
+			if named, ok := current.Args[arg]; ok {
+				named.Called = true
+				continue
+			}
+			if 0 == len(positional) && 0 != len(current.Cmds) && !lenient {
+				return nil, false, &UnknownCommandError{Cmd: current.commandPath(), Name: arg}
+			}
+			positional = append(positional, arg)
+		}
+	}
+
+	current.Positional = positional
+	if lenient {
+		return pending, terminated, nil
+	}
+	return nil, terminated, current.validateArgs(positional)
+}
+
+/*
+helpCommand handles "help <command>", finding the command help was requested
+for
+*/
+func (cmd *Cmd) helpCommand(current *Cmd, args []string) error {
+	for _, arg := range args {
+		if isFlagArg(arg) {
+			continue
+		}
+		sub, ok := current.Cmds[arg]
+		if !ok {
+			return &UnknownCommandError{Cmd: current.commandPath(), Name: arg}
+		}
+		sub.parent = current
+		current = sub
+	}
+	cmd.help = current
+	return ErrHelp
+}
+
+/*
+Execute parses the os.Args parameters by default and compares them to the
+defined commands, args, and flags. Optionally a []string value may be passed
+in the same form as os.Args, starting with the program name. Flags that
+weren't passed are then set from the environment and config file, and
+required flags and constraints are checked. An *ArgSpecError is returned if
+a command's ArgSpecs are defined incorrectly.
+*/
+func (cmd *Cmd) Execute(arguments ...[]string) error {
+	args := os.Args
+	if len(arguments) > 0 {
+		args = arguments[0]
+	}
+	if 0 != len(args) {
+		// break the path and the command into separate tokens
+		cmd.Path = path.Dir(args[0])
+		cmd.Name = path.Base(args[0])
+		args = args[1:]
+	}
+
+	cmd.defineConfigFlag()
+	if err := cmd.checkArgSpecs(); nil != err {
+		return err
+	}
+	if err := cmd.parse(args); nil != err {
+		return err
+	}
+	if err := cmd.bind(); nil != err {
+		return err
+	}
+	return cmd.checkFlags()
+}
+
+/*
+Parse parses the os.Args parameters by default. Optionally a []string
+value may be passed. Without any definitions "--flag=value" is a string flag,
+"--flag" is a boolean flag and anything else is an argument.
+*/
+func Parse(arguments ...[]string) (*Cli, error) {
+	args := os.Args
+	if len(arguments) > 0 {
+		args = arguments[0]
+	}
+
+	cli := &Cli{Flags: make([]*Flag, 0), Args: make([]string, 0)}
+	if 0 == len(args) {
+		return cli, nil
+	}
+
+	// break the path and the command into separate tokens
+	cli.path = path.Dir(args[0])
+	cli.cmd = path.Base(args[0])
+
+	terminated := false
+	for _, arg := range args[1:] {
+		if !terminated && "--" == arg {
+			terminated = true
+			continue
+		}
+		if terminated || !isFlagArg(arg) {
+			cli.Args = append(cli.Args, arg)
+			continue
+		}
+		name, value, hasValue := splitFlag(arg)
+		flag := &Flag{Called: true, Name: name}
+		if hasValue {
+			flag.Default = ""
+			flag.Value = value
+		} else {
+			flag.Default = false
+			flag.Value = true
+		}
+		cli.Push(flag)
+	}
+	return cli, nil
+}
@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/*
+Exit statuses returned by Main
+*/
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+
+	// 128 + SIGINT
+	ExitInterrupted = 130
+)
+
+/*
+RunFunc is a command handler. flags holds the flags of the command and the
+persistent flags of its parents, args holds the positional arguments
+*/
+type RunFunc func(ctx context.Context, flags FlagSet, args []string) error
+
+/*
+FlagSet is the flags available to a command, keyed by name
+*/
+type FlagSet map[string]*Flag
+
+/*
+Value returns the value of a flag, its default if it wasn't passed, or nil if
+it isn't defined
+*/
+func (flags FlagSet) Value(name string) interface{} {
+	flag, ok := flags[name]
+	if !ok {
+		return nil
+	}
+	if nil != flag.Value {
+		return flag.Value
+	}
+	return flag.Default
+}
+
+/*
+Called reports whether a flag was passed on the command line
+*/
+func (flags FlagSet) Called(name string) bool {
+	flag, ok := flags[name]
+	return ok && flag.Called
+}
+
+/*
+String returns the value of a flag formatted as a string
+*/
+func (flags FlagSet) String(name string) string {
+	value := flags.Value(name)
+	if nil == value {
+		return ""
+	}
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return fmt.Sprint(value)
+}
+
+/*
+Bool returns the value of a boolean flag
+*/
+func (flags FlagSet) Bool(name string) bool {
+	value, _ := flags.Value(name).(bool)
+	return value
+}
+
+/*
+Int returns the value of an integer flag
+*/
+func (flags FlagSet) Int(name string) int {
+	value, _ := flags.Value(name).(int)
+	return value
+}
+
+/*
+Count returns the value of a counting flag
+*/
+func (flags FlagSet) Count(name string) int {
+	value, _ := flags.Value(name).(Counter)
+	return int(value)
+}
+
+/*
+Strings returns the value of a []string flag
+*/
+func (flags FlagSet) Strings(name string) []string {
+	value, _ := flags.Value(name).([]string)
+	return value
+}
+
+/*
+StringMap returns the value of a map[string]string flag
+*/
+func (flags FlagSet) StringMap(name string) map[string]string {
+	value, _ := flags.Value(name).(map[string]string)
+	return value
+}
+
+/*
+Float returns the value of a float32 or float64 flag
+*/
+func (flags FlagSet) Float(name string) float64 {
+	switch value := flags.Value(name).(type) {
+	case float32:
+		return float64(value)
+	case float64:
+		return value
+	}
+	return 0
+}
+
+/*
+Duration returns the value of a duration flag
+*/
+func (flags FlagSet) Duration(name string) time.Duration {
+	value, _ := flags.Value(name).(time.Duration)
+	return value
+}
+
+/*
+Time returns the value of a time flag
+*/
+func (flags FlagSet) Time(name string) time.Time {
+	value, _ := flags.Value(name).(time.Time)
+	return value
+}
+
+/*
+Selected returns the last command called, after Execute
+*/
+func (cmd *Cmd) Selected() *Cmd {
+	path := cmd.calledPath()
+	return path[len(path)-1]
+}
+
+/*
+calledPath returns the command and the sub-commands called after it, ending
+with the selected command
+*/
+func (cmd *Cmd) calledPath() []*Cmd {
+	path := []*Cmd{cmd}
+	for current := cmd; ; {
+		var next *Cmd
+		for _, sub := range current.Cmds {
+			if sub.Called {
+				next = sub
+				break
+			}
+		}
+		if nil == next {
+			return path
+		}
+		path = append(path, next)
+		current = next
+	}
+}
+
+/*
+resolvedFlags returns the flags that can be used with the command: its own
+flags and the persistent flags of its parents, the nearest flag with a name
+hiding the others. It picks the same flags as lookupFlag
+*/
+func (cmd *Cmd) resolvedFlags() FlagSet {
+	flags := make(FlagSet)
+	for current := cmd; nil != current; current = current.parent {
+		for name, flag := range current.Flags {
+			if _, ok := flags[name]; !ok && (current == cmd || flag.Persistent) {
+				flags[name] = flag
+			}
+		}
+	}
+	return flags
+}
+
+/*
+hooks returns the nearest pre and post run hooks
+*/
+func (cmd *Cmd) hooks() (pre, post RunFunc) {
+	for current := cmd; nil != current; current = current.parent {
+		if nil == pre {
+			pre = current.PreRun
+		}
+		if nil == post {
+			post = current.PostRun
+		}
+	}
+	return pre, post
+}
+
+func (cmd *Cmd) stderr() io.Writer {
+	for current := cmd; nil != current; current = current.parent {
+		if nil != current.Stderr {
+			return current.Stderr
+		}
+	}
+	return os.Stderr
+}
+
+/*
+RunContext parses the arguments and runs the last command called, or writes
+help if it was requested. The PreRun hook runs first, an error stops the
+command. The PostRun hook runs only if the command succeeds. If the first
+argument is CompleteCmd shell completions are written instead
+*/
+func (cmd *Cmd) RunContext(ctx context.Context, arguments ...[]string) error {
+	if args := os.Args; 0 == len(arguments) && isCompletion(args) {
+		return cmd.complete(ctx, args, cmd.stdout())
+	} else if len(arguments) > 0 && isCompletion(arguments[0]) {
+		return cmd.complete(ctx, arguments[0], cmd.stdout())
+	}
+
+	if err := cmd.Execute(arguments...); nil != err {
+		if errors.Is(err, ErrHelp) {
+			return cmd.help.Help(cmd.help.stdout())
+		}
+		return err
+	}
+
+	selected := cmd.Selected()
+	if nil == selected.Run {
+		selected.Help(selected.stderr())
+		return &MissingCommandError{Cmd: selected.commandPath()}
+	}
+
+	flags := selected.resolvedFlags()
+	args := selected.Positional
+	pre, post := selected.hooks()
+	if nil != pre {
+		if err := pre(ctx, flags, args); nil != err {
+			return err
+		}
+	}
+	if err := selected.Run(ctx, flags, args); nil != err {
+		return err
+	}
+	if nil != post {
+		return post(ctx, flags, args)
+	}
+	return nil
+}
+
+/*
+Main runs the command line and returns the exit status, cancelling the
+context on SIGINT or SIGTERM. Errors are written to Stderr.
+
+	func main() {
+		os.Exit(app.Main())
+	}
+*/
+func (cmd *Cmd) Main(arguments ...[]string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := cmd.RunContext(ctx, arguments...)
+	var exitErr *ExitError
+	if nil != err && !(errors.As(err, &exitErr) && nil == exitErr.Err) {
+		fmt.Fprintf(cmd.Selected().stderr(), "%s: %v\n", cmd.Name, err)
+	}
+	return ExitCode(err)
+}
+
+/*
+ExitCode maps an error to an exit status: 0 for nil, the code of an
+*ExitError, 2 for command line errors and 1 for anything else
+*/
+func ExitCode(err error) int {
+	if nil == err {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	var usage usageError
+	if errors.As(err, &usage) {
+		return ExitUsage
+	}
+	if errors.Is(err, context.Canceled) {
+		return ExitInterrupted
+	}
+	return ExitFailure
+}
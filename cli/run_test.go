@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunContext(t *testing.T) {
+	calls := make([]string, 0)
+	hook := func(name string) RunFunc {
+		return func(ctx context.Context, flags FlagSet, args []string) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	cmd := &Cmd{
+		Name: "cmd-name",
+		Flags: map[string]*Flag{
+			"cmd-flag-name": {Name: "cmd-flag-name", Default: "cmd-flag-value"},
+			"count":         {Name: "count", Default: 0},
+		},
+	}
+	app := newApp(map[string]*Flag{
+		"app-flag-name": {Name: "app-flag-name", Default: "app-flag-value", Persistent: true},
+		"debug":         {Name: "debug", Default: false, Persistent: true},
+	}, cmd)
+	app.PreRun = hook("pre")
+	app.PostRun = hook("post")
+	cmd.Run = func(ctx context.Context, flags FlagSet, args []string) error {
+		calls = append(calls, "run "+flags.String("app-flag-name")+" "+flags.String("cmd-flag-name")+" "+strings.Join(args, ","))
+		if !flags.Bool("debug") || 2 != flags.Int("count") {
+			t.Errorf("expected root and command flags to be resolved")
+		}
+		return nil
+	}
+
+	err := app.RunContext(context.Background(), []string{"app", "--debug", "cmd-name", "--count=2", "a", "b"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if expect := []string{"pre", "run app-flag-value cmd-flag-value a,b", "post"}; !reflect.DeepEqual(expect, calls) {
+		t.Errorf("expected %v, %v found", expect, calls)
+	}
+
+	// Hooks on the command replace inherited hooks, a failing hook stops
+	// the command
+	calls = calls[:0]
+	cmd.PreRun = func(ctx context.Context, flags FlagSet, args []string) error {
+		return errors.New("not ready")
+	}
+	if err := app.RunContext(context.Background(), []string{"app", "cmd-name"}); nil == err || "not ready" != err.Error() {
+		t.Errorf("expected the PreRun error, %v found", err)
+	}
+	if 0 != len(calls) {
+		t.Errorf("expected nothing to run, %v found", calls)
+	}
+}
+
+func TestCmdMain(t *testing.T) {
+	var stderr bytes.Buffer
+	app := newApp(nil, &Cmd{
+		Name: "cmd-name",
+		Run: func(ctx context.Context, flags FlagSet, args []string) error {
+			if 0 != len(args) {
+				return Exit(3, errors.New("failed"))
+			}
+			return nil
+		},
+	})
+	app.Stderr = &stderr
+	// a Usage function replaces the help printed with usage errors
+	app.Usage = func() {}
+
+	tests := []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"app", "cmd-name"}, ExitOK, ""},
+		{[]string{"app", "cmd-name", "x"}, 3, "app: failed\n"},
+		{[]string{"app", "--nope"}, ExitUsage, "app: unknown flag '--nope' for 'app'\n"},
+		{[]string{"app"}, ExitUsage, "app: 'app' requires a command\n"},
+	}
+	for _, test := range tests {
+		stderr.Reset()
+		if code := app.Main(test.args); test.code != code || test.stderr != stderr.String() {
+			t.Errorf("%v: expected %d '%s', %d '%s' found", test.args, test.code, test.stderr, code, stderr.String())
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if ExitFailure != ExitCode(errors.New("x")) {
+		t.Errorf("expected %d for other errors", ExitFailure)
+	}
+	if ExitInterrupted != ExitCode(context.Canceled) {
+		t.Errorf("expected %d for a cancelled context", ExitInterrupted)
+	}
+}
+
+func TestShadowedPersistentFlags(t *testing.T) {
+	var stdout bytes.Buffer
+	mid := &Cmd{Name: "mid", Cmds: map[string]*Cmd{}, Flags: map[string]*Flag{"v": {Name: "v", Default: false}}}
+	leaf := &Cmd{Name: "leaf"}
+	mid.PushCmds(leaf)
+	app := newApp(map[string]*Flag{"v": {Name: "v", Default: false, Description: "Verbose output", Persistent: true}}, mid)
+	app.Stdout = &stdout
+
+	// mid's local -v doesn't reach leaf, so leaf uses the root's persistent -v
+	leaf.Run = func(ctx context.Context, flags FlagSet, args []string) error {
+		if flags["v"] != app.Flags["v"] || !flags.Bool("v") {
+			t.Errorf("expected the root's -v to be set, %v found", flags.Value("v"))
+		}
+		return nil
+	}
+	if err := app.RunContext(context.Background(), []string{"app", "mid", "leaf", "-v"}); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := app.RunContext(context.Background(), []string{"app", "mid", "leaf", "--help"}); nil != err {
+		t.Fatal(err)
+	}
+	if expect := "Inherited Flags:\n  -v   Verbose output\n"; !strings.Contains(stdout.String(), expect) {
+		t.Errorf("expected\n%s\nfound\n%s", expect, stdout.String())
+	}
+
+	stdout.Reset()
+	if err := app.RunContext(context.Background(), []string{"app", CompleteCmd, "mid", "leaf", "-"}); nil != err {
+		t.Fatal(err)
+	}
+	if "-v\n" != stdout.String() {
+		t.Errorf("expected -v, %q found", stdout.String())
+	}
+}
@@ -0,0 +1,229 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ParseTOML decodes the subset of TOML used by configuration files: tables,
+dotted and quoted keys, strings, numbers, booleans and single line arrays.
+Dates are kept as strings. The result uses the same types as encoding/json
+*/
+func ParseTOML(data []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+	for k, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		number := k + 1
+		line := strings.TrimSpace(stripTOMLComment(raw))
+		if "" == line {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[[") {
+			return nil, fmt.Errorf("toml: line %d: arrays of tables are not supported", number)
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("toml: line %d: unterminated table header", number)
+			}
+			keys, err := splitTOMLKey(line[1 : len(line)-1])
+			if nil != err {
+				return nil, fmt.Errorf("toml: line %d: %v", number, err)
+			}
+			if table, err = tomlTable(root, keys); nil != err {
+				return nil, fmt.Errorf("toml: line %d: %v", number, err)
+			}
+			continue
+		}
+
+		eq := tomlIndex(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("toml: line %d: expected key = value", number)
+		}
+		keys, err := splitTOMLKey(line[:eq])
+		if nil != err {
+			return nil, fmt.Errorf("toml: line %d: %v", number, err)
+		}
+		value, err := parseTOMLValue(strings.TrimSpace(line[eq+1:]))
+		if nil != err {
+			return nil, fmt.Errorf("toml: line %d: %v", number, err)
+		}
+		parent, err := tomlTable(table, keys[:len(keys)-1])
+		if nil != err {
+			return nil, fmt.Errorf("toml: line %d: %v", number, err)
+		}
+		key := keys[len(keys)-1]
+		if _, ok := parent[key]; ok {
+			return nil, fmt.Errorf("toml: line %d: duplicate key '%s'", number, key)
+		}
+		parent[key] = value
+	}
+	return root, nil
+}
+
+/*
+tomlTable returns the nested table at keys, creating missing tables
+*/
+func tomlTable(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch next := table[key].(type) {
+		case nil:
+			created := make(map[string]interface{})
+			table[key] = created
+			table = created
+		case map[string]interface{}:
+			table = next
+		default:
+			return nil, fmt.Errorf("key '%s' is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+/*
+tomlIndex returns the index of the first char outside quotes, or -1
+*/
+func tomlIndex(text string, char rune) int {
+	for k := 0; k < len(text); k++ {
+		switch {
+		case '"' == text[k] || '\'' == text[k]:
+			end := tomlStringEnd(text[k:])
+			if -1 == end {
+				return -1
+			}
+			k += end
+		case char == rune(text[k]):
+			return k
+		}
+	}
+	return -1
+}
+
+/*
+tomlStringEnd returns the index of the quote closing the string text starts
+with, or -1
+*/
+func tomlStringEnd(text string) int {
+	for k := 1; k < len(text); k++ {
+		switch {
+		case '\\' == text[k] && '"' == text[0]:
+			k++
+		case text[0] == text[k]:
+			return k
+		}
+	}
+	return -1
+}
+
+func stripTOMLComment(line string) string {
+	if k := tomlIndex(line, '#'); k >= 0 {
+		return line[:k]
+	}
+	return line
+}
+
+/*
+splitTOMLKey splits a dotted key, e.g. `server."max size"`
+*/
+func splitTOMLKey(text string) ([]string, error) {
+	keys := make([]string, 0)
+	for {
+		text = strings.TrimSpace(text)
+		if "" == text {
+			return nil, fmt.Errorf("empty key")
+		}
+		var key string
+		end := tomlIndex(text, '.')
+		if -1 == end {
+			end = len(text)
+		}
+		part := strings.TrimSpace(text[:end])
+		if strings.HasPrefix(part, "\"") || strings.HasPrefix(part, "'") {
+			unquoted, err := parseTOMLString(part)
+			if nil != err {
+				return nil, err
+			}
+			key = unquoted
+		} else {
+			if "" == part || strings.ContainsAny(part, " \t\"'") {
+				return nil, fmt.Errorf("invalid key '%s'", part)
+			}
+			key = part
+		}
+		keys = append(keys, key)
+		if end == len(text) {
+			return keys, nil
+		}
+		text = text[end+1:]
+	}
+}
+
+func parseTOMLValue(text string) (interface{}, error) {
+	switch {
+	case "" == text:
+		return nil, fmt.Errorf("missing value")
+	case strings.HasPrefix(text, "\"\"\"") || strings.HasPrefix(text, "'''"):
+		return nil, fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'"):
+		return parseTOMLString(text)
+	case strings.HasPrefix(text, "{"):
+		return nil, fmt.Errorf("inline tables are not supported")
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		result := make([]interface{}, 0)
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		for "" != inner {
+			end := tomlIndex(inner, ',')
+			if -1 == end {
+				end = len(inner)
+			}
+			value, err := parseTOMLValue(strings.TrimSpace(inner[:end]))
+			if nil != err {
+				return nil, err
+			}
+			result = append(result, value)
+			if end == len(inner) {
+				break
+			}
+			// a trailing comma is allowed
+			inner = strings.TrimSpace(inner[end+1:])
+		}
+		return result, nil
+	case "true" == text:
+		return true, nil
+	case "false" == text:
+		return false, nil
+	}
+
+	number := strings.ReplaceAll(text, "_", "")
+	if _, err := strconv.ParseInt(number, 10, 64); nil == err {
+		return json.Number(number), nil
+	}
+	if _, err := strconv.ParseFloat(number, 64); nil == err {
+		return json.Number(number), nil
+	}
+	// dates and times
+	if '0' <= text[0] && text[0] <= '9' && !strings.ContainsAny(text, " \t") {
+		return text, nil
+	}
+	return nil, fmt.Errorf("invalid value %s", text)
+}
+
+func parseTOMLString(text string) (string, error) {
+	if tomlStringEnd(text) != len(text)-1 {
+		return "", fmt.Errorf("invalid string %s", text)
+	}
+	if '\'' == text[0] {
+		return text[1 : len(text)-1], nil
+	}
+	var value string
+	if err := json.Unmarshal([]byte(text), &value); nil != err {
+		return "", fmt.Errorf("invalid string %s", text)
+	}
+	return value, nil
+}
@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ByteSize is a number of bytes, used as a flag Default it accepts values like
+"512", "10MiB" or "1.5GB"
+*/
+type ByteSize int64
+
+/*
+Byte size units
+*/
+const (
+	Byte ByteSize = 1
+
+	KB ByteSize = 1000
+	MB          = 1000 * KB
+	GB          = 1000 * MB
+	TB          = 1000 * GB
+	PB          = 1000 * TB
+
+	KiB ByteSize = 1024
+	MiB          = 1024 * KiB
+	GiB          = 1024 * MiB
+	TiB          = 1024 * GiB
+	PiB          = 1024 * TiB
+)
+
+var byteUnits = map[string]ByteSize{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KB,
+	"kb":  KB,
+	"m":   MB,
+	"mb":  MB,
+	"g":   GB,
+	"gb":  GB,
+	"t":   TB,
+	"tb":  TB,
+	"p":   PB,
+	"pb":  PB,
+	"ki":  KiB,
+	"kib": KiB,
+	"mi":  MiB,
+	"mib": MiB,
+	"gi":  GiB,
+	"gib": GiB,
+	"ti":  TiB,
+	"tib": TiB,
+	"pi":  PiB,
+	"pib": PiB,
+}
+
+/*
+ParseByteSize parses a number of bytes with an optional decimal (kB, MB, ...)
+or binary (KiB, MiB, ...) unit. Units are case insensitive
+*/
+func ParseByteSize(str string) (ByteSize, error) {
+	str = strings.TrimSpace(str)
+	split := strings.IndexFunc(str, func(r rune) bool {
+		return !('0' <= r && r <= '9' || '.' == r)
+	})
+	if -1 == split {
+		split = len(str)
+	}
+	number, unit := str[:split], strings.ToLower(strings.TrimSpace(str[split:]))
+
+	size, err := strconv.ParseFloat(number, 64)
+	if nil != err {
+		return 0, fmt.Errorf("invalid byte size '%s'", str)
+	}
+	multiplier, ok := byteUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown byte size unit '%s'", str[split:])
+	}
+	size *= float64(multiplier)
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("byte size '%s' is too large", str)
+	}
+	return ByteSize(size), nil
+}
+
+/*
+String formats the size with the largest unit that divides it exactly
+*/
+func (size ByteSize) String() string {
+	units := []struct {
+		name string
+		size ByteSize
+	}{
+		{"PiB", PiB}, {"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB},
+		{"PB", PB}, {"TB", TB}, {"GB", GB}, {"MB", MB}, {"kB", KB},
+	}
+	for _, unit := range units {
+		if 0 != size && 0 == size%unit.size {
+			return fmt.Sprintf("%d%s", size/unit.size, unit.name)
+		}
+	}
+	return fmt.Sprintf("%dB", int64(size))
+}
+
+/*
+Counter is the value of a counting flag, used as a flag Default every use of
+the flag adds one, so "-vvv" is 3
+*/
+type Counter int
+
+/*
+appendValue parses a value and appends it to a slice flag. The first value
+replaces the default
+*/
+func (f *Flag) appendValue(str string) (interface{}, error) {
+	elem := f.elem()
+	if err := elem.Set(str); nil != err {
+		return nil, err
+	}
+	slice := reflect.MakeSlice(reflect.TypeOf(f.Default), 0, 1)
+	if nil != f.Value {
+		slice = reflect.ValueOf(f.Value)
+	}
+	return reflect.Append(slice, reflect.ValueOf(elem.Value)).Interface(), nil
+}
+
+/*
+putValue parses a "key=value" pair and adds it to a map flag. The first pair
+replaces the default
+*/
+func (f *Flag) putValue(str string) (interface{}, error) {
+	key, val, ok := strings.Cut(str, "=")
+	if !ok || "" == key {
+		return nil, fmt.Errorf("expected key=value")
+	}
+	elem := f.elem()
+	if err := elem.Set(val); nil != err {
+		return nil, err
+	}
+	typ := reflect.TypeOf(f.Default)
+	values := reflect.MakeMap(typ)
+	if nil != f.Value {
+		// copy so a failed parse doesn't change the value
+		values = reflect.MakeMapWithSize(typ, reflect.ValueOf(f.Value).Len()+1)
+		iter := reflect.ValueOf(f.Value).MapRange()
+		for iter.Next() {
+			values.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	values.SetMapIndex(reflect.ValueOf(key).Convert(typ.Key()), reflect.ValueOf(elem.Value))
+	return values.Interface(), nil
+}
+
+/*
+timeLayouts are the formats accepted by time flags
+*/
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseTime(str string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if value, err := time.Parse(layout, str); nil == err {
+			return value, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected RFC 3339 or YYYY-MM-DD", str)
+}
+
+func parseURL(str string) (*url.URL, error) {
+	value, err := url.Parse(str)
+	if nil != err {
+		return nil, err
+	}
+	if "" == value.Scheme {
+		return nil, fmt.Errorf("invalid URL '%s', a scheme is required", str)
+	}
+	return value, nil
+}
+
+func parseIP(str string) (net.IP, error) {
+	value := net.ParseIP(str)
+	if nil == value {
+		return nil, fmt.Errorf("invalid IP address '%s'", str)
+	}
+	return value, nil
+}
+
+/*
+parseNumber parses an integer, unsigned integer or float into the type of
+example
+*/
+func parseNumber(str string, example interface{}) (interface{}, error) {
+	typ := reflect.TypeOf(example)
+	value := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, err := strconv.ParseInt(str, 10, typ.Bits())
+		if nil != err {
+			return nil, err
+		}
+		value.SetInt(number)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, err := strconv.ParseUint(str, 10, typ.Bits())
+		if nil != err {
+			return nil, err
+		}
+		value.SetUint(number)
+	case reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(str, typ.Bits())
+		if nil != err {
+			return nil, err
+		}
+		value.SetFloat(number)
+	default:
+		return nil, fmt.Errorf("%T is not a number", example)
+	}
+	return value.Interface(), nil
+}
+
+/*
+formatValue formats a flag value the way it would be passed on the command
+line
+*/
+func formatValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case []byte:
+		return string(typed)
+	case time.Time:
+		return typed.Format(time.RFC3339Nano)
+	case float32:
+		return strconv.FormatFloat(float64(typed), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(typed, 'g', -1, 64)
+	case *url.URL:
+		if nil == typed {
+			return ""
+		}
+	case *net.IPNet:
+		if nil == typed {
+			return ""
+		}
+	case []interface{}, map[string]interface{}:
+		// decoded JSON
+		data, _ := json.Marshal(value)
+		return string(data)
+	case fmt.Stringer:
+		return typed.String()
+	}
+
+	switch reflected := reflect.ValueOf(value); reflected.Kind() {
+	case reflect.Slice:
+		items := make([]string, 0, reflected.Len())
+		for k := 0; k < reflected.Len(); k++ {
+			items = append(items, formatValue(reflected.Index(k).Interface()))
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		items := make([]string, 0, reflected.Len())
+		iter := reflected.MapRange()
+		for iter.Next() {
+			items = append(items, fmt.Sprintf("%v=%s", iter.Key().Interface(), formatValue(iter.Value().Interface())))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
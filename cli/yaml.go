@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+yamlLine is a line of a YAML document with comments and indentation removed
+*/
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+/*
+ParseYAML decodes the subset of YAML used by configuration files: nested
+mappings and sequences, flow sequences of scalars, quoted and plain scalars and
+comments. The result uses the same types as encoding/json so it can be
+re-encoded as JSON
+*/
+func ParseYAML(data []byte) (interface{}, error) {
+	lines := make([]*yamlLine, 0)
+	for k, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.Contains(raw, "\t") && "" == strings.TrimLeft(raw[:strings.Index(raw, "\t")], " ") {
+			return nil, fmt.Errorf("yaml: line %d: tabs can't be used for indentation", k+1)
+		}
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if "" == trimmed || "---" == trimmed {
+			continue
+		}
+		lines = append(lines, &yamlLine{number: k + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if 0 == len(lines) {
+		return nil, nil
+	}
+
+	parser := &yamlParser{lines: lines}
+	value, err := parser.block(lines[0].indent)
+	if nil != err {
+		return nil, err
+	}
+	if parser.pos < len(lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", lines[parser.pos].number)
+	}
+	return value, nil
+}
+
+/*
+stripYAMLComment removes a trailing comment outside of any quotes
+*/
+func stripYAMLComment(line string) string {
+	var quote rune
+	for k, char := range line {
+		switch {
+		case 0 != quote:
+			if char == quote {
+				quote = 0
+			}
+		case '"' == char || '\'' == char:
+			quote = char
+		case '#' == char && (0 == k || ' ' == line[k-1] || '\t' == line[k-1]):
+			return line[:k]
+		}
+	}
+	return line
+}
+
+type yamlParser struct {
+	lines []*yamlLine
+	pos   int
+}
+
+/*
+block parses the mapping or sequence starting at the current line
+*/
+func (parser *yamlParser) block(indent int) (interface{}, error) {
+	if isYAMLSequenceItem(parser.lines[parser.pos].text) {
+		return parser.sequence(indent)
+	}
+	return parser.mapping(indent)
+}
+
+func (parser *yamlParser) mapping(indent int) (interface{}, error) {
+	result := make(map[string]interface{})
+	for parser.pos < len(parser.lines) {
+		line := parser.lines[parser.pos]
+		if line.indent < indent || (line.indent == indent && isYAMLSequenceItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.number)
+		}
+
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected 'key: value'", line.number)
+		}
+		if _, exists := result[key]; exists {
+			return nil, fmt.Errorf("yaml: line %d: duplicate key '%s'", line.number, key)
+		}
+		parser.pos++
+
+		if "" != rest {
+			value, err := parseYAMLValue(rest, line.number)
+			if nil != err {
+				return nil, err
+			}
+			result[key] = value
+			continue
+		}
+
+		// A nested block is indented, a sequence may also start at the same
+		// indentation as its key
+		result[key] = nil
+		if parser.pos < len(parser.lines) {
+			next := parser.lines[parser.pos]
+			if next.indent > indent || (next.indent == indent && isYAMLSequenceItem(next.text)) {
+				value, err := parser.block(next.indent)
+				if nil != err {
+					return nil, err
+				}
+				result[key] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+func (parser *yamlParser) sequence(indent int) (interface{}, error) {
+	result := make([]interface{}, 0)
+	for parser.pos < len(parser.lines) {
+		line := parser.lines[parser.pos]
+		if line.indent != indent || !isYAMLSequenceItem(line.text) {
+			if line.indent > indent {
+				return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.number)
+			}
+			break
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if "" == rest {
+			parser.pos++
+			if parser.pos < len(parser.lines) && parser.lines[parser.pos].indent > indent {
+				value, err := parser.block(parser.lines[parser.pos].indent)
+				if nil != err {
+					return nil, err
+				}
+				result = append(result, value)
+			} else {
+				result = append(result, nil)
+			}
+			continue
+		}
+
+		// "- key: value" starts a mapping indented to the first key
+		if _, _, ok := splitYAMLKey(rest); ok {
+			line.indent += len(line.text) - len(rest)
+			line.text = rest
+			value, err := parser.mapping(line.indent)
+			if nil != err {
+				return nil, err
+			}
+			result = append(result, value)
+			continue
+		}
+
+		value, err := parseYAMLValue(rest, line.number)
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, value)
+		parser.pos++
+	}
+	return result, nil
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return "-" == text || strings.HasPrefix(text, "- ")
+}
+
+/*
+splitYAMLKey splits a "key: value" line
+*/
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		end := strings.IndexRune(text[1:], rune(text[0]))
+		if end < 0 {
+			return "", "", false
+		}
+		key, err := unquoteYAML(text[:end+2])
+		rest := text[end+2:]
+		if nil != err || !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest[1:]), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true
+	}
+	if k := strings.Index(text, ": "); k > 0 && !strings.HasPrefix(text, "[") && !strings.HasPrefix(text, "{") {
+		return strings.TrimSpace(text[:k]), strings.TrimSpace(text[k+2:]), true
+	}
+	return "", "", false
+}
+
+/*
+parseYAMLValue parses an inline value, a scalar or flow sequence
+*/
+func parseYAMLValue(text string, number int) (interface{}, error) {
+	switch {
+	case "{}" == text:
+		return map[string]interface{}{}, nil
+	case strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">"):
+		return nil, fmt.Errorf("yaml: line %d: block scalars are not supported", number)
+	case strings.HasPrefix(text, "{"):
+		return nil, fmt.Errorf("yaml: line %d: flow mappings are not supported", number)
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("yaml: line %d: unterminated sequence", number)
+		}
+		result := make([]interface{}, 0)
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if "" == inner {
+			return result, nil
+		}
+		for _, item := range splitYAMLFlow(inner) {
+			value, err := parseYAMLScalar(strings.TrimSpace(item))
+			if nil != err {
+				return nil, fmt.Errorf("yaml: line %d: %v", number, err)
+			}
+			result = append(result, value)
+		}
+		return result, nil
+	}
+	value, err := parseYAMLScalar(text)
+	if nil != err {
+		return nil, fmt.Errorf("yaml: line %d: %v", number, err)
+	}
+	return value, nil
+}
+
+/*
+splitYAMLFlow splits the items of a flow sequence on commas outside quotes
+*/
+func splitYAMLFlow(text string) []string {
+	items := make([]string, 0)
+	var quote rune
+	start := 0
+	for k, char := range text {
+		switch {
+		case 0 != quote:
+			if char == quote {
+				quote = 0
+			}
+		case '"' == char || '\'' == char:
+			quote = char
+		case ',' == char:
+			items = append(items, text[start:k])
+			start = k + 1
+		}
+	}
+	return append(items, text[start:])
+}
+
+func parseYAMLScalar(text string) (interface{}, error) {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		return unquoteYAML(text)
+	}
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if _, err := strconv.ParseInt(text, 10, 64); nil == err {
+		return json.Number(text), nil
+	}
+	if _, err := strconv.ParseFloat(text, 64); nil == err {
+		return json.Number(text), nil
+	}
+	return text, nil
+}
+
+func unquoteYAML(text string) (string, error) {
+	if len(text) < 2 || text[0] != text[len(text)-1] {
+		return "", fmt.Errorf("unterminated string %s", text)
+	}
+	if '\'' == text[0] {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	var value string
+	if err := json.Unmarshal([]byte(text), &value); nil != err {
+		return "", fmt.Errorf("invalid string %s", text)
+	}
+	return value, nil
+}
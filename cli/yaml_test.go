@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	doc := `
+# server settings
+port: ":9000"
+limits:
+  max_body_bytes: 1024   # one KiB
+  body_read_timeout: 5s
+cors:
+  allowed_origins: ["https://a.example", 'https://b.example']
+  allowed_methods:
+  - GET
+  - POST
+static:
+  - prefix: /assets/
+    spa_fallback: true
+  - prefix: "/docs/"
+routes: {}
+empty:
+`
+	value, err := ParseYAML([]byte(doc))
+	if nil != err {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(value)
+	expect := `{"cors":{"allowed_methods":["GET","POST"],"allowed_origins":["https://a.example","https://b.example"]},"empty":null,"limits":{"body_read_timeout":"5s","max_body_bytes":1024},"port":":9000","routes":{},"static":[{"prefix":"/assets/","spa_fallback":true},{"prefix":"/docs/"}]}`
+	if expect != string(data) {
+		t.Errorf("expected %s, %s found", expect, string(data))
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	docs := map[string]string{
+		"a: 1\n  b: 2":   "yaml: line 2: unexpected indentation",
+		"a: 1\na: 2":     "yaml: line 2: duplicate key 'a'",
+		"a: |\n  text":   "yaml: line 1: block scalars are not supported",
+		"a:\n\t- b":      "yaml: line 2: tabs can't be used for indentation",
+		"just some text": "yaml: line 1: expected 'key: value'",
+	}
+	for doc, expect := range docs {
+		if _, err := ParseYAML([]byte(doc)); nil == err || expect != err.Error() {
+			t.Errorf("expected '%s', '%v' found", expect, err)
+		}
+	}
+}
@@ -139,9 +139,18 @@ Exposed as a public method to give access to the json_encode() parameters
 func (cn *Collection) JSON() (string, error) {
 	data := make([]interface{}, 0)
 	for _, v := range cn.data {
-		data = append(data, v.Data())
+		strings, slices := jsonHelper(v)
+		if 0 != len(strings) {
+			data = append(data, strings)
+		} else {
+			data = append(data, slices)
+		}
+	}
+	filtered, err := cn.view.Apply(data)
+	if nil != err {
+		return "", err
 	}
-	str, err := json.Marshal(data)
+	str, err := json.Marshal(filtered)
 	return string(str), err
 }
 
@@ -307,6 +316,21 @@ func (cn *Collection) SetView(view *View) error {
 	return nil
 }
 
+/*
+Slice returns up to limit models starting at offset. Out of range values return
+an empty slice
+*/
+func (cn *Collection) Slice(offset, limit int) []*Model {
+	if offset < 0 || limit <= 0 || offset >= len(cn.data) {
+		return make([]*Model, 0)
+	}
+	end := offset + limit
+	if end > len(cn.data) {
+		end = len(cn.data)
+	}
+	return cn.data[offset:end]
+}
+
 /*
 String converts the data to a text representation, should generally be JSON by
 default
@@ -215,3 +215,23 @@ func TestCollectionFilter(t *testing.T) {
 	actual, _ = data[0].Get("a")
 	assert(t, expect, actual, err)
 }
+
+func TestCollectionSlice(t *testing.T) {
+	var expect interface{}
+	var actual interface{}
+	var err error
+
+	collection := makeFilteringCollection()
+
+	expect = collection.Data()[1:3]
+	actual = collection.Slice(1, 5)
+	assert(t, expect, actual, err)
+
+	expect = 0
+	actual = len(collection.Slice(3, 5))
+	assert(t, expect, actual, err)
+
+	expect = 0
+	actual = len(collection.Slice(-1, 5))
+	assert(t, expect, actual, err)
+}
@@ -27,3 +27,13 @@ const ErrorCollectionIsEmpty = "this collection is empty"
 ErrorCollectionIndexDoesNotExist - used when attempting to access a Model in an empty Collection
 */
 const ErrorCollectionIndexDoesNotExist = "the specified index '%v' does not exist"
+
+/*
+ErrorViewInvalidPath - used when a View field path is malformed
+*/
+const ErrorViewInvalidPath = "invalid field path '%s'"
+
+/*
+ErrorViewUnknownFields - used when View field paths do not match any data
+*/
+const ErrorViewUnknownFields = "unknown field(s) '%s'"
@@ -251,14 +251,16 @@ Exposed as a public method to give access to the json_encode() parameters
 */
 func (ma *Model) JSON() (string, error) {
 	strings, slices := jsonHelper(ma)
-	var bytes []byte
-	var err error
-
+	var data interface{} = slices
 	if 0 != len(strings) {
-		bytes, err = json.Marshal(strings)
-	} else {
-		bytes, err = json.Marshal(slices)
+		data = strings
+	}
+
+	data, err := ma.view.Apply(data)
+	if nil != err {
+		return "", err
 	}
+	bytes, err := json.Marshal(data)
 	return string(bytes), err
 }
 func jsonHelper(ma *Model) (map[string]interface{}, []interface{}) {
@@ -3,7 +3,339 @@ Package model is a data-driven modeling abstraction
 */
 package model
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
 /*
 View represents a data filter and transformation service for a Model
+
+A View holds two sets of dotted field paths, e.g. "a" or "b.c". If any include
+paths are defined only those fields are kept, then any exclude paths are
+removed from the result. Paths traverse into arrays transparently, so "b.c"
+matches the "c" field of every object in an array stored at "b".
+*/
+type View struct {
+
+	/*
+		Field paths to keep, if empty all fields are kept
+	*/
+	include []string
+
+	/*
+		Field paths to remove
+	*/
+	exclude []string
+}
+
+/*
+viewTree is a parsed set of field paths. A nil subtree marks a leaf, meaning
+the entire value at that path is selected
+*/
+type viewTree map[string]viewTree
+
+/*
+NewView initializes and returns a pointer to a View
+*/
+func NewView() *View {
+	return new(View)
+}
+
+/*
+ParseView returns a View from comma separated lists of include and exclude
+field paths, e.g. the values of "?fields=a,b.c&exclude=b.d" query parameters
+*/
+func ParseView(fields, exclude string) (*View, error) {
+	view := NewView()
+	for _, path := range splitViewPaths(fields) {
+		if err := validateViewPath(path); nil != err {
+			return nil, err
+		}
+		view.include = append(view.include, path)
+	}
+	for _, path := range splitViewPaths(exclude) {
+		if err := validateViewPath(path); nil != err {
+			return nil, err
+		}
+		view.exclude = append(view.exclude, path)
+	}
+	return view, nil
+}
+
+func splitViewPaths(list string) []string {
+	paths := make([]string, 0)
+	for _, path := range strings.Split(list, ",") {
+		path = strings.TrimSpace(path)
+		if "" != path {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func validateViewPath(path string) error {
+	for _, part := range strings.Split(path, ".") {
+		if "" == part {
+			return fmt.Errorf(ErrorViewInvalidPath, path)
+		}
+	}
+	return nil
+}
+
+/*
+Include adds field paths to keep
+*/
+func (vw *View) Include(paths ...string) *View {
+	vw.include = append(vw.include, paths...)
+	return vw
+}
+
+/*
+Exclude adds field paths to remove
 */
-type View struct{}
+func (vw *View) Exclude(paths ...string) *View {
+	vw.exclude = append(vw.exclude, paths...)
+	return vw
+}
+
+/*
+Included returns the field paths to keep
+*/
+func (vw *View) Included() []string {
+	return vw.include
+}
+
+/*
+Excluded returns the field paths to remove
+*/
+func (vw *View) Excluded() []string {
+	return vw.exclude
+}
+
+/*
+IsEmpty returns true if the View does not filter anything
+*/
+func (vw *View) IsEmpty() bool {
+	return nil == vw || (0 == len(vw.include) && 0 == len(vw.exclude))
+}
+
+/*
+Apply filters data through the View and returns the result. The data is first
+normalized to its JSON representation so structs, maps and Models are all
+handled the same way. An error is returned if a path matches nothing in the
+data. Paths that had no data to match, e.g. in an empty list, are not errors.
+*/
+func (vw *View) Apply(data interface{}) (interface{}, error) {
+	if vw.IsEmpty() {
+		return data, nil
+	}
+
+	normalized, err := normalizeViewData(data)
+	if nil != err {
+		return nil, err
+	}
+
+	match := newViewMatch()
+	if 0 != len(vw.include) {
+		normalized = includeViewTree(normalized, buildViewTree(vw.include), "", match)
+	}
+	if 0 != len(vw.exclude) {
+		normalized = excludeViewTree(normalized, buildViewTree(vw.exclude), "", match)
+	}
+
+	unknown := make([]string, 0)
+	for _, path := range append(append([]string{}, vw.include...), vw.exclude...) {
+		if match.unknown(path) {
+			unknown = append(unknown, path)
+		}
+	}
+	if 0 != len(unknown) {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf(ErrorViewUnknownFields, strings.Join(unknown, "', '"))
+	}
+
+	return normalized, nil
+}
+
+/*
+viewMatch records how View paths matched the data. seen holds the paths that
+selected a field, found holds every path that named a field in the data and
+searched holds the paths that had a value to look fields up in, "" for the
+top level
+*/
+type viewMatch struct {
+	seen     map[string]bool
+	found    map[string]bool
+	searched map[string]bool
+}
+
+func newViewMatch() *viewMatch {
+	return &viewMatch{
+		seen:     make(map[string]bool),
+		found:    make(map[string]bool),
+		searched: make(map[string]bool),
+	}
+}
+
+/*
+unknown checks whether a path names a field that isn't in the data. Fields
+under a path that had no data to match, e.g. an empty list, aren't unknown
+*/
+func (match *viewMatch) unknown(path string) bool {
+	if match.seenPath(path) {
+		return false
+	}
+	parts := strings.Split(path, ".")
+	for k := range parts {
+		if !match.searched[strings.Join(parts[:k], ".")] {
+			return false
+		}
+		if !match.found[strings.Join(parts[:k+1], ".")] {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+seenPath checks whether a path, or a parent path that selected it, matched
+the data
+*/
+func (match *viewMatch) seenPath(path string) bool {
+	parts := strings.Split(path, ".")
+	for k := range parts {
+		if match.seen[strings.Join(parts[:k+1], ".")] {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeViewData(data interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if nil != err {
+		return nil, err
+	}
+	var normalized interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&normalized); nil != err {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func buildViewTree(paths []string) viewTree {
+	tree := make(viewTree)
+	for _, path := range paths {
+		node := tree
+		parts := strings.Split(path, ".")
+		for k, part := range parts {
+			child, ok := node[part]
+			if k == len(parts)-1 {
+				// a shorter path selects the whole subtree
+				node[part] = nil
+				break
+			}
+			if ok && nil == child {
+				break
+			}
+			if !ok {
+				child = make(viewTree)
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+func joinViewPath(prefix, key string) string {
+	if "" == prefix {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func includeViewTree(data interface{}, tree viewTree, prefix string, match *viewMatch) interface{} {
+	switch typed := data.(type) {
+	case []interface{}:
+		retVal := make([]interface{}, 0, len(typed))
+		for _, v := range typed {
+			retVal = append(retVal, includeViewTree(v, tree, prefix, match))
+		}
+		return retVal
+	case map[string]interface{}:
+		match.searched[prefix] = true
+		retVal := make(map[string]interface{})
+		for key, subtree := range tree {
+			v, ok := typed[key]
+			if !ok {
+				continue
+			}
+			path := joinViewPath(prefix, key)
+			match.found[path] = true
+			if nil == subtree {
+				match.seen[path] = true
+				retVal[key] = v
+			} else if filtered, ok := includeViewChild(v, subtree, path, match); ok {
+				retVal[key] = filtered
+			}
+		}
+		return retVal
+	}
+	if nil != data {
+		match.searched[prefix] = true
+	}
+	return data
+}
+
+/*
+includeViewChild descends into a nested value, reporting false if it cannot
+contain the requested fields
+*/
+func includeViewChild(data interface{}, tree viewTree, prefix string, match *viewMatch) (interface{}, bool) {
+	switch data.(type) {
+	case []interface{}, map[string]interface{}:
+		return includeViewTree(data, tree, prefix, match), true
+	}
+	if nil != data {
+		match.searched[prefix] = true
+	}
+	return nil, false
+}
+
+func excludeViewTree(data interface{}, tree viewTree, prefix string, match *viewMatch) interface{} {
+	switch typed := data.(type) {
+	case []interface{}:
+		for k, v := range typed {
+			typed[k] = excludeViewTree(v, tree, prefix, match)
+		}
+		return typed
+	case map[string]interface{}:
+		match.searched[prefix] = true
+		for key, subtree := range tree {
+			v, ok := typed[key]
+			if !ok {
+				continue
+			}
+			path := joinViewPath(prefix, key)
+			match.found[path] = true
+			if nil == subtree {
+				match.seen[path] = true
+				delete(typed, key)
+			} else {
+				typed[key] = excludeViewTree(v, subtree, path, match)
+			}
+		}
+		return typed
+	}
+	if nil != data {
+		match.searched[prefix] = true
+	}
+	return data
+}
@@ -0,0 +1,94 @@
+/*
+Package model is a data-driven modeling abstraction
+*/
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func viewTestData() interface{} {
+	var data interface{}
+	json.Unmarshal([]byte(`[
+		{"a": 1, "b": {"c": 2, "d": 3}, "e": [{"f": 4, "g": 5}, {"f": 6, "g": 7}]},
+		{"a": 8, "b": {"c": 9, "d": 10}}
+	]`), &data)
+	return data
+}
+
+func viewJSON(t *testing.T, data interface{}) string {
+	bytes, err := json.Marshal(data)
+	if nil != err {
+		t.Fatalf("%s", err)
+	}
+	return string(bytes)
+}
+
+func TestViewInclude(t *testing.T) {
+	view, err := ParseView("a,b.c,e.f", "")
+	if nil != err {
+		triggerError(t, err)
+	}
+	result, err := view.Apply(viewTestData())
+	expect := `[{"a":1,"b":{"c":2},"e":[{"f":4},{"f":6}]},{"a":8,"b":{"c":9}}]`
+	assert(t, expect, viewJSON(t, result), err)
+}
+
+func TestViewExclude(t *testing.T) {
+	view, err := ParseView("", "b.d,e")
+	if nil != err {
+		triggerError(t, err)
+	}
+	result, err := view.Apply(viewTestData())
+	expect := `[{"a":1,"b":{"c":2}},{"a":8,"b":{"c":9}}]`
+	assert(t, expect, viewJSON(t, result), err)
+}
+
+func TestViewIncludeExclude(t *testing.T) {
+	view := NewView().Include("b").Exclude("b.c")
+	result, err := view.Apply(viewTestData())
+	expect := `[{"b":{"d":3}},{"b":{"d":10}}]`
+	assert(t, expect, viewJSON(t, result), err)
+}
+
+func TestViewUnknownFields(t *testing.T) {
+	view := NewView().Include("a", "x", "b.y")
+	_, err := view.Apply(viewTestData())
+	assertError(t, nil, nil, err)
+	assert(t, "unknown field(s) 'b.y', 'x'", err.Error(), nil)
+}
+
+func TestViewInvalidPath(t *testing.T) {
+	_, err := ParseView("a,,b..c", "")
+	assertError(t, nil, nil, err)
+}
+
+func TestViewEmpty(t *testing.T) {
+	data := viewTestData()
+	result, err := NewView().Apply(data)
+	assert(t, viewJSON(t, data), viewJSON(t, result), err)
+}
+
+func TestModelJSONView(t *testing.T) {
+	model := NewModel()
+	model.Set("a", "value1")
+	model.Set("b", "value2")
+	model.SetView(NewView().Exclude("b"))
+	result, err := model.JSON()
+	assert(t, `{"a":"value1"}`, result, err)
+}
+
+func TestViewEmptyData(t *testing.T) {
+	result, err := NewView().Include("id").Exclude("b.c").Apply([]interface{}{})
+	assert(t, "[]", viewJSON(t, result), err)
+
+	var data interface{}
+	json.Unmarshal([]byte(`[{"id": 1, "e": []}]`), &data)
+	result, err = NewView().Include("id", "e.f").Apply(data)
+	assert(t, `[{"e":[],"id":1}]`, viewJSON(t, result), err)
+
+	_, err = NewView().Include("e.f", "x.y").Apply(data)
+	assertError(t, nil, nil, err)
+	assert(t, "unknown field(s) 'x.y'", err.Error(), nil)
+}